@@ -1,13 +1,17 @@
 package at.deder.babylon.client;
 
+import java.util.ArrayList;
 import java.util.HashMap;
+import java.util.List;
 import java.util.Map;
 
 public class ActorAction {
     private final Map<String, Object> parameters = new HashMap<String, Object>();
+    private final List<Expectation> expect = new ArrayList<>();
     private final String driverType;
     private final BabylonClient client;
     private String action;
+    private String id;
 
     public ActorAction(BabylonClient client, String driverType) {
         this.client = client;
@@ -15,6 +19,18 @@ public class ActorAction {
     }
 
 
+    public String getId() {
+        return id;
+    }
+
+    /**
+     * Sets the step id under which later actions can reference the result, e.g. ${steps.<id>.data.value}.
+     */
+    public ActorAction id(String id) {
+        this.id = id;
+        return this;
+    }
+
     public String getSession() {
         return client.session().uuid();
     }
@@ -41,6 +57,15 @@ public class ActorAction {
         return this;
     }
 
+    public List<Expectation> getExpect() {
+        return expect;
+    }
+
+    public ActorAction expect(String path, String op, Object value) {
+        expect.add(new Expectation(path, op, value));
+        return this;
+    }
+
     public ExecutionResult execute() {
         return client.api().executeActorAction(this);
     }
@@ -0,0 +1,10 @@
+package at.deder.babylon.client;
+
+import java.util.Base64;
+
+public record Artifact(String name, String contentType, String content) {
+
+  public byte[] bytes() {
+    return Base64.getDecoder().decode(content);
+  }
+}
@@ -0,0 +1,4 @@
+package at.deder.babylon.client;
+
+public record AssertionResult(String path, String op, Object expected, Object actual, boolean passed, String reason) {
+}
@@ -1,4 +1,6 @@
 package at.deder.babylon.client;
 
-public record ExecutionResult(boolean success, String message) {
+import java.util.List;
+
+public record ExecutionResult(boolean success, String message, Object data, String errorCode, List<Artifact> artifacts, List<AssertionResult> assertions) {
 }
@@ -0,0 +1,4 @@
+package at.deder.babylon.client;
+
+public record Expectation(String path, String op, Object value) {
+}
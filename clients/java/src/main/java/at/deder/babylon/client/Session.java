@@ -1,4 +1,4 @@
 package at.deder.babylon.client;
 
-public record Session(String uuid, SessionContext context) {
+public record Session(String uuid, String status, SessionContext context) {
 }
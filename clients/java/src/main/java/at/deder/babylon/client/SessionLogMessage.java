@@ -2,5 +2,5 @@ package at.deder.babylon.client;
 
 import java.util.Date;
 
-public record SessionLogMessage(Date timestamp, String type, String message) {
+public record SessionLogMessage(Date timestamp, String type, String message, Object data) {
 }
@@ -0,0 +1,22 @@
+package at.deder.babylon.extension;
+
+import io.vertx.core.json.JsonObject;
+
+import java.util.Base64;
+
+/**
+ * A file that is attached to the result of an action, e.g. a screenshot. The content is base64 encoded.
+ */
+public record Artifact(String name, String contentType, String content) {
+
+  public static Artifact of(String name, String contentType, byte[] content) {
+    return new Artifact(name, contentType, Base64.getEncoder().encodeToString(content));
+  }
+
+  public JsonObject toJson() {
+    return new JsonObject()
+      .put("name", name)
+      .put("contentType", contentType)
+      .put("content", content);
+  }
+}
@@ -1,27 +1,64 @@
 package at.deder.babylon.extension;
 
+import io.vertx.core.json.JsonArray;
 import io.vertx.core.json.JsonObject;
 
 import java.io.Serializable;
+import java.util.ArrayList;
+import java.util.List;
 import java.util.Map;
 
-public record ExecutionResult(boolean success, String message, Object data) {
+public record ExecutionResult(boolean success, String message, Object data, String errorCode, List<Artifact> artifacts) {
+
+  public ExecutionResult(boolean success, String message, Object data, String errorCode) {
+    this(success, message, data, errorCode, List.of());
+  }
 
   public ExecutionResult(boolean success, String message) {
-    this(success, message, null);
+    this(success, message, null, null);
+  }
+
+  public ExecutionResult(boolean success, String message, Object data) {
+    this(success, message, data, null);
   }
 
   public static ExecutionResult failure(String message) {
     return new ExecutionResult(false, message);
   }
 
+  public static ExecutionResult failure(String message, String errorCode) {
+    return new ExecutionResult(false, message, null, errorCode);
+  }
+
   public static ExecutionResult success(String message) {
     return new ExecutionResult(true, message);
   }
 
+  public static ExecutionResult success(String message, Object data) {
+    return new ExecutionResult(true, message, data);
+  }
+
+  public ExecutionResult withArtifact(Artifact artifact) {
+    var list = new ArrayList<>(artifacts == null ? List.of() : artifacts);
+    list.add(artifact);
+    return new ExecutionResult(success, message, data, errorCode, list);
+  }
+
   public JsonObject toJson() {
-    return new JsonObject()
+    var json = new JsonObject()
       .put("success", success)
       .put("message", message);
+    if (data != null) {
+      json.put("data", data);
+    }
+    if (errorCode != null) {
+      json.put("errorCode", errorCode);
+    }
+    if (artifacts != null && !artifacts.isEmpty()) {
+      var array = new JsonArray();
+      artifacts.forEach(a -> array.add(a.toJson()));
+      json.put("artifacts", array);
+    }
+    return json;
   }
 }
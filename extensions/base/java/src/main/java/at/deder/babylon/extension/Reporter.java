@@ -38,6 +38,8 @@ public class Reporter implements Extension {
     if (implementation.isLiveReporter()) {
       router.post("/reporter/" + implementation.getName().toLowerCase() + "/live").handler(BodyHandler.create());
       router.post("/reporter/" + implementation.getName().toLowerCase() + "/live").handler(new BlockingHandlerDecorator(this::handleLiveReport, true));
+      router.post("/reporter/" + implementation.getName().toLowerCase() + "/live/batch").handler(BodyHandler.create());
+      router.post("/reporter/" + implementation.getName().toLowerCase() + "/live/batch").handler(new BlockingHandlerDecorator(this::handleLiveBatchReport, true));
     }
 
     // session end report endpoint
@@ -91,6 +93,7 @@ public class Reporter implements Extension {
       .put("type", "reporter")
       .put("secret", getImplementation().getSecret())
       .put("live", getImplementation().isLiveReporter())
+      .put("batch", getImplementation().isLiveReporter())
       .put("callback", "http://" + extensionServer.getHostName() + ":" + extensionServer.getPort() + "/");
     context.response().setStatusCode(200);
     context.json(registrationData);
@@ -176,12 +179,12 @@ public class Reporter implements Extension {
           throw new IllegalArgumentException("Missing message in log entry");
         }
 
-        logMessages.add(new SessionLogMessage(timestamp, type, message));
+        logMessages.add(new SessionLogMessage(timestamp, type, message, logObject.getValue("data")));
       }
     }
 
     SessionContext context = new SessionContext(logMessages);
-    return new Session(uuid, context);
+    return new Session(uuid, data.getString("status"), context);
   }
 
   private void handleLiveReport(RoutingContext context) {
@@ -231,6 +234,57 @@ public class Reporter implements Extension {
     context.json("ok");
   }
 
+  private void handleLiveBatchReport(RoutingContext context) {
+    JsonObject data = context.body().asJsonObject();
+    String hostAddress = context.request().remoteAddress().hostAddress();
+    String hostName = context.request().remoteAddress().hostName();
+
+    if (data == null) {
+      closeInvalidDataRequest(context, hostAddress, hostName);
+      return;
+    }
+
+    String uuid = data.getString("session");
+    if (uuid == null) {
+      closeWithMissingSession(context, null, hostAddress, hostName);
+      return;
+    }
+
+    JsonArray messages = data.getJsonArray("messages");
+    if (messages == null) {
+      context.response().setStatusCode(400);
+      context.json(new JsonObject().put("error", "missing messages"));
+      LOGGER.warn("Live logging batch is missing messages. source=\"{} ({})\"", hostAddress, hostName);
+      return;
+    }
+
+    for (Object element : messages) {
+      if (!(element instanceof JsonObject msg) || msg.getString("type") == null || msg.getString("message") == null) {
+        context.response().setStatusCode(400);
+        context.json(new JsonObject().put("error", "invalid message in batch"));
+        LOGGER.warn("Live logging batch contains an invalid message. source=\"{} ({})\"", hostAddress, hostName);
+        return;
+      }
+    }
+
+    LOGGER.info("Received live logging batch. session=\"{}\" messages={} source=\"{} ({})\"", uuid, messages.size(), hostAddress, hostName);
+
+    // messages are passed on in order until one fails, the server only sends
+    // the messages after the delivered ones again
+    int rc = 200;
+    int delivered = 0;
+    for (Object element : messages) {
+      JsonObject msg = (JsonObject) element;
+      rc = implementation.liveLog(uuid, msg.getString("type"), msg.getString("message"));
+      if (rc != 200) {
+        break;
+      }
+      delivered++;
+    }
+    context.response().setStatusCode(rc);
+    context.json(new JsonObject().put("delivered", delivered));
+  }
+
   @Override
   public void registerRemote(Vertx vertx) {
     throw new RuntimeException("not implemented");
@@ -1,16 +1,15 @@
-package main
+package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
-	"sync"
 
 	"github.com/google/uuid"
-	"github.com/spf13/viper"
 )
 
 type ActorInfo struct {
@@ -20,44 +19,55 @@ type ActorInfo struct {
 	Secret   string
 }
 
-// list of all known / registered actors with their callback
-var knownActors map[string]ActorInfo
-var knownActorsMutex sync.Mutex
+// informActorsEndOfSession tells all actors that the session ended. The
+// requests are sent without holding the actors lock and end with the context.
+func (s *Server) informActorsEndOfSession(ctx context.Context, id uuid.UUID) {
+	s.actorsMutex.Lock()
+	actors := make([]ActorInfo, 0, len(s.actors))
+	for _, actor := range s.actors {
+		actors = append(actors, actor)
+	}
+	s.actorsMutex.Unlock()
 
-func informActorsEndOfSession(id uuid.UUID) {
-	knownActorsMutex.Lock()
-	defer knownActorsMutex.Unlock()
+	client := &http.Client{Timeout: s.executionTimeout()}
+	for _, actor := range actors {
+		if ctx.Err() != nil {
+			return
+		}
+		breaker := s.breakers.get("actor", actor.Name)
+		if !breaker.allow() {
+			s.logger.With("actor", actor.Name, "session", id.String()).Warn("Circuit breaker open. Not informing actor of session end.")
+			continue
+		}
 
-	for k, driver := range knownActors {
-		logger.With("actor", k, "session", id.String()).Info("Informing actor of session end.")
-		driverURL := fmt.Sprintf("%sactor/%s/session/%s", driver.Callback, driver.Name, id.String())
-		req, err := http.NewRequest(http.MethodDelete, driverURL, nil)
+		s.logger.With("actor", actor.Name, "session", id.String()).Info("Informing actor of session end.")
+		actorURL := fmt.Sprintf("%sactor/%s/session/%s", actor.Callback, actor.Name, id.String())
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, actorURL, nil)
 		if err != nil {
-			logger.With("actor", k, "session", id.String(), "error", err.Error()).Error("Creating request to inform actor of session end failed.")
+			breaker.record(false)
+			s.logger.With("actor", actor.Name, "session", id.String(), "error", err.Error()).Error("Creating request to inform actor of session end failed.")
 			continue
 		}
-		client := &http.Client{}
 		resp, err := client.Do(req)
 		if err != nil {
-			logger.With("cator", k, "session", id.String(), "error", err.Error()).Error("Informing actor of session end failed.")
+			breaker.record(false)
+			s.logger.With("actor", actor.Name, "session", id.String(), "error", err.Error()).Error("Informing actor of session end failed.")
 			continue
 		}
+		resp.Body.Close()
+		breaker.record(resp.StatusCode < http.StatusInternalServerError)
 
 		if resp.StatusCode != http.StatusOK {
-			logger.With("cator", k, "session", id.String(), "statusCode", resp.StatusCode).Error("Informing actor of session end failed.")
+			s.logger.With("actor", actor.Name, "session", id.String(), "statusCode", resp.StatusCode).Error("Informing actor of session end failed.")
 			continue
 		}
 	}
 }
 
-func init() {
-	knownActors = make(map[string]ActorInfo)
-}
-
-func findActorByType(t string) *ActorInfo {
-	knownActorsMutex.Lock()
-	defer knownActorsMutex.Unlock()
-	for _, di := range knownActors {
+func (s *Server) findActorByType(t string) *ActorInfo {
+	s.actorsMutex.Lock()
+	defer s.actorsMutex.Unlock()
+	for _, di := range s.actors {
 		if di.Type == t {
 			return &di
 		}
@@ -76,9 +86,9 @@ type ActorDeleteRequest struct {
 	Name string `json:"actor"`
 }
 
-func registerActor(w http.ResponseWriter, r *http.Request) {
-	knownActorsMutex.Lock()
-	defer knownActorsMutex.Unlock()
+func (s *Server) registerActor(w http.ResponseWriter, r *http.Request) {
+	s.actorsMutex.Lock()
+	defer s.actorsMutex.Unlock()
 
 	if r.Method == http.MethodPost {
 		var registerReq ActorRegisterRequest
@@ -91,9 +101,10 @@ func registerActor(w http.ResponseWriter, r *http.Request) {
 			registerReq.Callback = fmt.Sprintf("http://%s:8082/", strings.Split(r.RemoteAddr, ":")[0])
 		}
 
-		knownActors[registerReq.Name] = ActorInfo(registerReq)
+		s.actors[registerReq.Name] = ActorInfo(registerReq)
+		s.breakers.reset("actor", registerReq.Name)
 
-		logger.With("name", registerReq.Name, "type", registerReq.Type, "callback", registerReq.Callback).Info("New actor registered.")
+		s.logger.With("name", registerReq.Name, "type", registerReq.Type, "callback", registerReq.Callback).Info("New actor registered.")
 		return
 	} else if r.Method == http.MethodDelete {
 		var deleteReq ActorDeleteRequest
@@ -102,8 +113,8 @@ func registerActor(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		delete(knownActors, deleteReq.Name)
-		logger.With("name", deleteReq.Name).Info("Actor delted.")
+		delete(s.actors, deleteReq.Name)
+		s.logger.With("name", deleteReq.Name).Info("Actor delted.")
 		return
 	}
 
@@ -114,18 +125,18 @@ type serverRegistrationRequest struct {
 	Callback string `json:"callback"`
 }
 
-func setupPreconfiguredActor(name string) {
-	knownActorsMutex.Lock()
-	defer knownActorsMutex.Unlock()
+func (s *Server) setupPreconfiguredActor(name string) {
+	s.actorsMutex.Lock()
+	defer s.actorsMutex.Unlock()
 
-	if !viper.IsSet(fmt.Sprintf("actors.%s.callback", name)) {
-		logger.With("actor", name).Error("Preconfigured actor is missing callback.")
+	if !s.config.IsSet(fmt.Sprintf("actors.%s.callback", name)) {
+		s.logger.With("actor", name).Error("Preconfigured actor is missing callback.")
 		return
 	}
 
-	callback := viper.GetString(fmt.Sprintf("actors.%s.callback", name))
-	secret := viper.GetString(fmt.Sprintf("actors.%s.secret", name))
-	if !viper.IsSet(fmt.Sprintf("actors.%s.secret", name)) {
+	callback := s.config.GetString(fmt.Sprintf("actors.%s.callback", name))
+	secret := s.config.GetString(fmt.Sprintf("actors.%s.secret", name))
+	if !s.config.IsSet(fmt.Sprintf("actors.%s.secret", name)) {
 		secret = ""
 	}
 
@@ -135,22 +146,22 @@ func setupPreconfiguredActor(name string) {
 
 	actorURL := fmt.Sprintf("%sactor/%s/serverConnect", callback, name)
 	req := serverRegistrationRequest{
-		Callback: fmt.Sprintf("http://%s:%d/", viper.GetString("hostname"), viper.GetInt("port")),
+		Callback: s.callbackURL(),
 	}
 	reqJSON, err := json.Marshal(req)
 	if err != nil {
-		logger.With("actorName", name, "error", err).Error("Failed to marshal server side registration request.")
+		s.logger.With("actorName", name, "error", err).Error("Failed to marshal server side registration request.")
 		return
 	}
 
 	resp, err := http.Post(actorURL, "application/json", bytes.NewBuffer(reqJSON))
 	if err != nil {
-		logger.With("actorName", name, "error", err).Error("Failed to attach server to actor.")
+		s.logger.With("actorName", name, "error", err).Error("Failed to attach server to actor.")
 		return
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		logger.With("actorName", name, "statusCode", resp.StatusCode).Error("Failed to attach server to actor. Check actor logs.")
+		s.logger.With("actorName", name, "statusCode", resp.StatusCode).Error("Failed to attach server to actor. Check actor logs.")
 		return
 	}
 
@@ -158,107 +169,117 @@ func setupPreconfiguredActor(name string) {
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.With("actorName", name, "error", err).Error("Failed reading actor response on server side registration.")
+		s.logger.With("actorName", name, "error", err).Error("Failed reading actor response on server side registration.")
 		return
 	}
 
 	var result ActorRegisterRequest
 	if err := json.Unmarshal(body, &result); err != nil {
-		logger.With("actorName", name, "error", err).Error("Failed parsing actor response on server side registration.")
+		s.logger.With("actorName", name, "error", err).Error("Failed parsing actor response on server side registration.")
 		return
 	}
 
 	if result.Secret != secret {
-		logger.With("actorName", name).Error("Server side actor registration aborted. Invalid secret from actor.")
+		s.logger.With("actorName", name).Error("Server side actor registration aborted. Invalid secret from actor.")
 		return
 	}
 
-	knownActors[name] = ActorInfo(result)
-	logger.With("actorName", name).Info("Server side actor registered.")
+	s.actors[name] = ActorInfo(result)
+	s.breakers.reset("actor", name)
+	s.logger.With("actorName", name).Info("Server side actor registered.")
 }
 
 // ActorExecutionRequest sent by the test script.
 type ActorExecutionRequest struct {
+	ID          string         `json:"id,omitempty"`
 	SessionUUID string         `json:"session"`
 	ActorType   string         `json:"type"`
 	Action      string         `json:"action"`
 	Parameters  map[string]any `json:"parameters"`
+	Expect      []Expectation  `json:"expect,omitempty"`
 }
 
-type ActorExecutionResult struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-}
+type ActorExecutionResult = ExecutionResult
 
-func runActor(w http.ResponseWriter, r *http.Request) {
+func (s *Server) runActor(w http.ResponseWriter, r *http.Request) {
 	var testReq ActorExecutionRequest
 	if err := json.NewDecoder(r.Body).Decode(&testReq); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if len(testReq.SessionUUID) < 1 || testReq.SessionUUID == "" {
-		http.Error(w, "missing session id", http.StatusBadRequest)
-	}
+	s.logger.With("session", testReq.SessionUUID, "type", testReq.ActorType, "action", testReq.Action).Info("Actor execution request received.")
 
-	logger.With("session", testReq.SessionUUID, "type", testReq.ActorType, "action", testReq.Action).Info("Actor execution request received.")
+	sinfo, err := s.lookupExecutionSession(testReq.SessionUUID)
+	if err != nil {
+		writeExecutionError(w, err)
+		return
+	}
 
-	uuid, err := uuid.Parse(testReq.SessionUUID)
+	result, err := s.executeActorAction(sinfo, testReq)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("malformed session id: %s", err.Error()), http.StatusBadRequest)
+		writeExecutionError(w, err)
 		return
 	}
 
-	sinfo := session_register.getSession(uuid)
-	if sinfo == nil {
-		http.Error(w, "unknown session id", http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// executeActorAction forwards the request to an actor of the requested type,
+// records the outcome in the session context and evaluates the expectations
+// of the request.
+func (s *Server) executeActorAction(sinfo *SessionInfo, testReq ActorExecutionRequest) (result *ActorExecutionResult, err error) {
+	name := testReq.ActorType
+	execution := sinfo.Context.nextExecution()
+	defer func() {
+		if err != nil {
+			failAction(sinfo, execution, "actor", name, testReq.Action, err)
+		}
+		s.recordAction("actor", testReq.ActorType, testReq.Action, result, err)
+	}()
+
+	if !s.beginAction() {
+		return nil, errShuttingDown
 	}
+	defer s.endAction()
+	sinfo.beginActivity()
+	defer sinfo.endActivity()
 
-	actor := findActorByType(testReq.ActorType)
-	if actor == nil {
-		http.Error(w, "no supported actor", http.StatusBadGateway)
-		return
+	if err := validateExpectations(testReq.Expect); err != nil {
+		return nil, newCodedExecutionError(http.StatusBadRequest, ErrorCodeInvalidRequest, err.Error())
 	}
 
-	sinfo.Context.appendLog(fmt.Sprintf("system::actor::%s", actor.Name), fmt.Sprintf("Executing action '%s'.", testReq.Action))
+	actor := s.findActorByType(testReq.ActorType)
+	if actor == nil {
+		return nil, newCodedExecutionError(http.StatusBadGateway, ErrorCodeNoExtension, "no supported actor")
+	}
+	name = actor.Name
 
-	// Forward the request to the BookingServiceActor service.
+	// Forward the request to the actor service.
 	actorURL := fmt.Sprintf("%sactor/%s/execute", actor.Callback, actor.Name)
-	reqJSON, err := json.Marshal(testReq)
+	forwarded := testReq
+	forwarded.Expect = nil
+	forwarded.Parameters, err = s.resolveParameters(sinfo, testReq.Action, testReq.Parameters)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	resp, err := http.Post(actorURL, "application/json", bytes.NewBuffer(reqJSON))
+	reqJSON, err := json.Marshal(forwarded)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, newExecutionError(http.StatusInternalServerError, err.Error())
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	policy := s.retryPolicyFor("actors", testReq.ActorType, testReq.Action)
+	result, err = s.forwardExecution(sinfo, execution, "actor", actor.Name, actorURL, testReq.Action, forwarded.Parameters, reqJSON, policy)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	var result ActorExecutionResult
-	if err := json.Unmarshal(body, &result); err != nil {
-		http.Error(w, err.Error(), http.StatusFailedDependency)
-		return
-	}
-
-	if result.Success {
-		sinfo.Context.appendLog(fmt.Sprintf("system::actor::%s", actor.Name), "Actor action: SUCCESS")
-	} else {
-		sinfo.Context.appendLog(fmt.Sprintf("system::actor::%s", actor.Name), "Actor action: FAILED")
+		return nil, err
 	}
 
-	if len(result.Message) > 0 {
-		sinfo.Context.appendLog(fmt.Sprintf("message::actor::%s", actor.Name), result.Message)
+	completeAction(sinfo, execution, "actor", actor.Name, testReq.Action, testReq.Expect, result)
+	if testReq.ID != "" {
+		sinfo.Context.setStepResult(testReq.ID, result)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	return result, nil
 }
@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"bytes"
@@ -11,16 +11,10 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
-	"github.com/spf13/viper"
-	"go.uber.org/zap"
 )
 
-func init() {
-	// Create a no-op logger so that logger calls don't panic.
-	logger = zap.NewNop().Sugar()
-}
-
 func TestRegisterActor(t *testing.T) {
+	s := newTestServer(t)
 	reqBody := ActorRegisterRequest{
 		Name:     "testActor",
 		Type:     "testType",
@@ -33,7 +27,7 @@ func TestRegisterActor(t *testing.T) {
 	r.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	registerActor(w, r)
+	s.registerActor(w, r)
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
@@ -42,7 +36,8 @@ func TestRegisterActor(t *testing.T) {
 }
 
 func TestDeleteActor(t *testing.T) {
-	knownActors["testActor"] = ActorInfo{Name: "testActor", Type: "testType", Callback: "http://localhost:8082/", Secret: "secret123"}
+	s := newTestServer(t)
+	s.actors["testActor"] = ActorInfo{Name: "testActor", Type: "testType", Callback: "http://localhost:8082/", Secret: "secret123"}
 
 	reqBody := ActorDeleteRequest{Name: "testActor"}
 	jsonData, _ := json.Marshal(reqBody)
@@ -51,19 +46,20 @@ func TestDeleteActor(t *testing.T) {
 	r.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	registerActor(w, r)
+	s.registerActor(w, r)
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
 		t.Errorf("Expected status OK, got %v", resp.StatusCode)
 	}
 
-	if _, exists := knownActors["testActor"]; exists {
+	if _, exists := s.actors["testActor"]; exists {
 		t.Errorf("Actor was not deleted")
 	}
 }
 
 func TestRunActorInvalidSession(t *testing.T) {
+	s := newTestServer(t)
 	reqBody := ActorExecutionRequest{
 		SessionUUID: "invalid-session",
 		ActorType:   "testType",
@@ -76,7 +72,7 @@ func TestRunActorInvalidSession(t *testing.T) {
 	r.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	runActor(w, r)
+	s.runActor(w, r)
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadRequest {
@@ -88,9 +84,10 @@ func TestRunActorInvalidSession(t *testing.T) {
 
 // Test that using an invalid HTTP method on /register returns an error.
 func TestRegisterActorInvalidMethod(t *testing.T) {
+	s := newTestServer(t)
 	req := httptest.NewRequest(http.MethodGet, "/register", nil)
 	w := httptest.NewRecorder()
-	registerActor(w, req)
+	s.registerActor(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadRequest {
 		t.Errorf("Expected status %d for invalid method, got %d", http.StatusBadRequest, resp.StatusCode)
@@ -99,10 +96,11 @@ func TestRegisterActorInvalidMethod(t *testing.T) {
 
 // Test malformed JSON for POST registration.
 func TestRegisterActorMalformedJSON(t *testing.T) {
+	s := newTestServer(t)
 	malformed := strings.NewReader("{not json}")
 	req := httptest.NewRequest(http.MethodPost, "/register", malformed)
 	w := httptest.NewRecorder()
-	registerActor(w, req)
+	s.registerActor(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadRequest {
 		t.Errorf("Expected status %d for malformed JSON, got %d", http.StatusBadRequest, resp.StatusCode)
@@ -111,10 +109,11 @@ func TestRegisterActorMalformedJSON(t *testing.T) {
 
 // Test malformed JSON for DELETE actor.
 func TestDeleteActorMalformedJSON(t *testing.T) {
+	s := newTestServer(t)
 	malformed := strings.NewReader("{not json}")
 	req := httptest.NewRequest(http.MethodDelete, "/register", malformed)
 	w := httptest.NewRecorder()
-	registerActor(w, req)
+	s.registerActor(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadRequest {
 		t.Errorf("Expected status %d for malformed JSON in delete, got %d", http.StatusBadRequest, resp.StatusCode)
@@ -123,10 +122,11 @@ func TestDeleteActorMalformedJSON(t *testing.T) {
 
 // Test that a missing callback in POST registration assigns a default callback.
 func TestRegisterActorDefaultCallback(t *testing.T) {
+	s := newTestServer(t)
 	// Clear any previous actor
-	knownActorsMutex.Lock()
-	delete(knownActors, "defaultCallbackActor")
-	knownActorsMutex.Unlock()
+	s.actorsMutex.Lock()
+	delete(s.actors, "defaultCallbackActor")
+	s.actorsMutex.Unlock()
 
 	// Create request with empty callback field.
 	reqBody := ActorRegisterRequest{
@@ -142,11 +142,11 @@ func TestRegisterActorDefaultCallback(t *testing.T) {
 	req.RemoteAddr = "127.0.0.1:12345"
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
-	registerActor(w, req)
+	s.registerActor(w, req)
 
-	knownActorsMutex.Lock()
-	actor, exists := knownActors["defaultCallbackActor"]
-	knownActorsMutex.Unlock()
+	s.actorsMutex.Lock()
+	actor, exists := s.actors["defaultCallbackActor"]
+	s.actorsMutex.Unlock()
 	if !exists {
 		t.Fatalf("Actor not found after registration")
 	}
@@ -159,39 +159,40 @@ func TestRegisterActorDefaultCallback(t *testing.T) {
 
 // Test findActorByType when multiple actors exist.
 func TestFindActorByType(t *testing.T) {
-	// Reset knownActors
-	knownActorsMutex.Lock()
-	knownActors = make(map[string]ActorInfo)
-	knownActorsMutex.Unlock()
+	s := newTestServer(t)
+	// Reset the actors
+	s.actorsMutex.Lock()
+	s.actors = make(map[string]ActorInfo)
+	s.actorsMutex.Unlock()
 
 	actor1 := ActorInfo{Name: "actor1", Type: "alpha", Callback: "http://localhost/alpha/", Secret: "s1"}
 	actor2 := ActorInfo{Name: "actor2", Type: "beta", Callback: "http://localhost/beta/", Secret: "s2"}
-	knownActorsMutex.Lock()
-	knownActors["actor1"] = actor1
-	knownActors["actor2"] = actor2
-	knownActorsMutex.Unlock()
+	s.actorsMutex.Lock()
+	s.actors["actor1"] = actor1
+	s.actors["actor2"] = actor2
+	s.actorsMutex.Unlock()
 
-	if d := findActorByType("alpha"); d == nil || d.Name != "actor1" {
+	if d := s.findActorByType("alpha"); d == nil || d.Name != "actor1" {
 		t.Errorf("Expected to find actor1 for type alpha")
 	}
-	if d := findActorByType("beta"); d == nil || d.Name != "actor2" {
+	if d := s.findActorByType("beta"); d == nil || d.Name != "actor2" {
 		t.Errorf("Expected to find actor2 for type beta")
 	}
-	if d := findActorByType("gamma"); d != nil {
+	if d := s.findActorByType("gamma"); d != nil {
 		t.Errorf("Expected nil for unknown actor type")
 	}
 }
 
 // Test setupPreconfiguredActor when configuration is missing.
 func TestSetupPreconfiguredActorMissingConfig(t *testing.T) {
+	s := newTestServer(t)
 	// Ensure viper does not have the config for this actor.
-	viper.Reset()
 	actorName := "missingActor"
-	setupPreconfiguredActor(actorName)
+	s.setupPreconfiguredActor(actorName)
 	// Here we expect that no actor is added since callback config is missing.
-	knownActorsMutex.Lock()
-	_, exists := knownActors[actorName]
-	knownActorsMutex.Unlock()
+	s.actorsMutex.Lock()
+	_, exists := s.actors[actorName]
+	s.actorsMutex.Unlock()
 	if exists {
 		t.Errorf("Actor should not be registered when callback is missing in configuration")
 	}
@@ -200,14 +201,14 @@ func TestSetupPreconfiguredActorMissingConfig(t *testing.T) {
 // Test setupPreconfiguredActor with a successful HTTP registration.
 // This test uses an HTTP test server to simulate the actor's callback endpoint.
 func TestSetupPreconfiguredActorSuccess(t *testing.T) {
+	s := newTestServer(t)
 	// Prepare viper configuration for the actor.
 	actorName := "testActor"
 	expectedSecret := "secretXYZ"
-	viper.Reset()
-	viper.Set(fmt.Sprintf("actors.%s.callback", actorName), "") // We'll override callback below.
-	viper.Set(fmt.Sprintf("actors.%s.secret", actorName), expectedSecret)
-	viper.Set("hostname", "127.0.0.1")
-	viper.Set("port", 9090)
+	s.config.Set(fmt.Sprintf("actors.%s.callback", actorName), "") // We'll override callback below.
+	s.config.Set(fmt.Sprintf("actors.%s.secret", actorName), expectedSecret)
+	s.config.Set("hostname", "127.0.0.1")
+	s.config.Set("port", 9090)
 
 	var tsURL string
 	// Create a test HTTP server to simulate actor's serverConnect endpoint.
@@ -234,13 +235,13 @@ func TestSetupPreconfiguredActorSuccess(t *testing.T) {
 	tsURL = ts.URL
 
 	// Set the callback in viper to point to our test server.
-	viper.Set(fmt.Sprintf("actors.%s.callback", actorName), tsURL)
+	s.config.Set(fmt.Sprintf("actors.%s.callback", actorName), tsURL)
 	// Call setupPreconfiguredActor.
-	setupPreconfiguredActor(actorName)
+	s.setupPreconfiguredActor(actorName)
 	// Verify that the actor was registered.
-	knownActorsMutex.Lock()
-	actor, exists := knownActors[actorName]
-	knownActorsMutex.Unlock()
+	s.actorsMutex.Lock()
+	actor, exists := s.actors[actorName]
+	s.actorsMutex.Unlock()
 	if !exists {
 		t.Fatalf("Expected actor %s to be registered", actorName)
 	}
@@ -251,6 +252,7 @@ func TestSetupPreconfiguredActorSuccess(t *testing.T) {
 
 // Test runActor with missing session id.
 func TestRunActorMissingSession(t *testing.T) {
+	s := newTestServer(t)
 	reqBody := ActorExecutionRequest{
 		SessionUUID: "",
 		ActorType:   "testType",
@@ -261,7 +263,7 @@ func TestRunActorMissingSession(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/run", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
-	runActor(w, req)
+	s.runActor(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadRequest {
 		t.Errorf("Expected status %d for missing session id, got %d", http.StatusBadRequest, resp.StatusCode)
@@ -270,6 +272,7 @@ func TestRunActorMissingSession(t *testing.T) {
 
 // Test runActor with a malformed session id.
 func TestRunActorMalformedSession(t *testing.T) {
+	s := newTestServer(t)
 	reqBody := ActorExecutionRequest{
 		SessionUUID: "bad-uuid",
 		ActorType:   "testType",
@@ -280,7 +283,7 @@ func TestRunActorMalformedSession(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/run", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
-	runActor(w, req)
+	s.runActor(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadRequest {
 		t.Errorf("Expected status %d for malformed session id, got %d", http.StatusBadRequest, resp.StatusCode)
@@ -289,6 +292,7 @@ func TestRunActorMalformedSession(t *testing.T) {
 
 // Test runActor with an unknown session id.
 func TestRunActorUnknownSession(t *testing.T) {
+	s := newTestServer(t)
 	// Create a valid UUID that is not in our session register.
 	validUUID := uuid.New()
 	reqBody := ActorExecutionRequest{
@@ -301,7 +305,7 @@ func TestRunActorUnknownSession(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/run", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
-	runActor(w, req)
+	s.runActor(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadRequest {
 		t.Errorf("Expected status %d for unknown session id, got %d", http.StatusBadRequest, resp.StatusCode)
@@ -310,15 +314,18 @@ func TestRunActorUnknownSession(t *testing.T) {
 
 // Test runActor when no supported actor is found.
 func TestRunActorNoSupportedActor(t *testing.T) {
+	s := newTestServer(t)
 	// Add a valid session.
 	sid := uuid.New()
 	sinfo := SessionInfo{
-		UUID: sid,
+		UUID:   sid,
+		server: s,
 		Context: SessionContext{
 			Log: []SessionLogMessage{},
 		},
 	}
-	session_register.addSession(&sinfo)
+	sinfo.Context.sessionInfo = &sinfo
+	s.sessions.addSession(&sinfo)
 	reqBody := ActorExecutionRequest{
 		SessionUUID: sid.String(),
 		ActorType:   "nonexistentType",
@@ -329,7 +336,7 @@ func TestRunActorNoSupportedActor(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/run", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
-	runActor(w, req)
+	s.runActor(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadGateway {
 		t.Errorf("Expected status %d when no supported actor is found, got %d", http.StatusBadGateway, resp.StatusCode)
@@ -337,18 +344,21 @@ func TestRunActorNoSupportedActor(t *testing.T) {
 }
 
 // Test runActor with a successful actor execution.
-// This sets up a dummy actor in knownActors and uses an HTTP test server to simulate the actor endpoint.
+// This sets up a dummy actor in the server and uses an HTTP test server to simulate the actor endpoint.
 func TestRunActorSuccess(t *testing.T) {
+	s := newTestServer(t)
 	// Setup a dummy session.
 	sid := uuid.New()
 	sinfo := SessionInfo{
-		UUID: sid,
+		UUID:   sid,
+		server: s,
 		Context: SessionContext{
 			Log: []SessionLogMessage{},
 		},
 	}
-	session_register.addSession(&sinfo)
-	// Setup a dummy actor in knownActors.
+	sinfo.Context.sessionInfo = &sinfo
+	s.sessions.addSession(&sinfo)
+	// Setup a dummy actor in the server.
 	actorName := "dummyActor"
 	successResponse := ActorExecutionResult{Success: true, Message: "All good"}
 	// Create test server to simulate actor's /execute endpoint.
@@ -359,14 +369,14 @@ func TestRunActorSuccess(t *testing.T) {
 	defer ts.Close()
 
 	// Register the dummy actor.
-	knownActorsMutex.Lock()
-	knownActors[actorName] = ActorInfo{
+	s.actorsMutex.Lock()
+	s.actors[actorName] = ActorInfo{
 		Name:     actorName,
 		Type:     "dummyType",
 		Callback: ts.URL + "/", // ensure trailing slash\n",
 		Secret:   "dummySecret",
 	}
-	knownActorsMutex.Unlock()
+	s.actorsMutex.Unlock()
 
 	reqBody := ActorExecutionRequest{
 		SessionUUID: sid.String(),
@@ -378,7 +388,7 @@ func TestRunActorSuccess(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/run", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
-	runActor(w, req)
+	s.runActor(w, req)
 	resp := w.Result()
 	body, _ := io.ReadAll(resp.Body)
 	var result ActorExecutionResult
@@ -396,17 +406,20 @@ func TestRunActorSuccess(t *testing.T) {
 
 // Test runActor with a failed actor execution.
 func TestRunActorFailure(t *testing.T) {
+	s := newTestServer(t)
 	// Setup a dummy session.
 	sid := uuid.New()
 	sinfo := SessionInfo{
-		UUID: sid,
+		UUID:   sid,
+		server: s,
 		Context: SessionContext{
 			Log: []SessionLogMessage{},
 		},
 	}
-	session_register.addSession(&sinfo)
+	sinfo.Context.sessionInfo = &sinfo
+	s.sessions.addSession(&sinfo)
 
-	// Setup a dummy actor in knownActors.
+	// Setup a dummy actor in the server.
 	actorName := "failingActor"
 	failureResponse := ActorExecutionResult{Success: false, Message: "Something went wrong"}
 	// Create test server to simulate actor's /execute endpoint.
@@ -417,14 +430,14 @@ func TestRunActorFailure(t *testing.T) {
 	defer ts.Close()
 
 	// Register the dummy actor.
-	knownActorsMutex.Lock()
-	knownActors[actorName] = ActorInfo{
+	s.actorsMutex.Lock()
+	s.actors[actorName] = ActorInfo{
 		Name:     actorName,
 		Type:     "failingType",
 		Callback: ts.URL + "/",
 		Secret:   "dummySecret",
 	}
-	knownActorsMutex.Unlock()
+	s.actorsMutex.Unlock()
 
 	reqBody := ActorExecutionRequest{
 		SessionUUID: sid.String(),
@@ -436,7 +449,7 @@ func TestRunActorFailure(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/run", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
-	runActor(w, req)
+	s.runActor(w, req)
 	resp := w.Result()
 	body, _ := io.ReadAll(resp.Body)
 	var result ActorExecutionResult
@@ -450,3 +463,83 @@ func TestRunActorFailure(t *testing.T) {
 		t.Errorf("Expected message %q, got %q", failureResponse.Message, result.Message)
 	}
 }
+
+// Test that structured result data is returned to the client and stored in the session log.
+func TestRunActorResultData(t *testing.T) {
+	s := newTestServer(t)
+	sid := uuid.New()
+	sinfo := SessionInfo{
+		UUID:   sid,
+		server: s,
+		Context: SessionContext{
+			Log: []SessionLogMessage{},
+		},
+	}
+	sinfo.Context.sessionInfo = &sinfo
+	s.sessions.addSession(&sinfo)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success": true, "message": "order created", "data": {"orderId": "A-42", "items": 3}}`))
+	}))
+	defer ts.Close()
+
+	s.actorsMutex.Lock()
+	s.actors["dataActor"] = ActorInfo{Name: "dataActor", Type: "dataType", Callback: ts.URL + "/"}
+	s.actorsMutex.Unlock()
+
+	reqBody := ActorExecutionRequest{
+		SessionUUID: sid.String(),
+		ActorType:   "dataType",
+		Action:      "createOrder",
+	}
+	jsonData, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest(http.MethodPost, "/run", bytes.NewBuffer(jsonData))
+	w := httptest.NewRecorder()
+	s.runActor(w, req)
+
+	var result ActorExecutionResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to parse response JSON: %v", err)
+	}
+	data, ok := result.Data.(map[string]any)
+	if !ok || data["orderId"] != "A-42" {
+		t.Errorf("Expected result data to contain orderId, got %v", result.Data)
+	}
+
+	var logged *ActionResultData
+	for _, msg := range sinfo.Context.Log {
+		if d, ok := msg.Data.(*ActionResultData); ok {
+			logged = d
+		}
+	}
+	if logged == nil {
+		t.Fatalf("Expected structured result entry in session log")
+	}
+	if logged.Action != "createOrder" || !logged.Success {
+		t.Errorf("Unexpected structured log entry: %+v", logged)
+	}
+}
+
+// Test that failed actions without an error code get the generic one.
+func TestRunActorFailureErrorCode(t *testing.T) {
+	s := newTestServer(t)
+	sinfo := newTestSession(s)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": false, "message": "nope"}`))
+	}))
+	defer ts.Close()
+
+	s.actorsMutex.Lock()
+	s.actors["codeActor"] = ActorInfo{Name: "codeActor", Type: "codeType", Callback: ts.URL + "/"}
+	s.actorsMutex.Unlock()
+
+	result, err := s.executeActorAction(sinfo, ActorExecutionRequest{SessionUUID: sinfo.UUID.String(), ActorType: "codeType", Action: "x"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.ErrorCode != ErrorCodeActionFailed {
+		t.Errorf("Expected error code %s, got %s", ErrorCodeActionFailed, result.ErrorCode)
+	}
+}
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const allureStageFinished = "finished"
+
+// allureReporter writes the Allure results format so that `allure generate`
+// can build a report of the sessions:
+//
+//	reporter:
+//	  allure:
+//	    type: allure
+//	    directory: allure-results
+//
+// Every session is a test result with its actions as steps and the artifacts
+// of the actions as attachments. Suites are written as containers.
+type allureReporter struct {
+	server    *Server
+	directory string
+}
+
+type allureResult struct {
+	UUID          string               `json:"uuid"`
+	HistoryID     string               `json:"historyId"`
+	TestCaseID    string               `json:"testCaseId"`
+	Name          string               `json:"name"`
+	FullName      string               `json:"fullName"`
+	Status        string               `json:"status"`
+	StatusDetails *allureStatusDetails `json:"statusDetails,omitempty"`
+	Stage         string               `json:"stage"`
+	Start         int64                `json:"start"`
+	Stop          int64                `json:"stop"`
+	Labels        []allureLabel        `json:"labels"`
+	Parameters    []allureParameter    `json:"parameters,omitempty"`
+	Steps         []*allureStep        `json:"steps,omitempty"`
+	Attachments   []allureAttachment   `json:"attachments,omitempty"`
+}
+
+type allureStep struct {
+	Name          string               `json:"name"`
+	Status        string               `json:"status"`
+	StatusDetails *allureStatusDetails `json:"statusDetails,omitempty"`
+	Stage         string               `json:"stage"`
+	Start         int64                `json:"start"`
+	Stop          int64                `json:"stop"`
+	Parameters    []allureParameter    `json:"parameters,omitempty"`
+	Steps         []*allureStep        `json:"steps,omitempty"`
+	Attachments   []allureAttachment   `json:"attachments,omitempty"`
+}
+
+type allureContainer struct {
+	UUID     string   `json:"uuid"`
+	Name     string   `json:"name"`
+	Children []string `json:"children"`
+	Befores  []any    `json:"befores"`
+	Afters   []any    `json:"afters"`
+	Start    int64    `json:"start"`
+	Stop     int64    `json:"stop"`
+}
+
+type allureStatusDetails struct {
+	Message string `json:"message,omitempty"`
+	Trace   string `json:"trace,omitempty"`
+}
+
+type allureLabel struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type allureParameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type allureAttachment struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+}
+
+func newAllureReporter(s *Server, name string) (builtinReporter, error) {
+	directory := s.config.GetString(fmt.Sprintf("reporter.%s.directory", name))
+	if directory == "" {
+		return nil, errors.New("missing directory")
+	}
+	return &allureReporter{server: s, directory: directory}, nil
+}
+
+func (r *allureReporter) reportSession(session *SessionInfo) error {
+	if err := os.MkdirAll(r.directory, 0o755); err != nil {
+		return err
+	}
+
+	report := newSessionReport(session)
+	result := &allureResult{
+		UUID:       session.UUID.String(),
+		Name:       report.Name(),
+		Status:     allureStatus(report),
+		Stage:      allureStageFinished,
+		Start:      allureMillis(report.Start),
+		Stop:       allureMillis(report.Stop),
+		Labels:     r.labels(report),
+		Parameters: allureParameters(session.Parameters),
+	}
+
+	// The combinations of a suite are the same test with different parameters.
+	if suite := sessionSuite(session); suite != nil {
+		result.Name = suite.Name
+	}
+	result.FullName = result.Name
+	result.TestCaseID = allureHash(result.FullName)
+	result.HistoryID = allureHash(result.FullName, valueString(session.Parameters))
+
+	if report.Failed() && len(report.Failures) > 0 {
+		result.StatusDetails = &allureStatusDetails{
+			Message: strings.SplitN(report.Failures[0], "\n", 2)[0],
+			Trace:   strings.Join(report.Failures, "\n"),
+		}
+	}
+
+	result.Steps = r.steps(report)
+	log, err := r.attach("log", "text/plain", []byte(junitSystemOut(report)))
+	if err != nil {
+		return err
+	}
+	result.Attachments = append(result.Attachments, log)
+
+	return r.writeJSON(fmt.Sprintf("%s-result.json", result.UUID), result)
+}
+
+func (r *allureReporter) reportSuite(info *SuiteInfo, sessions []*SessionInfo) error {
+	container := allureContainer{
+		UUID:     info.ID.String(),
+		Name:     info.Name,
+		Children: make([]string, 0, len(sessions)),
+		Befores:  []any{},
+		Afters:   []any{},
+		Start:    allureMillis(info.StartedAt),
+	}
+	for _, session := range sessions {
+		container.Children = append(container.Children, session.UUID.String())
+	}
+	if info.FinishedAt != nil {
+		container.Stop = allureMillis(*info.FinishedAt)
+	}
+
+	if err := os.MkdirAll(r.directory, 0o755); err != nil {
+		return err
+	}
+	return r.writeJSON(fmt.Sprintf("%s-container.json", container.UUID), container)
+}
+
+func (r *allureReporter) labels(report *sessionReport) []allureLabel {
+	labels := []allureLabel{{Name: "framework", Value: "babylon"}}
+	if host, err := os.Hostname(); err == nil {
+		labels = append(labels, allureLabel{Name: "host", Value: host})
+	}
+
+	suite := "babylon"
+	if s := sessionSuite(report.Session); s != nil {
+		suite = s.Name
+	}
+	if feature := allureFeature(report); feature != "" {
+		labels = append(labels, allureLabel{Name: "feature", Value: feature})
+		suite = feature
+	}
+	labels = append(labels, allureLabel{Name: "suite", Value: suite})
+
+	for _, tag := range report.Session.Tags {
+		labels = append(labels, allureLabel{Name: "tag", Value: strings.TrimPrefix(tag, "@")})
+	}
+	return labels
+}
+
+// steps converts the actions of the session. Actions of Gherkin sessions are
+// nested into the Gherkin step that executed them.
+func (r *allureReporter) steps(report *sessionReport) []*allureStep {
+	var steps []*allureStep
+	for _, gs := range report.GherkinSteps {
+		step := &allureStep{
+			Name:   gs.Name,
+			Status: gs.Status,
+			Stage:  allureStageFinished,
+			Start:  allureMillis(gs.Start),
+			Stop:   allureMillis(gs.Stop),
+		}
+		if gs.Message != "" {
+			step.StatusDetails = &allureStatusDetails{Message: gs.Message}
+		}
+		for _, rs := range gs.Steps {
+			step.Steps = append(step.Steps, r.step(rs))
+		}
+		steps = append(steps, step)
+	}
+
+	for _, rs := range report.UnlinkedSteps() {
+		steps = append(steps, r.step(rs))
+	}
+	return steps
+}
+
+func (r *allureReporter) step(rs *reportStep) *allureStep {
+	step := &allureStep{
+		Name:       rs.Title(),
+		Status:     rs.Status,
+		Stage:      allureStageFinished,
+		Start:      allureMillis(rs.Start),
+		Stop:       allureMillis(rs.Stop),
+		Parameters: allureParameters(rs.Parameters),
+	}
+	if rs.Status != reportStepPassed && rs.Message != "" {
+		step.StatusDetails = &allureStatusDetails{Message: rs.Message}
+	}
+
+	for _, ar := range rs.Assertions {
+		status := reportStepPassed
+		if !ar.Passed {
+			status = reportStepFailed
+		}
+		step.Steps = append(step.Steps, &allureStep{
+			Name:   ar.describe(),
+			Status: status,
+			Stage:  allureStageFinished,
+			Start:  step.Stop,
+			Stop:   step.Stop,
+		})
+	}
+
+	for _, artifact := range rs.Artifacts {
+		content, err := base64.StdEncoding.DecodeString(artifact.Content)
+		if err != nil {
+			r.server.logger.With("artifact", artifact.Name, "error", err).Warn("Skipped artifact with invalid content.")
+			continue
+		}
+		att, err := r.attach(artifact.Name, artifact.ContentType, content)
+		if err != nil {
+			r.server.logger.With("artifact", artifact.Name, "error", err).Error("Failed to write attachment.")
+			continue
+		}
+		step.Attachments = append(step.Attachments, att)
+	}
+	return step
+}
+
+// attach writes the content as attachment file.
+func (r *allureReporter) attach(name, contentType string, content []byte) (allureAttachment, error) {
+	ext := filepath.Ext(name)
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	att := allureAttachment{
+		Name:   name,
+		Source: fmt.Sprintf("%s-attachment%s", uuid.New(), ext),
+		Type:   contentType,
+	}
+	return att, os.WriteFile(filepath.Join(r.directory, att.Source), content, 0o644)
+}
+
+func (r *allureReporter) writeJSON(file string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.directory, file), data, 0o644)
+}
+
+func allureStatus(report *sessionReport) string {
+	switch {
+	case !report.Failed():
+		return reportStepPassed
+	case report.Broken():
+		return reportStepBroken
+	default:
+		return reportStepFailed
+	}
+}
+
+// allureFeature returns the name of the Gherkin feature the session ran.
+func allureFeature(report *sessionReport) string {
+	for _, msg := range report.Log {
+		if msg.MessageType != "system::gherkin::scenario" {
+			continue
+		}
+		if data, ok := msg.Data.(map[string]any); ok {
+			feature, _ := data["feature"].(string)
+			return feature
+		}
+	}
+	return ""
+}
+
+func allureParameters(params map[string]any) []allureParameter {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]allureParameter, 0, len(names))
+	for _, name := range names {
+		out = append(out, allureParameter{Name: name, Value: valueString(params[name])})
+	}
+	return out
+}
+
+func allureHash(parts ...string) string {
+	sum := md5.Sum([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func allureMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
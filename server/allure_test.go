@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func newTestAllureReporter(t *testing.T, s *Server) (*allureReporter, string) {
+	dir := filepath.Join(t.TempDir(), "allure-results")
+
+	s.config.Set("reporter.allure.directory", dir)
+
+	r, err := newAllureReporter(s, "allure")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return r.(*allureReporter), dir
+}
+
+func readAllureFile(t *testing.T, path string, v any) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read result: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+}
+
+func allureLabelValues(result allureResult, name string) []string {
+	var values []string
+	for _, l := range result.Labels {
+		if l.Name == name {
+			values = append(values, l.Value)
+		}
+	}
+	return values
+}
+
+func TestNewAllureReporterErrors(t *testing.T) {
+	s := newTestServer(t)
+	if _, err := newAllureReporter(s, "allure"); err == nil {
+		t.Errorf("Expected error for missing directory")
+	}
+}
+
+func TestAllureReporterSession(t *testing.T) {
+	s := newTestServer(t)
+	r, dir := newTestAllureReporter(t, s)
+	sinfo := runReportTestScenario(t, s, reportTestScenario)
+	sinfo.Tags = []string{"@smoke", "shop"}
+
+	if err := r.reportSession(sinfo); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var result allureResult
+	readAllureFile(t, filepath.Join(dir, sinfo.UUID.String()+"-result.json"), &result)
+
+	if result.Name != "Report" || result.Status != reportStepFailed || result.Stage != allureStageFinished {
+		t.Errorf("Unexpected result header %+v", result)
+	}
+	if result.HistoryID == "" || result.TestCaseID == "" || result.Start == 0 || result.Stop < result.Start {
+		t.Errorf("Expected history, test case id and timing, got %+v", result)
+	}
+	if result.StatusDetails == nil || !strings.Contains(result.StatusDetails.Trace, "unknownDriver") {
+		t.Errorf("Expected failures in status details, got %+v", result.StatusDetails)
+	}
+	if tags := allureLabelValues(result, "tag"); len(tags) != 2 || tags[0] != "smoke" || tags[1] != "shop" {
+		t.Errorf("Expected tag labels, got %v", tags)
+	}
+	if suite := allureLabelValues(result, "suite"); len(suite) != 1 || suite[0] != "babylon" {
+		t.Errorf("Expected default suite label, got %v", suite)
+	}
+
+	if len(result.Steps) != 4 {
+		t.Fatalf("Expected 4 steps, got %d", len(result.Steps))
+	}
+	open := result.Steps[0]
+	if open.Name != "driver scenarioDriver: open" || open.Status != reportStepPassed {
+		t.Errorf("Unexpected first step %+v", open)
+	}
+	for _, p := range open.Parameters {
+		if p.Name == "password" && p.Value != redactedValue {
+			t.Errorf("Expected redacted password parameter, got %s", p.Value)
+		}
+	}
+	if check := result.Steps[1]; check.Status != reportStepFailed || len(check.Steps) != 1 || check.Steps[0].Status != reportStepFailed {
+		t.Errorf("Expected failed assertion sub step, got %+v", check)
+	}
+	if unknown := result.Steps[3]; unknown.Status != reportStepBroken {
+		t.Errorf("Expected broken step, got %+v", unknown)
+	}
+
+	if len(result.Attachments) != 1 {
+		t.Fatalf("Expected log attachment, got %+v", result.Attachments)
+	}
+	if _, err := os.Stat(filepath.Join(dir, result.Attachments[0].Source)); err != nil {
+		t.Errorf("Expected attachment file: %v", err)
+	}
+}
+
+func TestAllureReporterArtifacts(t *testing.T) {
+	s := newTestServer(t)
+	r, dir := newTestAllureReporter(t, s)
+	newTestDriver(t, s, "artifactDriver", &testDriver{respond: respondWithArtifacts})
+	sinfo := runReportTestScenario(t, s, htmlArtifactScenario)
+
+	if err := r.reportSession(sinfo); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var result allureResult
+	readAllureFile(t, filepath.Join(dir, sinfo.UUID.String()+"-result.json"), &result)
+	if result.Status != reportStepPassed || len(result.Steps) != 1 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	attachments := result.Steps[0].Attachments
+	if len(attachments) != 2 || attachments[0].Type != "image/png" || !strings.HasSuffix(attachments[0].Source, "-attachment.png") {
+		t.Fatalf("Expected screenshot attachment, got %+v", attachments)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, attachments[0].Source))
+	if err != nil || string(data) != "\x89PNG fake image" {
+		t.Errorf("Expected decoded screenshot, got %q (%v)", data, err)
+	}
+}
+
+func TestAllureReporterSuite(t *testing.T) {
+	s := newTestServer(t)
+	r, dir := newTestAllureReporter(t, s)
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	sc, err := parseScenario([]byte(`
+name: Allure suite
+matrix:
+  parameters:
+    product: [book, pen]
+steps:
+  - driver: scenarioDriver
+    action: order
+    parameters:
+      product: ${vars.product}
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result := s.runScenario(sc)
+
+	var sessions []*SessionInfo
+	histories := map[string]bool{}
+	for _, c := range result.Combinations {
+		sinfo := s.sessions.getFinishedSession(uuid.MustParse(c.Session))
+		if err := r.reportSession(sinfo); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sessions = append(sessions, sinfo)
+
+		var res allureResult
+		readAllureFile(t, filepath.Join(dir, c.Session+"-result.json"), &res)
+		if res.Name != "Allure suite" || len(res.Parameters) != 1 || res.Parameters[0].Name != "product" {
+			t.Errorf("Expected suite test with parameters, got %+v", res)
+		}
+		histories[res.HistoryID] = true
+	}
+	if len(histories) != 2 {
+		t.Errorf("Expected a history id per combination, got %v", histories)
+	}
+
+	if err := r.reportSuite(s.suites.get(uuid.MustParse(result.Suite)), sessions); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var container allureContainer
+	readAllureFile(t, filepath.Join(dir, result.Suite+"-container.json"), &container)
+	if container.Name != "Allure suite" || len(container.Children) != 2 || container.Children[0] != sessions[0].UUID.String() {
+		t.Errorf("Unexpected container %+v", container)
+	}
+}
+
+func TestAllureReporterGherkin(t *testing.T) {
+	s := newTestServer(t)
+	r, dir := newTestAllureReporter(t, s)
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	f, err := parseFeature("Feature: Shop\n  Scenario: Browse\n    Given I open the shop\n    And I fly away\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bindings, err := parseStepBindings([]byte(testBindings))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result := s.runFeature(f, bindings)
+
+	session := result.Scenarios[0].Session
+	if err := r.reportSession(s.sessions.getFinishedSession(uuid.MustParse(session))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var res allureResult
+	readAllureFile(t, filepath.Join(dir, session+"-result.json"), &res)
+	if feature := allureLabelValues(res, "feature"); len(feature) != 1 || feature[0] != "Shop" {
+		t.Errorf("Expected feature label, got %v", feature)
+	}
+	if len(res.Steps) != 2 {
+		t.Fatalf("Expected 2 gherkin steps, got %+v", res.Steps)
+	}
+	if open := res.Steps[0]; open.Name != "Given I open the shop" || open.Status != reportStepPassed || len(open.Steps) != 1 {
+		t.Errorf("Expected action nested into gherkin step, got %+v", open)
+	}
+	if undefined := res.Steps[1]; undefined.Status != reportStepBroken || undefined.StatusDetails == nil {
+		t.Errorf("Expected broken undefined step, got %+v", undefined)
+	}
+}
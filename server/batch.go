@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	batchModeSequential = "sequential"
+	batchModeParallel   = "parallel"
+
+	defaultBatchParallelism = 8
+)
+
+const (
+	batchStatusSuccess = "success"
+	batchStatusFailed  = "failed"
+	batchStatusError   = "error"
+	batchStatusSkipped = "skipped"
+)
+
+// BatchAction is a single actor or driver action within a batch.
+type BatchAction struct {
+	ID         string         `json:"id,omitempty"`
+	Kind       string         `json:"kind"`
+	Type       string         `json:"type"`
+	Action     string         `json:"action"`
+	Parameters map[string]any `json:"parameters"`
+	Expect     []Expectation  `json:"expect,omitempty"`
+}
+
+// BatchExecutionRequest sent by the test script to run several actions in one request.
+type BatchExecutionRequest struct {
+	Mode          string        `json:"mode"`
+	StopOnFailure bool          `json:"stopOnFailure"`
+	Actions       []BatchAction `json:"actions"`
+}
+
+type BatchActionResult struct {
+	ID        string    `json:"id,omitempty"`
+	Kind      string    `json:"kind"`
+	Type      string    `json:"type"`
+	Action    string    `json:"action"`
+	Status    string    `json:"status"`
+	Success   bool      `json:"success"`
+	Message   string    `json:"message"`
+	Data      any       `json:"data,omitempty"`
+	ErrorCode ErrorCode `json:"errorCode,omitempty"`
+}
+
+type BatchExecutionResult struct {
+	Success bool                `json:"success"`
+	Results []BatchActionResult `json:"results"`
+}
+
+func (s *Server) handleSessionBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+
+	sinfo, err := s.lookupExecutionSession(r.PathValue("id"))
+	if err != nil {
+		writeExecutionError(w, err)
+		return
+	}
+
+	var req BatchExecutionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = batchModeSequential
+	}
+
+	if req.Mode != batchModeSequential && req.Mode != batchModeParallel {
+		http.Error(w, fmt.Sprintf("invalid batch mode '%s'", req.Mode), http.StatusBadRequest)
+		return
+	}
+
+	for i, action := range req.Actions {
+		if action.Kind != "actor" && action.Kind != "driver" {
+			http.Error(w, fmt.Sprintf("invalid kind '%s' for action %d", action.Kind, i), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.logger.With("session", sinfo.UUID.String(), "mode", req.Mode, "actions", len(req.Actions)).Info("Batch execution request received.")
+
+	result := s.runBatch(sinfo, req)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// batchParallelism is the number of actions of a parallel batch that are run
+// at the same time:
+//
+//	batch:
+//	  parallelism: 8
+func (s *Server) batchParallelism() int {
+	if s.config.IsSet("batch.parallelism") {
+		if n := s.config.GetInt("batch.parallelism"); n > 0 {
+			return n
+		}
+	}
+	return defaultBatchParallelism
+}
+
+// runBatch executes all actions of the batch. Every action is logged in the
+// session context just like a single execution request. Parallel actions are
+// started in order, at most batchParallelism at the same time. With
+// StopOnFailure the actions that did not start before an action failed are
+// skipped.
+func (s *Server) runBatch(sinfo *SessionInfo, req BatchExecutionRequest) *BatchExecutionResult {
+	sinfo.Context.appendLog("system::batch", fmt.Sprintf("Executing batch of %d actions (mode=%s, stopOnFailure=%t).", len(req.Actions), req.Mode, req.StopOnFailure))
+
+	results := make([]BatchActionResult, len(req.Actions))
+	var stopped atomic.Bool
+
+	run := func(i int) {
+		action := req.Actions[i]
+		if req.StopOnFailure && stopped.Load() {
+			results[i] = skippedBatchAction(action)
+			return
+		}
+
+		results[i] = s.runBatchAction(sinfo, action)
+		if results[i].Status != batchStatusSuccess {
+			stopped.Store(true)
+		}
+	}
+
+	if req.Mode == batchModeParallel {
+		var next atomic.Int64
+		var wg sync.WaitGroup
+		for n := min(s.batchParallelism(), len(req.Actions)); n > 0; n-- {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := int(next.Add(1) - 1); i < len(req.Actions); i = int(next.Add(1) - 1) {
+					run(i)
+				}
+			}()
+		}
+		wg.Wait()
+	} else {
+		for i := range req.Actions {
+			run(i)
+		}
+	}
+
+	batchResult := &BatchExecutionResult{Success: true, Results: results}
+	succeeded, failed, skipped := 0, 0, 0
+	for _, r := range results {
+		switch r.Status {
+		case batchStatusSuccess:
+			succeeded++
+		case batchStatusSkipped:
+			skipped++
+			batchResult.Success = false
+		default:
+			failed++
+			batchResult.Success = false
+		}
+	}
+
+	sinfo.Context.appendLog("system::batch", fmt.Sprintf("Batch finished: %d succeeded, %d failed, %d skipped.", succeeded, failed, skipped))
+	return batchResult
+}
+
+func (s *Server) runBatchAction(sinfo *SessionInfo, action BatchAction) BatchActionResult {
+	result := BatchActionResult{
+		ID:     action.ID,
+		Kind:   action.Kind,
+		Type:   action.Type,
+		Action: action.Action,
+	}
+
+	var r *ExecutionResult
+	var err error
+	if action.Kind == "actor" {
+		r, err = s.executeActorAction(sinfo, ActorExecutionRequest{
+			ID:          action.ID,
+			SessionUUID: sinfo.UUID.String(),
+			ActorType:   action.Type,
+			Action:      action.Action,
+			Parameters:  action.Parameters,
+			Expect:      action.Expect,
+		})
+	} else {
+		r, err = s.executeDriverAction(sinfo, DriverExecutionRequest{
+			ID:         action.ID,
+			Session:    sinfo.UUID.String(),
+			DriverType: action.Type,
+			Action:     action.Action,
+			Parameters: action.Parameters,
+			Expect:     action.Expect,
+		})
+	}
+
+	if err != nil {
+		result.Status = batchStatusError
+		result.Message = err.Error()
+		result.ErrorCode = errorCodeOf(err)
+		return result
+	}
+
+	result.Success = r.Success
+	result.Message = r.Message
+	result.Data = r.Data
+	result.ErrorCode = r.ErrorCode
+	if r.Success {
+		result.Status = batchStatusSuccess
+	} else {
+		result.Status = batchStatusFailed
+	}
+	return result
+}
+
+func skippedBatchAction(action BatchAction) BatchActionResult {
+	return BatchActionResult{
+		ID:      action.ID,
+		Kind:    action.Kind,
+		Type:    action.Type,
+		Action:  action.Action,
+		Status:  batchStatusSkipped,
+		Message: "skipped after previous failure",
+	}
+}
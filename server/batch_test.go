@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func postBatch(s *Server, sinfo *SessionInfo, req BatchExecutionRequest) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/session/"+sinfo.UUID.String()+"/batch", bytes.NewBuffer(jsonData))
+	r.SetPathValue("id", sinfo.UUID.String())
+	w := httptest.NewRecorder()
+	s.handleSessionBatch(w, r)
+	return w
+}
+
+func TestBatchSequentialStopOnFailure(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "batchDriver", nil)
+	sinfo := newTestSession(s)
+
+	w := postBatch(s, sinfo, BatchExecutionRequest{
+		StopOnFailure: true,
+		Actions: []BatchAction{
+			{Kind: "driver", Type: "batchDriver", Action: "click"},
+			{Kind: "driver", Type: "batchDriver", Action: "fail"},
+			{Kind: "driver", Type: "batchDriver", Action: "type"},
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+
+	var result BatchExecutionResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode batch result: %v", err)
+	}
+	if result.Success {
+		t.Errorf("Expected batch to fail")
+	}
+
+	expected := []string{batchStatusSuccess, batchStatusFailed, batchStatusSkipped}
+	if len(result.Results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(result.Results))
+	}
+	for i, status := range expected {
+		if result.Results[i].Status != status {
+			t.Errorf("Expected action %d to have status %s, got %s", i, status, result.Results[i].Status)
+		}
+	}
+
+	executed := 0
+	for _, msg := range sinfo.Context.Log {
+		if strings.HasPrefix(msg.Message, "Executing action") {
+			executed++
+		}
+	}
+	if executed != 2 {
+		t.Errorf("Expected 2 actions to be logged, got %d", executed)
+	}
+}
+
+func TestBatchParallelContinueOnFailure(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "parallelDriver", nil)
+	sinfo := newTestSession(s)
+
+	w := postBatch(s, sinfo, BatchExecutionRequest{
+		Mode: batchModeParallel,
+		Actions: []BatchAction{
+			{Kind: "driver", Type: "parallelDriver", Action: "fail"},
+			{Kind: "driver", Type: "parallelDriver", Action: "click"},
+			{Kind: "actor", Type: "unknownActorType", Action: "login"},
+		},
+	})
+
+	var result BatchExecutionResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode batch result: %v", err)
+	}
+
+	expected := []string{batchStatusFailed, batchStatusSuccess, batchStatusError}
+	for i, status := range expected {
+		if result.Results[i].Status != status {
+			t.Errorf("Expected action %d to have status %s, got %s", i, status, result.Results[i].Status)
+		}
+	}
+	if result.Results[1].Message != "click" {
+		t.Errorf("Expected message of action 1 to be passed through, got %q", result.Results[1].Message)
+	}
+}
+
+func TestBatchParallelStopOnFailure(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("batch.parallelism", 1)
+	newTestDriver(t, s, "parallelDriver", nil)
+	sinfo := newTestSession(s)
+
+	w := postBatch(s, sinfo, BatchExecutionRequest{
+		Mode:          batchModeParallel,
+		StopOnFailure: true,
+		Actions: []BatchAction{
+			{Kind: "driver", Type: "parallelDriver", Action: "click"},
+			{Kind: "driver", Type: "parallelDriver", Action: "fail"},
+			{Kind: "driver", Type: "parallelDriver", Action: "click"},
+		},
+	})
+
+	var result BatchExecutionResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode batch result: %v", err)
+	}
+	expected := []string{batchStatusSuccess, batchStatusFailed, batchStatusSkipped}
+	for i, status := range expected {
+		if result.Results[i].Status != status {
+			t.Errorf("Expected action %d to have status %s, got %s", i, status, result.Results[i].Status)
+		}
+	}
+}
+
+func TestBatchParallelismLimit(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("batch.parallelism", 2)
+	var running, peak atomic.Int32
+	newTestDriver(t, s, "slowDriver", &testDriver{respond: func(w http.ResponseWriter, req DriverExecutionRequest) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(20 * time.Millisecond)
+		json.NewEncoder(w).Encode(DriverExecutionResult{Success: true})
+	}})
+	sinfo := newTestSession(s)
+
+	actions := make([]BatchAction, 6)
+	for i := range actions {
+		actions[i] = BatchAction{Kind: "driver", Type: "slowDriver", Action: "wait"}
+	}
+	postBatch(s, sinfo, BatchExecutionRequest{Mode: batchModeParallel, Actions: actions})
+
+	if p := peak.Load(); p != 2 {
+		t.Errorf("Expected at most 2 actions at the same time, got %d", p)
+	}
+}
+
+func TestBatchInvalidRequests(t *testing.T) {
+	s := newTestServer(t)
+	sinfo := newTestSession(s)
+
+	w := postBatch(s, sinfo, BatchExecutionRequest{Mode: "random"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid mode, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = postBatch(s, sinfo, BatchExecutionRequest{Actions: []BatchAction{{Kind: "reporter", Action: "x"}}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid kind, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/session/bad/batch", strings.NewReader("{}"))
+	r.SetPathValue("id", "bad")
+	rec := httptest.NewRecorder()
+	s.handleSessionBatch(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for malformed session id, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
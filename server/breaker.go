@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitCooldown         = 30 * time.Second
+)
+
+// circuitBreaker guards outbound calls to a single registered extension. After
+// a number of consecutive failures the circuit opens and calls fail fast. Once
+// the cooldown passed a single probe call is let through (half-open) that
+// decides whether the circuit closes again.
+type circuitBreaker struct {
+	server   *Server
+	mutex    sync.Mutex
+	key      string
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+type CircuitInfo struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
+
+type circuitBreakerRegister struct {
+	server   *Server
+	mutex    sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func circuitKey(kind, name string) string {
+	return fmt.Sprintf("%s/%s", kind, name)
+}
+
+// get returns the breaker of an extension. kind is one of actor, driver or reporter.
+func (r *circuitBreakerRegister) get(kind, name string) *circuitBreaker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := circuitKey(kind, name)
+	b, ok := r.breakers[key]
+	if !ok {
+		b = &circuitBreaker{server: r.server, key: key, state: circuitClosed}
+		r.breakers[key] = b
+	}
+	return b
+}
+
+// reset drops the breaker state of an extension, e.g. when it registers again.
+func (r *circuitBreakerRegister) reset(kind, name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.breakers, circuitKey(kind, name))
+}
+
+func (r *circuitBreakerRegister) info(kind, name string) CircuitInfo {
+	return r.get(kind, name).info()
+}
+
+func (s *Server) circuitFailureThreshold() int {
+	if s.config.IsSet("circuitBreaker.failureThreshold") {
+		return s.config.GetInt("circuitBreaker.failureThreshold")
+	}
+	return defaultCircuitFailureThreshold
+}
+
+func (s *Server) circuitCooldown() time.Duration {
+	if s.config.IsSet("circuitBreaker.cooldown") {
+		return s.config.GetDuration("circuitBreaker.cooldown")
+	}
+	return defaultCircuitCooldown
+}
+
+// allow reports whether a call may be sent to the extension.
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.server.circuitCooldown() {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		b.server.logger.With("extension", b.key).Info("Circuit half-open. Probing extension.")
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a call that was allowed.
+func (b *circuitBreaker) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+	if success {
+		if b.state != circuitClosed {
+			b.server.logger.With("extension", b.key).Info("Circuit closed.")
+		}
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.server.circuitFailureThreshold() {
+		if b.state != circuitOpen {
+			b.server.logger.With("extension", b.key, "failures", b.failures).Warn("Circuit opened.")
+		}
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release ends a call that was allowed but never sent to the extension
+// without changing the state of the breaker.
+func (b *circuitBreaker) release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+}
+
+// retryAfter returns the remaining cooldown of an open circuit.
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state != circuitOpen {
+		return 0
+	}
+	remaining := b.server.circuitCooldown() - time.Since(b.openedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+func (b *circuitBreaker) info() CircuitInfo {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ci := CircuitInfo{
+		State:    b.state,
+		Failures: b.failures,
+	}
+	if b.state != circuitClosed {
+		openedAt := b.openedAt
+		ci.OpenedAt = &openedAt
+	}
+	return ci
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("circuitBreaker.failureThreshold", 2)
+	s.config.Set("circuitBreaker.cooldown", "20ms")
+
+	b := s.breakers.get("driver", "transitionDriver")
+	defer s.breakers.reset("driver", "transitionDriver")
+
+	b.allow()
+	b.record(false)
+	if b.info().State != circuitClosed {
+		t.Fatalf("Expected circuit to stay closed after one failure, got %s", b.info().State)
+	}
+
+	b.allow()
+	b.record(false)
+	if b.info().State != circuitOpen {
+		t.Fatalf("Expected circuit to open after two failures, got %s", b.info().State)
+	}
+	if b.allow() {
+		t.Errorf("Expected open circuit to reject calls")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() {
+		t.Fatalf("Expected probe call after cooldown")
+	}
+	if b.info().State != circuitHalfOpen {
+		t.Errorf("Expected half-open circuit while probing, got %s", b.info().State)
+	}
+	if b.allow() {
+		t.Errorf("Expected only a single probe call while half-open")
+	}
+
+	b.record(false)
+	if b.info().State != circuitOpen {
+		t.Errorf("Expected failed probe to reopen circuit, got %s", b.info().State)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	b.allow()
+	b.record(true)
+	if info := b.info(); info.State != circuitClosed || info.Failures != 0 {
+		t.Errorf("Expected successful probe to close circuit, got %+v", info)
+	}
+}
+
+func TestExecuteDriverActionCircuitOpen(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("circuitBreaker.failureThreshold", 1)
+	s.config.Set("circuitBreaker.cooldown", "1m")
+
+	driver := newTestDriver(t, s, "brokenDriver", &testDriver{respond: func(w http.ResponseWriter, req DriverExecutionRequest) {
+		w.Write([]byte("not json"))
+	}})
+	defer s.breakers.reset("driver", "brokenDriver")
+
+	sinfo := newTestSession(s)
+	req := DriverExecutionRequest{Session: sinfo.UUID.String(), DriverType: "brokenDriver", Action: "click"}
+
+	_, err := s.executeDriverAction(sinfo, req)
+	var execErr *executionError
+	if !errors.As(err, &execErr) || execErr.Status != http.StatusFailedDependency {
+		t.Fatalf("Expected failed dependency error, got %v", err)
+	}
+
+	_, err = s.executeDriverAction(sinfo, req)
+	if !errors.As(err, &execErr) || execErr.Status != http.StatusServiceUnavailable {
+		t.Fatalf("Expected service unavailable error, got %v", err)
+	}
+	if driver.calls.Load() != 1 {
+		t.Errorf("Expected open circuit to fail fast, driver was called %d times", driver.calls.Load())
+	}
+
+	rec := httptest.NewRecorder()
+	writeExecutionError(rec, err)
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Expected Retry-After of the remaining cooldown, got %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleRegistry(w, httptest.NewRequest(http.MethodGet, "/registry", nil))
+	var info RegistryInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode registry: %v", err)
+	}
+
+	found := false
+	for _, d := range info.Drivers {
+		if d.Name == "brokenDriver" {
+			found = true
+			if d.Circuit.State != circuitOpen {
+				t.Errorf("Expected registry to show open circuit, got %s", d.Circuit.State)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected driver in registry")
+	}
+}
+
+func TestExecuteDriverActionServerErrorOpensCircuit(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("circuitBreaker.failureThreshold", 1)
+	s.config.Set("circuitBreaker.cooldown", "1m")
+
+	newTestDriver(t, s, "unavailableDriver", &testDriver{respond: func(w http.ResponseWriter, req DriverExecutionRequest) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(DriverExecutionResult{Success: true})
+	}})
+	defer s.breakers.reset("driver", "unavailableDriver")
+
+	sinfo := newTestSession(s)
+	_, err := s.executeDriverAction(sinfo, DriverExecutionRequest{Session: sinfo.UUID.String(), DriverType: "unavailableDriver", Action: "click"})
+	if code := errorCodeOf(err); code != ErrorCodeTransport {
+		t.Fatalf("Expected transport error, got %s (%v)", code, err)
+	}
+	if state := s.breakers.info("driver", "unavailableDriver").State; state != circuitOpen {
+		t.Errorf("Expected server error to open the circuit, got %s", state)
+	}
+}
+
+func TestExecuteDriverActionTimeout(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("execution.timeout", "50ms")
+
+	release := make(chan struct{})
+	newTestDriver(t, s, "hangingDriver", &testDriver{hold: release})
+	defer close(release)
+	defer s.breakers.reset("driver", "hangingDriver")
+
+	sinfo := newTestSession(s)
+	_, err := s.executeDriverAction(sinfo, DriverExecutionRequest{Session: sinfo.UUID.String(), DriverType: "hangingDriver", Action: "click"})
+	if code := errorCodeOf(err); code != ErrorCodeTransport {
+		t.Fatalf("Expected timeout as transport error, got %s (%v)", code, err)
+	}
+	if failures := s.breakers.info("driver", "hangingDriver").Failures; failures != 1 {
+		t.Errorf("Expected timeout to count as breaker failure, got %d failures", failures)
+	}
+}
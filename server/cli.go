@@ -0,0 +1,343 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+)
+
+const defaultServerURL = "http://localhost:8080"
+
+// RunCommand executes a command line subcommand. handled is false if the
+// arguments do not name a subcommand and the server should be started.
+func RunCommand(args []string) (handled bool, exitCode int) {
+	if len(args) == 0 {
+		return false, 0
+	}
+
+	switch args[0] {
+	case "scenario":
+		return true, scenarioCommand(args[1:])
+	case "feature":
+		return true, featureCommand(args[1:])
+	case "config":
+		return true, configCommand(args[1:], os.Stdout, os.Stderr)
+	}
+	return false, 0
+}
+
+// configFlagNames maps config keys to the flags that override them.
+var configFlagNames = map[string]string{
+	"hostname":  "hostname",
+	"port":      "port",
+	"log.level": "log-level",
+}
+
+// defaultConfigFile is babylon.yaml unless BABYLON_CONFIG names another file.
+func defaultConfigFile() string {
+	if file := os.Getenv(envConfigFile); file != "" {
+		return file
+	}
+	return "babylon.yaml"
+}
+
+// newConfigFlagSet defines the flags that select and override the
+// configuration. The returned function collects the options after parsing.
+func newConfigFlagSet(name, usage string, output io.Writer) (*flag.FlagSet, func() configOptions) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintln(output, usage)
+		fs.PrintDefaults()
+		fmt.Fprintf(output, "\nConfiguration precedence: %s\n", configPrecedence)
+		fmt.Fprintf(output, "%s with a warning.\n", configEnvIgnored)
+	}
+
+	file := fs.String("config", defaultConfigFile(), "config file")
+	profile := fs.String("profile", os.Getenv(envProfile), "profile of the config file to apply")
+	fs.String("hostname", "", "hostname of the server, overrides hostname")
+	fs.String("port", "", "port to listen on, overrides port")
+	fs.String("log-level", "", "one of "+strings.Join(logLevels, ", ")+", overrides log.level")
+
+	return fs, func() configOptions {
+		opts := configOptions{File: *file, Profile: *profile, Env: true, Overrides: map[string]string{}}
+		fs.Visit(func(f *flag.Flag) {
+			for key, flagName := range configFlagNames {
+				if f.Name == flagName {
+					opts.Overrides[key] = f.Value.String()
+				}
+			}
+		})
+		return opts
+	}
+}
+
+// ParseFlags parses the command line flags of the server into the options
+// of New. ok is false if the server must not start.
+func ParseFlags(args []string, stderr io.Writer) (opts []Option, exitCode int, ok bool) {
+	config, exitCode, ok := parseServerFlags(args, stderr)
+	if !ok {
+		return nil, exitCode, false
+	}
+	return []Option{withConfigOptions(config)}, 0, true
+}
+
+// parseServerFlags parses the flags of the server. A single argument is
+// still accepted as config file. ok is false if the server must not start.
+func parseServerFlags(args []string, stderr io.Writer) (opts configOptions, exitCode int, ok bool) {
+	fs, options := newConfigFlagSet("babylon", "usage: babylon [flags] [config file]\n       babylon scenario|feature|config ...", stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return opts, 0, false
+		}
+		return opts, 2, false
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return opts, 2, false
+	}
+
+	opts = options()
+	if fs.NArg() == 1 {
+		opts.File = fs.Arg(0)
+	}
+	return opts, 0, true
+}
+
+func scenarioCommand(args []string) int {
+	usage := "usage: babylon scenario run [--server URL] <file>..."
+	if len(args) == 0 || args[0] != "run" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("scenario run", flag.ContinueOnError)
+	server := fs.String("server", defaultServerURL, "URL of the Babylon server")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	exitCode := 0
+	for _, file := range fs.Args() {
+		result, err := postScenario(*server, file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err.Error())
+			exitCode = 1
+			continue
+		}
+
+		printScenarioResult(os.Stdout, result)
+		if result.Verdict != verdictPassed {
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+func featureCommand(args []string) int {
+	usage := "usage: babylon feature run [--server URL] <file>..."
+	if len(args) == 0 || args[0] != "run" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("feature run", flag.ContinueOnError)
+	server := fs.String("server", defaultServerURL, "URL of the Babylon server")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	exitCode := 0
+	for _, file := range fs.Args() {
+		var result FeatureResult
+		data, err := os.ReadFile(file)
+		if err == nil {
+			err = postData(*server, "/features/run", "text/plain", data, &result)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err.Error())
+			exitCode = 1
+			continue
+		}
+
+		printFeatureResult(os.Stdout, &result)
+		if result.Verdict != verdictPassed {
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// configCommand validates a config file or prints the effective
+// configuration without starting the server.
+func configCommand(args []string, stdout, stderr io.Writer) int {
+	usage := "usage: babylon config validate [file]\n       babylon config show [flags]"
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "validate":
+		if len(args) > 2 {
+			fmt.Fprintln(stderr, usage)
+			return 2
+		}
+		file := defaultConfigFile()
+		if len(args) == 2 {
+			file = args[1]
+		}
+
+		if err := validateConfigFile(file); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "%s: valid\n", file)
+		return 0
+	case "show":
+		fs, options := newConfigFlagSet("config show", "usage: babylon config show [flags]", stderr)
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if fs.NArg() > 0 {
+			fs.Usage()
+			return 2
+		}
+
+		s, err := New(withConfigOptions(options()), WithLogger(zap.NewNop().Sugar()))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		s.printConfig(stdout)
+		return 0
+	}
+
+	fmt.Fprintln(stderr, usage)
+	return 2
+}
+
+// printConfig prints all effective settings with their source. Sensitive
+// values are redacted.
+func (s *Server) printConfig(w io.Writer) {
+	fmt.Fprintf(w, "# precedence: %s\n", configPrecedence)
+	s.configState.mutex.Lock()
+	if s.configState.profile != "" {
+		fmt.Fprintf(w, "# profile: %s\n", s.configState.profile)
+	}
+	if len(s.configState.ignoredEnv) > 0 {
+		fmt.Fprintf(w, "# %s:\n", configEnvIgnored)
+		for _, reason := range s.configState.ignoredEnv {
+			fmt.Fprintf(w, "#   %s\n", reason)
+		}
+	}
+	s.configState.mutex.Unlock()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	keys := s.config.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", key, s.describeSetting(key, s.config.Get(key)), s.configSource(key))
+	}
+	tw.Flush()
+}
+
+// postScenario sends the scenario file to the server and waits for the result.
+// A matrix file is read next to the scenario file and sent along with it.
+func postScenario(server, file string) (*ScenarioResult, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := "application/yaml"
+	if sc, err := parseScenario(data); err == nil && sc.Matrix != nil && sc.Matrix.File != "" {
+		err := sc.Matrix.loadFile(func(name string) (string, error) {
+			return filepath.Join(filepath.Dir(file), name), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(sc); err != nil {
+			return nil, err
+		}
+		contentType = "application/json"
+	}
+
+	var result ScenarioResult
+	if err := postData(server, "/scenarios/run", contentType, data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// postData posts the data to the path of the server and decodes the JSON
+// response into result.
+func postData(server, path, contentType string, data []byte, result any) error {
+	url := strings.TrimSuffix(server, "/") + path
+	resp, err := http.Post(url, contentType, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+func printScenarioResult(w io.Writer, result *ScenarioResult) {
+	if result.Combinations != nil {
+		fmt.Fprintf(w, "%s %s (suite %s)\n", strings.ToUpper(result.Verdict), result.Name, result.Suite)
+		for i := range result.Combinations {
+			printIndented(w, "  ", func(w io.Writer) { printScenarioResult(w, &result.Combinations[i]) })
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "%s %s (session %s)\n", strings.ToUpper(result.Verdict), result.Name, result.Session)
+	for _, step := range result.Steps {
+		fmt.Fprintf(w, "  [%s] %s %s %s: %s\n", step.Status, step.Kind, step.Type, step.Action, step.Message)
+	}
+	for _, step := range result.Cleanup {
+		fmt.Fprintf(w, "  [%s] cleanup %s %s %s: %s\n", step.Status, step.Kind, step.Type, step.Action, step.Message)
+	}
+}
+
+// printIndented prefixes every line written by print with indent.
+func printIndented(w io.Writer, indent string, print func(io.Writer)) {
+	var buf bytes.Buffer
+	print(&buf)
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line != "" {
+			fmt.Fprint(w, indent+line)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/lycis/babylon/server"
+)
+
+func main() {
+	if handled, exitCode := server.RunCommand(os.Args[1:]); handled {
+		os.Exit(exitCode)
+	}
+
+	opts, exitCode, ok := server.ParseFlags(os.Args[1:], os.Stderr)
+	if !ok {
+		os.Exit(exitCode)
+	}
+
+	srv, err := server.New(opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := srv.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// SIGINT or SIGTERM shut the server down gracefully, a second signal
+	// terminates it immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Wait()
+	}()
+
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+		stop()
+		err = srv.Shutdown(context.Background())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -1,31 +1,443 @@
-package main
+package server
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
-func readConfig(configFile string) {
-	viper.SetDefault("port", 8080)
-	viper.SetDefault("hostname", "localhost")
+// Configuration is merged from these sources, later ones take precedence:
+//
+//  1. built-in defaults
+//  2. the config file (--config, BABYLON_CONFIG or babylon.yaml), the files
+//     it includes and the profile (--profile or BABYLON_PROFILE)
+//  3. BABYLON_* environment variables, e.g. BABYLON_PORT or
+//     BABYLON_DRIVERS_SELENIUM_SECRET for drivers.selenium.secret
+//  4. command line flags (--port, --hostname, --log-level) and settings of
+//     an embedded server (WithSetting)
+//
+// Environment variables are shared with other tools, e.g. Kubernetes injects
+// BABYLON_PORT=tcp://... for a service named babylon. BABYLON_* variables
+// without a config key or with an invalid value are therefore skipped with a
+// warning and the setting keeps its value from the lower sources. Invalid
+// flags and settings are errors.
+const configPrecedence = "flags > BABYLON_* environment variables > config file > defaults"
 
-	logger.Info("Reading config file.")
+// configEnvIgnored describes how unusable environment variables are handled.
+const configEnvIgnored = "BABYLON_* variables without config key or with an invalid value are ignored"
+
+const (
+	envPrefix     = "BABYLON_"
+	envConfigFile = envPrefix + "CONFIG"
+	envProfile    = envPrefix + "PROFILE"
+)
+
+// configOptions select the sources of the configuration.
+type configOptions struct {
+	File    string
+	Profile string
+	// Env applies the BABYLON_* environment variables.
+	Env bool
+	// Overrides maps config keys to the values given by flags.
+	Overrides map[string]string
+	// Settings maps config keys to the values given by WithSetting.
+	Settings map[string]string
+}
+
+// configState describes where the configuration was read from.
+type configState struct {
+	mutex sync.Mutex
+	// overrides maps config keys to the environment variable, flag or
+	// option that set them. Keys of the config file and defaults are not
+	// contained.
+	overrides map[string]string
+	profile   string
+	// files are the config file and all files it includes.
+	files []string
+	// settingFiles maps the keys of all settings to the file that set them.
+	settingFiles map[string]string
+	// ignoredEnv describes the BABYLON_* environment variables that were
+	// skipped and why.
+	ignoredEnv []string
+}
+
+// serverConfig holds the current configuration. It is never changed in place
+// by a reload, a new configuration is built from all sources and swapped in so
+// that readers always see a complete configuration.
+type serverConfig struct {
+	mutex sync.RWMutex
+	viper *viper.Viper
+}
+
+// newConfigViper creates an empty configuration with the built-in defaults.
+func newConfigViper() *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetDefault("port", 8080)
+	v.SetDefault("hostname", "localhost")
+	v.SetDefault("log.level", defaultLogLevel)
+	return v
+}
+
+func newServerConfig() *serverConfig {
+	return &serverConfig{viper: newConfigViper()}
+}
+
+// swap replaces the current configuration.
+func (c *serverConfig) swap(v *viper.Viper) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.viper = v
+}
+
+// Set overrides the key in the current configuration until the next reload.
+func (c *serverConfig) Set(key string, value any) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.viper.Set(key, value)
+}
+
+func (c *serverConfig) IsSet(key string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.IsSet(key)
+}
+
+func (c *serverConfig) Get(key string) any {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.Get(key)
+}
+
+func (c *serverConfig) GetString(key string) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.GetString(key)
+}
+
+func (c *serverConfig) GetBool(key string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.GetBool(key)
+}
+
+func (c *serverConfig) GetInt(key string) int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.GetInt(key)
+}
+
+func (c *serverConfig) GetFloat64(key string) float64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.GetFloat64(key)
+}
+
+func (c *serverConfig) GetDuration(key string) time.Duration {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.GetDuration(key)
+}
+
+func (c *serverConfig) GetStringSlice(key string) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.GetStringSlice(key)
+}
+
+func (c *serverConfig) GetStringMap(key string) map[string]any {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.GetStringMap(key)
+}
+
+func (c *serverConfig) GetStringMapString(key string) map[string]string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.GetStringMapString(key)
+}
+
+func (c *serverConfig) AllKeys() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.AllKeys()
+}
+
+func (c *serverConfig) AllSettings() map[string]any {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.viper.AllSettings()
+}
+
+// loadConfig reads the config file and applies environment variables,
+// flags and settings on top of it.
+func (s *Server) loadConfig(opts configOptions) error {
+	v := newConfigViper()
+	if err := s.readConfig(v, opts.File, opts.Profile); err != nil {
+		return err
+	}
+	if err := s.applyOverrides(v, opts); err != nil {
+		return err
+	}
+	s.config.swap(v)
+	s.applyLogLevel()
+	return nil
+}
+
+// applyOverrides applies the environment variables, settings and flags on
+// top of the config file.
+func (s *Server) applyOverrides(v *viper.Viper, opts configOptions) error {
+	if opts.Env {
+		if err := s.applyEnvOverrides(v); err != nil {
+			return err
+		}
+	}
+	if err := s.applySettings(v, opts.Settings, ""); err != nil {
+		return err
+	}
+	return s.applySettings(v, opts.Overrides, "--")
+}
+
+// applyEnvOverrides merges all BABYLON_* environment variables into the
+// configuration. Variables without config key or with an invalid value are
+// skipped with a warning.
+func (s *Server) applyEnvOverrides(v *viper.Viper) error {
+	settings := map[string]any{}
+	sources := map[string]string{}
+	var ignored []string
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, envPrefix) || name == envConfigFile || name == envProfile {
+			continue
+		}
+
+		key, t, ok := resolveEnvKey(name)
+		if !ok {
+			ignored = append(ignored, fmt.Sprintf("%s: no config key for environment variable", name))
+			continue
+		}
+		if err := validateConfigOverride(key, t, value); err != nil {
+			ignored = append(ignored, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+
+		setNestedSetting(settings, key, envValue(t, value))
+		sources[key] = name
+	}
+
+	sort.Strings(ignored)
+	for _, reason := range ignored {
+		s.logger.With("reason", reason).Warn("Ignoring environment variable.")
+	}
+
+	s.configState.mutex.Lock()
+	for key, source := range sources {
+		s.configState.overrides[key] = source
+	}
+	s.configState.ignoredEnv = ignored
+	s.configState.mutex.Unlock()
+
+	if len(settings) == 0 {
+		return nil
+	}
+	return v.MergeConfigMap(settings)
+}
+
+// envValue splits lists at commas, all other values are converted by viper
+// when they are read.
+func envValue(t reflect.Type, value string) any {
+	if t.Kind() != reflect.Slice {
+		return value
+	}
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+// applySettings sets the values of command line flags, with flagPrefix "--",
+// or of WithSetting. They take precedence over all other sources and are
+// applied again when the config file is reloaded.
+func (s *Server) applySettings(v *viper.Viper, values map[string]string, flagPrefix string) error {
+	for key, value := range values {
+		key = strings.ToLower(key)
+		source := settingSource
+		if flagPrefix != "" {
+			source = flagPrefix + configFlagNames[key]
+		}
+
+		t, _ := configKeyType(key)
+		if err := validateConfigOverride(key, t, value); err != nil {
+			return fmt.Errorf("%s: %s", source, err)
+		}
+		v.Set(key, value)
+
+		s.configState.mutex.Lock()
+		s.configState.overrides[key] = source
+		s.configState.mutex.Unlock()
+	}
+	return nil
+}
+
+// settingSource marks config keys that were set with WithSetting.
+const settingSource = "setting"
+
+// configSource describes where the current value of the key comes from.
+func (s *Server) configSource(key string) string {
+	s.configState.mutex.Lock()
+	source, ok := s.configState.overrides[key]
+	file, inFile := s.configState.settingFiles[key]
+	s.configState.mutex.Unlock()
+
+	switch {
+	case ok && strings.HasPrefix(source, "--"):
+		return "flag " + source
+	case ok && source == settingSource:
+		return settingSource
+	case ok:
+		return "env " + source
+	case inFile:
+		return "file " + file
+	default:
+		return "default"
+	}
+}
+
+// resolveConfigPath resolves a relative path of the setting against the
+// directory of the config file that set it. Paths from environment variables,
+// flags and settings stay relative to the working directory.
+func (s *Server) resolveConfigPath(key, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	s.configState.mutex.Lock()
+	_, overridden := s.configState.overrides[key]
+	file := s.configState.settingFiles[key]
+	s.configState.mutex.Unlock()
+
+	if overridden || file == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(file), path)
+}
+
+func setNestedSetting(settings map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := settings[part].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			settings[part] = next
+		}
+		settings = next
+	}
+	settings[parts[len(parts)-1]] = value
+}
+
+// readConfig loads the config file with its includes and the profile into
+// the configuration. Without a config file only the defaults are used. A
+// missing file is only a warning, an invalid file is returned as
+// *configErrors and the server must not start.
+func (s *Server) readConfig(v *viper.Viper, configFile, profile string) error {
+	if configFile == "" {
+		if profile != "" {
+			return fmt.Errorf("no config file, cannot apply profile '%s'", profile)
+		}
+		return nil
+	}
+
+	s.logger.With("file", configFile, "profile", profile).Info("Reading config file.")
 
 	// Extract name and path from the configFile parameter
 	absPath, err := filepath.Abs(configFile)
 	if err != nil {
-		fmt.Println(err)
-		logger.With("error", err).Warn("Could not resolve config file path")
-		return
+		s.logger.With("error", err).Warn("Could not resolve config file path")
+		return nil
+	}
+
+	v.SetConfigFile(absPath)
+	s.configState.mutex.Lock()
+	s.configState.profile = profile
+	s.configState.files = []string{absPath}
+	s.configState.mutex.Unlock()
+
+	if _, err := os.Stat(absPath); errors.Is(err, fs.ErrNotExist) {
+		if profile != "" {
+			return fmt.Errorf("%s: config file not found, cannot apply profile '%s'", absPath, profile)
+		}
+		s.logger.With("file", absPath).Warn("Config file not found. Using defaults.")
+		return nil
+	}
+
+	doc, err := loadConfigFile(absPath, profile)
+	if err != nil {
+		return err
+	}
+	if err := useConfigDocument(v, doc); err != nil {
+		return err
+	}
+	s.useConfigFiles(doc)
+	return nil
+}
+
+// loadConfigFile loads and validates the config file with the profile.
+func loadConfigFile(file, profile string) (*configDocument, error) {
+	doc, err := loadConfigDocument(file, profile)
+	if err != nil {
+		return nil, err
 	}
+	if errs := validateConfigDocument(doc); len(errs) > 0 {
+		return nil, &configErrors{Errors: sortConfigErrors(errs, doc.Files)}
+	}
+	return doc, nil
+}
 
-	viper.SetConfigFile(absPath)
-	viper.SetConfigType("yaml")
+// useConfigDocument reads the settings of the config file into the
+// configuration.
+func useConfigDocument(v *viper.Viper, doc *configDocument) error {
+	settings, err := doc.settings()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return v.ReadConfig(bytes.NewReader(data))
+}
+
+// useConfigFiles records the files the configuration was read from.
+func (s *Server) useConfigFiles(doc *configDocument) {
+	s.configState.mutex.Lock()
+	s.configState.files = doc.Files
+	s.configState.settingFiles = doc.settingFiles()
+	s.configState.mutex.Unlock()
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		fmt.Println(err)
-		logger.With("error", err).Warn("Invalid configuration")
+// requireSelfManagement only passes requests to the handler while extensions
+// of the kind may register themselves. The setting is checked per request so
+// that it can be changed while the server is running.
+func (s *Server) requireSelfManagement(kind string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.config.GetBool(fmt.Sprintf("security.%s.selfManagement", kind)) {
+			http.Error(w, fmt.Sprintf("%s self-management disabled", kind), http.StatusForbidden)
+			return
+		}
+		handler(w, r)
 	}
 }
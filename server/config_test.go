@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveEnvKey(t *testing.T) {
+	for name, expected := range map[string]string{
+		"BABYLON_PORT":                                      "port",
+		"BABYLON_DRIVERS_SELENIUM_SECRET":                   "drivers.selenium.secret",
+		"BABYLON_DRIVERS_MY_DRIVER_CALLBACK":                "drivers.my_driver.callback",
+		"BABYLON_SECURITY_ACTOR_SELFMANAGEMENT":             "security.actor.selfmanagement",
+		"BABYLON_RETRY_ACTORS_WEB_ACTIONS_OPEN_MAXATTEMPTS": "retry.actors.web.actions.open.maxattempts",
+		"BABYLON_LOG_LEVEL":                                 "log.level",
+		"BABYLON_DRIVERS_SELENIUM":                          "",
+		"BABYLON_PORTS":                                     "",
+	} {
+		key, _, ok := resolveEnvKey(name)
+		if key != expected || ok != (expected != "") {
+			t.Errorf("Expected %s to resolve to %q, got %q", name, expected, key)
+		}
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	s := newTestServer(t)
+	file := filepath.Join(t.TempDir(), "babylon.yaml")
+	os.WriteFile(file, []byte("port: 9090\nhostname: file\ndrivers:\n  selenium:\n    callback: http://localhost:9093\n    secret: fromFile\n"), 0644)
+
+	t.Setenv("BABYLON_PORT", "9091")
+	t.Setenv("BABYLON_DRIVERS_SELENIUM_SECRET", "fromEnv")
+	t.Setenv("BABYLON_GHERKIN_BINDINGS", "a.yaml, b.yaml")
+
+	err := s.loadConfig(configOptions{File: file, Env: true, Overrides: map[string]string{"port": "9092", "log.level": "info"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := s.config.GetInt("port"); got != 9092 {
+		t.Errorf("Expected flag to win, got port %d", got)
+	}
+	if got := s.config.GetString("drivers.selenium.secret"); got != "fromEnv" {
+		t.Errorf("Expected env to win over file, got %s", got)
+	}
+	if got := s.config.GetString("drivers.selenium.callback"); got != "http://localhost:9093" {
+		t.Errorf("Expected file settings of the driver to be kept, got %s", got)
+	}
+	if got := s.config.GetStringMap("drivers"); len(got) != 1 {
+		t.Errorf("Expected driver to be listed once, got %v", got)
+	}
+	if got := s.config.GetStringSlice("gherkin.bindings"); len(got) != 2 || got[1] != "b.yaml" {
+		t.Errorf("Expected list from env, got %v", got)
+	}
+
+	for key, expected := range map[string]string{
+		"port":                    "flag --port",
+		"drivers.selenium.secret": "env BABYLON_DRIVERS_SELENIUM_SECRET",
+		"hostname":                "file " + file,
+		"scenarios.directory":     "default",
+	} {
+		if got := s.configSource(key); got != expected {
+			t.Errorf("Expected source %s for %s, got %s", expected, key, got)
+		}
+	}
+}
+
+func TestLoadConfigInvalidOverrides(t *testing.T) {
+	s := newTestServer(t)
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	t.Setenv("BABYLON_PORT", "tcp://10.0.0.1:8080")
+	t.Setenv("BABYLON_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("BABYLON_LOG_LEVEL", "warn")
+	err := s.loadConfig(configOptions{File: missing, Env: true})
+	if err != nil {
+		t.Fatalf("Expected unusable environment variables to be skipped, got %v", err)
+	}
+	if got := s.config.GetInt("port"); got != 8080 {
+		t.Errorf("Expected default port, got %d", got)
+	}
+	if got := s.config.GetString("log.level"); got != "warn" {
+		t.Errorf("Expected valid environment variables to apply, got %s", got)
+	}
+	expected := []string{
+		"BABYLON_PORT: invalid number 'tcp://10.0.0.1:8080'",
+		"BABYLON_SERVICE_HOST: no config key for environment variable",
+	}
+	s.configState.mutex.Lock()
+	ignored := s.configState.ignoredEnv
+	s.configState.mutex.Unlock()
+	if len(ignored) != len(expected) {
+		t.Fatalf("Expected %d ignored variables, got %v", len(expected), ignored)
+	}
+	for i := range expected {
+		if !strings.HasPrefix(ignored[i], expected[i]) {
+			t.Errorf("Expected %q, got %q", expected[i], ignored[i])
+		}
+	}
+
+	err = s.loadConfig(configOptions{File: missing, Overrides: map[string]string{"log.level": "verbose"}})
+	if err == nil || !strings.Contains(err.Error(), "--log-level: invalid value 'verbose'") {
+		t.Errorf("Expected invalid flag to be rejected, got %v", err)
+	}
+}
+
+func TestParseServerFlags(t *testing.T) {
+	t.Setenv("BABYLON_CONFIG", "env.yaml")
+
+	opts, _, ok := parseServerFlags([]string{"--port", "9000", "--log-level=warn"}, io.Discard)
+	if !ok || opts.File != "env.yaml" || opts.Overrides["port"] != "9000" || opts.Overrides["log.level"] != "warn" {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+	if _, ok := opts.Overrides["hostname"]; ok {
+		t.Errorf("Expected unset flags not to override the configuration")
+	}
+
+	if opts, _, _ := parseServerFlags([]string{"--config", "flag.yaml"}, io.Discard); opts.File != "flag.yaml" {
+		t.Errorf("Expected config flag, got %s", opts.File)
+	}
+	if opts, _, _ := parseServerFlags([]string{"legacy.yaml"}, io.Discard); opts.File != "legacy.yaml" {
+		t.Errorf("Expected config file argument, got %s", opts.File)
+	}
+	if _, code, ok := parseServerFlags([]string{"--unknown"}, io.Discard); ok || code != 2 {
+		t.Errorf("Expected usage error, got %d", code)
+	}
+}
+
+func TestConfigShowCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "babylon.yaml")
+	os.WriteFile(file, []byte("actors:\n  web:\n    callback: http://localhost:9092\n    secret: fromFile\n"), 0644)
+	t.Setenv("BABYLON_ACTORS_WEB_SECRET", "fromEnv")
+	t.Setenv("BABYLON_BUILD_ID", "42")
+
+	var stdout, stderr bytes.Buffer
+	if code := configCommand([]string{"show", "--config", file, "--hostname", "example.org"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Unexpected exit code %d: %s", code, stderr.String())
+	}
+
+	out := stdout.String()
+	for _, expected := range []string{
+		"# precedence: " + configPrecedence,
+		"#   BABYLON_BUILD_ID: no config key for environment variable",
+		"actors.web.secret    ***                    env BABYLON_ACTORS_WEB_SECRET",
+		"hostname             example.org            flag --hostname",
+		"port                 8080                   default",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "fromEnv") {
+		t.Errorf("Expected secret to be redacted")
+	}
+}
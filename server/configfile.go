@@ -0,0 +1,287 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configDocument is a config file merged with the files it includes and the
+// selected profile. Files listed under include are merged first and the
+// including file on top of them, the profile is merged last. Mappings are
+// merged key by key, all other values are replaced.
+type configDocument struct {
+	Root *yaml.Node
+	// Files are all files that were read, the config file first.
+	Files []string
+	// Profiles are the names of all profiles of the config file.
+	Profiles []string
+	// origin is the file every node was read from.
+	origin map[*yaml.Node]string
+}
+
+type configLoader struct {
+	doc    *configDocument
+	read   func(file string) ([]byte, error)
+	stack  []string
+	errors []configError
+}
+
+// loadConfigDocument reads the config file with all includes and merges the
+// profile unless it is empty. Problems are returned as *configErrors.
+func loadConfigDocument(file, profile string) (*configDocument, error) {
+	return loadConfigDocumentWith(file, profile, os.ReadFile)
+}
+
+func loadConfigDocumentWith(file, profile string, read func(string) ([]byte, error)) (*configDocument, error) {
+	l := &configLoader{
+		doc:  &configDocument{origin: map[*yaml.Node]string{}},
+		read: read,
+	}
+
+	root := l.readFile(file, nil)
+	if root == nil {
+		return nil, l.result()
+	}
+
+	if profiles := removeMappingKey(root, "profiles"); profiles != nil {
+		l.applyProfile(root, profiles, file, profile)
+	} else if profile != "" {
+		l.errors = append(l.errors, configError{File: file, Message: fmt.Sprintf("unknown profile '%s', the config file has no profiles", profile)})
+	}
+
+	l.doc.Root = root
+	if err := l.result(); err != nil {
+		return nil, err
+	}
+	return l.doc, nil
+}
+
+func (l *configLoader) result() error {
+	if len(l.errors) == 0 {
+		return nil
+	}
+	return &configErrors{Errors: l.errors}
+}
+
+func (l *configLoader) fail(node *yaml.Node, format string, args ...any) {
+	l.errors = append(l.errors, configError{File: l.doc.origin[node], Line: node.Line, Column: node.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+// readFile parses the file and merges its includes. from is the include
+// entry that names the file.
+func (l *configLoader) readFile(file string, from *yaml.Node) *yaml.Node {
+	if i := indexOf(l.stack, file); i >= 0 {
+		l.fail(from, "include cycle %s -> %s", strings.Join(l.stack[i:], " -> "), file)
+		return nil
+	}
+
+	data, err := l.read(file)
+	if err != nil {
+		if from == nil {
+			l.errors = append(l.errors, configError{File: file, Message: err.Error()})
+		} else {
+			if cause := errors.Unwrap(err); cause != nil {
+				err = cause
+			}
+			l.fail(from, "cannot include '%s': %s", from.Value, err)
+		}
+		return nil
+	}
+	l.doc.Files = append(l.doc.Files, file)
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		syntaxErr := yamlSyntaxError(err)
+		syntaxErr.File = file
+		l.errors = append(l.errors, syntaxErr)
+		return nil
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+
+	root := doc.Content[0]
+	l.setOrigin(root, file)
+	if root.Kind != yaml.MappingNode {
+		l.fail(root, "expected a mapping")
+		return nil
+	}
+
+	l.stack = append(l.stack, file)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+	return l.resolveIncludes(root, file)
+}
+
+// resolveIncludes merges the node on top of the files it includes. Paths are
+// relative to the including file and may contain glob patterns.
+func (l *configLoader) resolveIncludes(node *yaml.Node, file string) *yaml.Node {
+	include := removeMappingKey(node, "include")
+	if include == nil || isNullNode(include) {
+		return node
+	}
+
+	entries := []*yaml.Node{include}
+	if include.Kind == yaml.SequenceNode {
+		entries = include.Content
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: node.Line, Column: node.Column}
+	l.doc.origin[merged] = file
+	for _, entry := range entries {
+		if entry.Kind != yaml.ScalarNode || entry.Value == "" {
+			l.fail(entry, "include: expected a file name")
+			continue
+		}
+
+		pattern := entry.Value
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+
+		files := []string{pattern}
+		if strings.ContainsAny(entry.Value, "*?[") {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				l.fail(entry, "include: invalid pattern '%s'", entry.Value)
+				continue
+			}
+			files = matches
+		}
+
+		for _, f := range files {
+			if included := l.readFile(f, entry); included != nil {
+				merged = mergeConfigNodes(merged, included)
+			}
+		}
+	}
+	return mergeConfigNodes(merged, node)
+}
+
+// applyProfile merges the selected profile into the root node.
+func (l *configLoader) applyProfile(root, profiles *yaml.Node, file, profile string) {
+	if profiles.Kind != yaml.MappingNode {
+		if !isNullNode(profiles) {
+			l.fail(profiles, "profiles: expected a mapping")
+		}
+		return
+	}
+
+	var selected *yaml.Node
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		name := profiles.Content[i].Value
+		l.doc.Profiles = append(l.doc.Profiles, name)
+		if name == profile {
+			selected = profiles.Content[i+1]
+		}
+	}
+	if profile == "" {
+		return
+	}
+	if selected == nil {
+		available := append([]string(nil), l.doc.Profiles...)
+		sort.Strings(available)
+		l.errors = append(l.errors, configError{File: file, Message: fmt.Sprintf("unknown profile '%s', expected one of %s", profile, strings.Join(available, ", "))})
+		return
+	}
+	if isNullNode(selected) {
+		return
+	}
+	if selected.Kind != yaml.MappingNode {
+		l.fail(selected, "profiles.%s: expected a mapping", profile)
+		return
+	}
+	if nested := mappingValue(selected, "profiles"); nested != nil {
+		l.fail(nested, "profiles.%s: profiles cannot be nested", profile)
+		return
+	}
+
+	overlay := l.resolveIncludes(selected, file)
+	mergeConfigNodes(root, overlay)
+}
+
+func (l *configLoader) setOrigin(node *yaml.Node, file string) {
+	l.doc.origin[node] = file
+	for _, child := range node.Content {
+		l.setOrigin(child, file)
+	}
+}
+
+// mergeConfigNodes merges the overlay into the base node and returns the
+// result. Keys are matched case-insensitively like viper does.
+func mergeConfigNodes(base, overlay *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		merged := false
+		for j := 0; j+1 < len(base.Content); j += 2 {
+			if strings.EqualFold(base.Content[j].Value, key.Value) {
+				base.Content[j+1] = mergeConfigNodes(base.Content[j+1], value)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			base.Content = append(base.Content, key, value)
+		}
+	}
+	return base
+}
+
+// removeMappingKey removes the key from the mapping node and returns its
+// value.
+func removeMappingKey(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			value := node.Content[i+1]
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return value
+		}
+	}
+	return nil
+}
+
+// settingFiles maps the dotted keys of all settings to the file that set
+// them.
+func (d *configDocument) settingFiles() map[string]string {
+	files := map[string]string{}
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				walk(node.Content[i+1], joinConfigPath(path, strings.ToLower(node.Content[i].Value)))
+			}
+			return
+		}
+		files[path] = d.origin[node]
+	}
+	walk(d.Root, "")
+	delete(files, "")
+	return files
+}
+
+// settings returns the merged document as viper settings.
+func (d *configDocument) settings() (map[string]any, error) {
+	settings := map[string]any{}
+	if err := d.Root.Decode(&settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	return dir
+}
+
+var profileTestFiles = map[string]string{
+	"babylon.yaml": `include:
+  - extensions/*.yaml
+port: 9090
+drivers:
+  selenium:
+    secret: base
+profiles:
+  staging:
+    include: env/staging.yaml
+    port: 9191
+  ci:
+    drivers:
+      selenium:
+        callback: http://selenium.ci:4444
+`,
+	"extensions/drivers.yaml": `drivers:
+  selenium:
+    callback: http://localhost:4444
+    secret: included
+`,
+	"extensions/actors.yaml": `actors:
+  web:
+    callback: http://localhost:9092
+`,
+	"env/staging.yaml": `drivers:
+  Selenium:
+    callback: http://selenium.staging:4444
+`,
+}
+
+func TestLoadConfigDocument(t *testing.T) {
+	dir := writeConfigFiles(t, profileTestFiles)
+	file := filepath.Join(dir, "babylon.yaml")
+
+	for profile, expected := range map[string]map[string]any{
+		"": {
+			"port":   9090,
+			"actors": map[string]any{"web": map[string]any{"callback": "http://localhost:9092"}},
+			"drivers": map[string]any{"selenium": map[string]any{
+				"callback": "http://localhost:4444",
+				"secret":   "base",
+			}},
+		},
+		"staging": {
+			"port":   9191,
+			"actors": map[string]any{"web": map[string]any{"callback": "http://localhost:9092"}},
+			"drivers": map[string]any{"selenium": map[string]any{
+				"callback": "http://selenium.staging:4444",
+				"secret":   "base",
+			}},
+		},
+	} {
+		doc, err := loadConfigDocument(file, profile)
+		if err != nil {
+			t.Fatalf("Unexpected error for profile %q: %v", profile, err)
+		}
+		settings, _ := doc.settings()
+		if diff := cmp.Diff(expected, settings); diff != "" {
+			t.Errorf("Unexpected settings for profile %q (-want +got):\n%s", profile, diff)
+		}
+		if diff := cmp.Diff([]string{"staging", "ci"}, doc.Profiles); diff != "" {
+			t.Errorf("Unexpected profiles %v", doc.Profiles)
+		}
+	}
+
+	doc, _ := loadConfigDocument(file, "staging")
+	files := doc.settingFiles()
+	if files["drivers.selenium.callback"] != filepath.Join(dir, "env/staging.yaml") || files["drivers.selenium.secret"] != file {
+		t.Errorf("Unexpected setting files %v", files)
+	}
+}
+
+func TestLoadConfigDocumentErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"babylon.yaml": "include: [a.yaml, missing.yaml]\nprofiles:\n  ci:\n    profiles: {}\n",
+		"a.yaml":       "include: babylon.yaml\n",
+	})
+	file := filepath.Join(dir, "babylon.yaml")
+
+	_, err := loadConfigDocument(file, "")
+	var errs *configErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected config errors, got %v", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "a.yaml") + ":1:10: include cycle " + file + " -> " + filepath.Join(dir, "a.yaml") + " -> " + file,
+		file + ":1:19: cannot include 'missing.yaml': no such file or directory",
+	}
+	if diff := cmp.Diff(expected, strings.Split(err.Error(), "\n")); diff != "" {
+		t.Errorf("Unexpected errors (-want +got):\n%s", diff)
+	}
+
+	os.WriteFile(file, []byte("profiles:\n  ci:\n    profiles: {}\n"), 0644)
+	if _, err := loadConfigDocument(file, "ci"); err == nil || !strings.Contains(err.Error(), "3:15: profiles.ci: profiles cannot be nested") {
+		t.Errorf("Expected nested profiles to be rejected, got %v", err)
+	}
+	if _, err := loadConfigDocument(file, "staging"); err == nil || !strings.HasSuffix(err.Error(), "unknown profile 'staging', expected one of ci") {
+		t.Errorf("Expected unknown profile to be rejected, got %v", err)
+	}
+}
+
+func TestValidateConfigProfiles(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"babylon.yaml": "include: drivers.yaml\nprofiles:\n  ci:\n    port: 0\n    actors:\n      web:\n        secret: s\n",
+		"drivers.yaml": "drivers:\n  api:\n    callback: localhost\n",
+	})
+	file := filepath.Join(dir, "babylon.yaml")
+
+	err := validateConfigFile(file)
+	expected := []string{
+		file + ":4:11: port: port must be between 1 and 65535 (profile ci)",
+		file + ":7:9: actors.web: missing 'callback' (profile ci)",
+		filepath.Join(dir, "drivers.yaml") + ":3:15: drivers.api.callback: invalid callback URL 'localhost', expected http(s)://host:port",
+	}
+	if err == nil {
+		t.Fatalf("Expected errors")
+	}
+	if diff := cmp.Diff(expected, strings.Split(err.Error(), "\n")); diff != "" {
+		t.Errorf("Unexpected errors (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadConfigProfile(t *testing.T) {
+	s := newTestServer(t)
+	dir := writeConfigFiles(t, profileTestFiles)
+	file := filepath.Join(dir, "babylon.yaml")
+
+	if err := s.loadConfig(configOptions{File: file, Profile: "ci"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := s.config.GetString("drivers.selenium.callback"); got != "http://selenium.ci:4444" {
+		t.Errorf("Expected profile to overlay the callback, got %s", got)
+	}
+	if got := s.config.GetString("actors.web.callback"); got != "http://localhost:9092" {
+		t.Errorf("Expected included actor, got %s", got)
+	}
+	if s.config.IsSet("profiles") || s.config.IsSet("include") {
+		t.Errorf("Expected profiles and includes not to be settings")
+	}
+	if got := s.configSource("actors.web.callback"); got != "file "+filepath.Join(dir, "extensions/actors.yaml") {
+		t.Errorf("Expected included file as source, got %s", got)
+	}
+
+	if err := s.readConfig(newConfigViper(), filepath.Join(dir, "missing.yaml"), "ci"); err == nil {
+		t.Errorf("Expected profile without config file to be rejected")
+	}
+}
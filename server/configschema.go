@@ -0,0 +1,776 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configSchema describes all settings of babylon.yaml. It is only used to
+// validate the config file, the settings themselves are read through viper.
+// Keys are matched case-insensitively like viper does.
+type configSchema struct {
+	Hostname       string                     `yaml:"hostname"`
+	Port           int                        `yaml:"port"`
+	Security       securityConfig             `yaml:"security"`
+	Actors         map[string]extensionConfig `yaml:"actors"`
+	Drivers        map[string]extensionConfig `yaml:"drivers"`
+	Reporter       map[string]reporterConfig  `yaml:"reporter"`
+	CircuitBreaker circuitBreakerConfig       `yaml:"circuitBreaker"`
+	Execution      executionConfig            `yaml:"execution"`
+	Scenarios      scenariosConfig            `yaml:"scenarios"`
+	Batch          batchConfig                `yaml:"batch"`
+	Suites         historyConfig              `yaml:"suites"`
+	Schedules      map[string]scheduleConfig  `yaml:"schedules"`
+	Scheduler      historyConfig              `yaml:"scheduler"`
+	Gherkin        gherkinConfig              `yaml:"gherkin"`
+	Session        sessionConfig              `yaml:"session"`
+	Redact         redactConfig               `yaml:"redact"`
+	Retry          retryConfig                `yaml:"retry"`
+	Live           liveConfig                 `yaml:"live"`
+	Delivery       deliveryConfig             `yaml:"delivery"`
+	Shutdown       shutdownConfig             `yaml:"shutdown"`
+	Log            logConfig                  `yaml:"log"`
+
+	// Include and Profiles are resolved while the file is loaded, they
+	// are only listed to suggest them for misspelled keys.
+	Include  []string                `yaml:"include"`
+	Profiles map[string]configSchema `yaml:"profiles"`
+}
+
+type selfManagementConfig struct {
+	SelfManagement bool `yaml:"selfManagement"`
+}
+
+type securityConfig struct {
+	Actor     selfManagementConfig `yaml:"actor"`
+	Driver    selfManagementConfig `yaml:"driver"`
+	Reporter  selfManagementConfig `yaml:"reporter"`
+	Schedules selfManagementConfig `yaml:"schedules"`
+}
+
+type extensionConfig struct {
+	Callback string `yaml:"callback"`
+	Secret   string `yaml:"secret"`
+}
+
+type reporterConfig struct {
+	Type      string               `yaml:"type"`
+	Callback  string               `yaml:"callback"`
+	Secret    string               `yaml:"secret"`
+	Live      bool                 `yaml:"live"`
+	Filter    reporterFilterConfig `yaml:"filter"`
+	Directory string               `yaml:"directory"`
+	GroupBy   string               `yaml:"groupBy"`
+	URL       string               `yaml:"url"`
+	Method    string               `yaml:"method"`
+	Headers   map[string]string    `yaml:"headers"`
+	Body      string               `yaml:"body"`
+	Triggers  []string             `yaml:"triggers"`
+	Timeout   time.Duration        `yaml:"timeout"`
+}
+
+type reporterFilterConfig struct {
+	MessageTypes   []string `yaml:"messageTypes"`
+	Tags           []string `yaml:"tags"`
+	Statuses       []string `yaml:"statuses"`
+	ExtensionTypes []string `yaml:"extensionTypes"`
+}
+
+type circuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failureThreshold"`
+	Cooldown         time.Duration `yaml:"cooldown"`
+}
+
+type executionConfig struct {
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type scenariosConfig struct {
+	Directory   string `yaml:"directory"`
+	Parallelism int    `yaml:"parallelism"`
+}
+
+type batchConfig struct {
+	Parallelism int `yaml:"parallelism"`
+}
+
+type historyConfig struct {
+	History int `yaml:"history"`
+}
+
+type scheduleConfig struct {
+	Cron     string `yaml:"cron"`
+	Scenario string `yaml:"scenario"`
+	Feature  string `yaml:"feature"`
+	Timezone string `yaml:"timezone"`
+	Enabled  bool   `yaml:"enabled"`
+}
+
+type gherkinConfig struct {
+	Bindings []string `yaml:"bindings"`
+}
+
+type sessionConfig struct {
+	History int           `yaml:"history"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type redactConfig struct {
+	Keys []string `yaml:"keys"`
+}
+
+type retryConfig struct {
+	Actors    map[string]retryPolicyConfig `yaml:"actors"`
+	Drivers   map[string]retryPolicyConfig `yaml:"drivers"`
+	Reporters map[string]retryPolicyConfig `yaml:"reporters"`
+}
+
+type retryPolicyConfig struct {
+	MaxAttempts       int                          `yaml:"maxAttempts"`
+	Backoff           time.Duration                `yaml:"backoff"`
+	BackoffMultiplier float64                      `yaml:"backoffMultiplier"`
+	MaxBackoff        time.Duration                `yaml:"maxBackoff"`
+	RetryOn           retryOnConfig                `yaml:"retryOn"`
+	Actions           map[string]retryPolicyConfig `yaml:"actions"`
+}
+
+type retryOnConfig struct {
+	TransportErrors bool     `yaml:"transportErrors"`
+	Failures        bool     `yaml:"failures"`
+	MessagePatterns []string `yaml:"messagePatterns"`
+}
+
+type liveConfig struct {
+	BatchSize   int           `yaml:"batchSize"`
+	BatchWindow time.Duration `yaml:"batchWindow"`
+	BufferSize  int           `yaml:"bufferSize"`
+}
+
+type deliveryConfig struct {
+	Directory   string `yaml:"directory"`
+	DeadLetters int    `yaml:"deadLetters"`
+	LaneSize    int    `yaml:"laneSize"`
+}
+
+type shutdownConfig struct {
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type logConfig struct {
+	Level string `yaml:"level"`
+}
+
+// configError is a problem in a config file at the given position. Line is
+// zero if the problem concerns the file as a whole.
+type configError struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (e configError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File + ":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d:", e.Line, e.Column)
+	}
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// configErrors are all problems of a config file and the files it includes.
+type configErrors struct {
+	Errors []configError
+}
+
+func (e *configErrors) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateConfigFile checks the config file, its includes and every profile
+// against the schema. It returns nil or *configErrors.
+func validateConfigFile(file string) error {
+	return validateConfigProfiles(file, os.ReadFile)
+}
+
+// validateConfig checks the YAML document against the schema and returns all
+// problems sorted by their position.
+func validateConfig(data []byte) []configError {
+	err := validateConfigProfiles("", func(file string) ([]byte, error) {
+		if file == "" {
+			return data, nil
+		}
+		return os.ReadFile(file)
+	})
+
+	var errs *configErrors
+	if errors.As(err, &errs) {
+		return errs.Errors
+	}
+	return nil
+}
+
+func validateConfigProfiles(file string, read func(string) ([]byte, error)) error {
+	doc, err := loadConfigDocumentWith(file, "", read)
+	if err != nil {
+		return err
+	}
+
+	errs := validateConfigDocument(doc)
+	base := map[configError]bool{}
+	for _, e := range errs {
+		base[e] = true
+	}
+
+	// problems of the base configuration are found again with every
+	// profile, only the new ones are caused by the profile
+	for _, profile := range doc.Profiles {
+		profileDoc, err := loadConfigDocumentWith(file, profile, read)
+		var profileErrs []configError
+		if err != nil {
+			var loadErrs *configErrors
+			if !errors.As(err, &loadErrs) {
+				return err
+			}
+			profileErrs = loadErrs.Errors
+		} else {
+			profileErrs = validateConfigDocument(profileDoc)
+		}
+
+		for _, e := range profileErrs {
+			if !base[e] {
+				e.Message += fmt.Sprintf(" (profile %s)", profile)
+				errs = append(errs, e)
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &configErrors{Errors: sortConfigErrors(errs, doc.Files)}
+}
+
+// sortConfigErrors removes duplicates and sorts the errors by their position.
+// The files are sorted in the order they were read.
+func sortConfigErrors(errs []configError, files []string) []configError {
+	var unique []configError
+	seen := map[configError]bool{}
+	for _, e := range errs {
+		if !seen[e] {
+			seen[e] = true
+			unique = append(unique, e)
+		}
+	}
+
+	order := map[string]int{}
+	for i, f := range files {
+		if _, ok := order[f]; !ok {
+			order[f] = i
+		}
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		a, b := unique[i], unique[j]
+		if a.File != b.File {
+			return order[a.File] < order[b.File]
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return unique
+}
+
+// validateConfigDocument checks the merged document against the schema.
+func validateConfigDocument(doc *configDocument) []configError {
+	v := &configValidator{origin: doc.origin}
+	v.walk(doc.Root, reflect.TypeOf(configSchema{}), "")
+	return v.errors
+}
+
+var yamlLinePattern = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func yamlSyntaxError(err error) configError {
+	if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		var line int
+		fmt.Sscanf(m[1], "%d", &line)
+		return configError{Line: line, Column: 1, Message: m[2]}
+	}
+	return configError{Line: 1, Column: 1, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+}
+
+type configValidator struct {
+	origin map[*yaml.Node]string
+	errors []configError
+}
+
+func (v *configValidator) fail(node *yaml.Node, path, format string, args ...any) {
+	v.errors = append(v.errors, configError{File: v.origin[node], Line: node.Line, Column: node.Column, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// walk checks that the node matches the type and applies the rules of the
+// path afterwards.
+func (v *configValidator) walk(node *yaml.Node, t reflect.Type, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if isNullNode(node) {
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && t != durationType:
+		if node.Kind != yaml.MappingNode {
+			v.fail(node, path, "expected a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := schemaField(t, key.Value)
+			if !ok {
+				v.unknownKey(key, t, path)
+				continue
+			}
+			v.walk(value, field.Type, joinConfigPath(path, key.Value))
+		}
+	case t.Kind() == reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.fail(node, path, "expected a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.walk(node.Content[i+1], t.Elem(), joinConfigPath(path, node.Content[i].Value))
+		}
+	case t.Kind() == reflect.Slice:
+		// viper also accepts a single value for a list
+		if node.Kind == yaml.ScalarNode {
+			if !v.checkScalar(node, t.Elem(), path) {
+				return
+			}
+			break
+		}
+		if node.Kind != yaml.SequenceNode {
+			v.fail(node, path, "expected a list")
+			return
+		}
+		valid := true
+		for _, item := range node.Content {
+			valid = v.checkScalar(item, t.Elem(), path) && valid
+		}
+		if !valid {
+			return
+		}
+	default:
+		if !v.checkScalar(node, t, path) {
+			return
+		}
+	}
+
+	for _, rule := range configRules {
+		if matchConfigPath(rule.path, path) {
+			rule.check(v, node, path)
+		}
+	}
+}
+
+// checkScalar checks that the node is a single value of the type.
+func (v *configValidator) checkScalar(node *yaml.Node, t reflect.Type, path string) bool {
+	if node.Kind != yaml.ScalarNode {
+		v.fail(node, path, "expected a single value")
+		return false
+	}
+	if err := node.Decode(reflect.New(t).Interface()); err != nil {
+		v.fail(node, path, "invalid %s '%s'", describeConfigType(t), node.Value)
+		return false
+	}
+	return true
+}
+
+func (v *configValidator) unknownKey(key *yaml.Node, t reflect.Type, path string) {
+	msg := fmt.Sprintf("unknown key '%s'", key.Value)
+	if suggestion := suggestConfigKey(t, key.Value); suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean '%s'?)", suggestion)
+	}
+	v.fail(key, path, "%s", msg)
+}
+
+func isNullNode(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func describeConfigType(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "duration"
+	case t.Kind() == reflect.Bool:
+		return "boolean"
+	case t.Kind() == reflect.Int:
+		return "number"
+	case t.Kind() == reflect.Float64:
+		return "decimal number"
+	default:
+		return t.Kind().String()
+	}
+}
+
+func schemaKey(f reflect.StructField) string {
+	return strings.Split(f.Tag.Get("yaml"), ",")[0]
+}
+
+func schemaField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); strings.EqualFold(schemaKey(f), key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// suggestConfigKey returns the known key closest to the unknown one if it is
+// likely a typo.
+func suggestConfigKey(t reflect.Type, key string) string {
+	best, bestDistance := "", len(key)/2+1
+	for i := 0; i < t.NumField(); i++ {
+		candidate := schemaKey(t.Field(i))
+		if candidate == "" {
+			continue
+		}
+		if d := editDistance(strings.ToLower(key), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// matchConfigPath matches a dotted path against a pattern in which "*"
+// matches a single segment.
+func matchConfigPath(pattern, p string) bool {
+	ps, segments := strings.Split(pattern, "."), strings.Split(p, ".")
+	if len(ps) != len(segments) {
+		return false
+	}
+	for i := range ps {
+		if ok, _ := path.Match(ps[i], strings.ToLower(segments[i])); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mappingValue returns the value of the key in the mapping node.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// configRule checks the node at all paths matching the lower case pattern.
+type configRule struct {
+	path  string
+	check func(v *configValidator, node *yaml.Node, path string)
+}
+
+var configRules = []configRule{
+	{"port", checkPort},
+	{"actors.*", requireConfigKeys("callback")},
+	{"drivers.*", requireConfigKeys("callback")},
+	{"actors.*.callback", checkCallbackURL},
+	{"drivers.*.callback", checkCallbackURL},
+	{"reporter.*", checkReporterConfig},
+	{"reporter.*.callback", checkCallbackURL},
+	{"reporter.*.url", checkWebhookURL},
+	{"reporter.*.groupby", checkOneOf("suite", "session")},
+	{"reporter.*.triggers", checkOneOf(webhookTriggerCompletion, webhookTriggerFailure, webhookTriggerSuiteFirstFailure)},
+	{"reporter.*.filter.messagetypes", checkGlob},
+	{"schedules.*", checkScheduleConfig},
+	{"retry.*.*.retryon.messagepatterns", checkRegexp},
+	{"retry.*.*.actions.*.retryon.messagepatterns", checkRegexp},
+	{"retry.*.*.maxattempts", checkPositive},
+	{"retry.*.*.actions.*.maxattempts", checkPositive},
+	{"circuitbreaker.failurethreshold", checkPositive},
+	{"scenarios.parallelism", checkPositive},
+	{"batch.parallelism", checkPositive},
+	{"*.history", checkPositive},
+	{"live.batchsize", checkPositive},
+	{"live.buffersize", checkPositive},
+	{"delivery.deadletters", checkPositive},
+	{"delivery.lanesize", checkPositive},
+	{"log.level", checkOneOf(logLevels...)},
+}
+
+// builtinReporterSettings are the settings a builtin reporter type requires.
+var builtinReporterSettings = map[string][]string{
+	"allure":  {"directory"},
+	"html":    {"directory"},
+	"junit":   {"directory"},
+	"webhook": {"url"},
+}
+
+func checkPort(v *configValidator, node *yaml.Node, path string) {
+	var port int
+	if node.Decode(&port) == nil && (port < 1 || port > 65535) {
+		v.fail(node, path, "port must be between 1 and 65535")
+	}
+}
+
+func checkPositive(v *configValidator, node *yaml.Node, path string) {
+	var n int
+	if node.Decode(&n) == nil && n < 1 {
+		v.fail(node, path, "must be at least 1")
+	}
+}
+
+func checkCallbackURL(v *configValidator, node *yaml.Node, path string) {
+	u, err := url.Parse(node.Value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		v.fail(node, path, "invalid callback URL '%s', expected http(s)://host:port", node.Value)
+		return
+	}
+	if p := u.Port(); p != "" {
+		var port int
+		if _, err := fmt.Sscanf(p, "%d", &port); err != nil || port < 1 || port > 65535 {
+			v.fail(node, path, "invalid port '%s' in callback URL", p)
+		}
+	}
+}
+
+// checkWebhookURL checks webhook URLs that do not depend on the session.
+func checkWebhookURL(v *configValidator, node *yaml.Node, path string) {
+	if !strings.Contains(node.Value, "{{") {
+		checkCallbackURL(v, node, path)
+	}
+}
+
+func checkOneOf(allowed ...string) func(v *configValidator, node *yaml.Node, path string) {
+	return func(v *configValidator, node *yaml.Node, path string) {
+		values := []*yaml.Node{node}
+		if node.Kind == yaml.SequenceNode {
+			values = node.Content
+		}
+		for _, value := range values {
+			if !containsFold(allowed, value.Value) {
+				v.fail(value, path, "invalid value '%s', expected one of %s", value.Value, strings.Join(allowed, ", "))
+			}
+		}
+	}
+}
+
+func checkGlob(v *configValidator, node *yaml.Node, p string) {
+	for _, value := range scalarValues(node) {
+		if _, err := path.Match(value.Value, ""); err != nil {
+			v.fail(value, p, "invalid pattern '%s'", value.Value)
+		}
+	}
+}
+
+func checkRegexp(v *configValidator, node *yaml.Node, path string) {
+	for _, value := range scalarValues(node) {
+		if _, err := regexp.Compile(value.Value); err != nil {
+			v.fail(value, path, "invalid regular expression '%s': %s", value.Value, err)
+		}
+	}
+}
+
+func scalarValues(node *yaml.Node) []*yaml.Node {
+	if node.Kind == yaml.SequenceNode {
+		return node.Content
+	}
+	return []*yaml.Node{node}
+}
+
+func requireConfigKeys(keys ...string) func(v *configValidator, node *yaml.Node, path string) {
+	return func(v *configValidator, node *yaml.Node, path string) {
+		for _, key := range keys {
+			if value := mappingValue(node, key); value == nil || value.Value == "" {
+				v.fail(node, path, "missing '%s'", key)
+			}
+		}
+	}
+}
+
+func checkReporterConfig(v *configValidator, node *yaml.Node, path string) {
+	typeNode := mappingValue(node, "type")
+	if typeNode == nil || typeNode.Value == "" {
+		requireConfigKeys("callback")(v, node, path)
+		return
+	}
+
+	if _, ok := builtinReporterTypes[typeNode.Value]; !ok {
+		known := make([]string, 0, len(builtinReporterTypes))
+		for t := range builtinReporterTypes {
+			known = append(known, t)
+		}
+		sort.Strings(known)
+		v.fail(typeNode, path+".type", "unknown reporter type '%s', expected one of %s", typeNode.Value, strings.Join(known, ", "))
+		return
+	}
+	requireConfigKeys(builtinReporterSettings[typeNode.Value]...)(v, node, path)
+}
+
+func checkScheduleConfig(v *configValidator, node *yaml.Node, path string) {
+	value := func(key string) string {
+		if n := mappingValue(node, key); n != nil {
+			return n.Value
+		}
+		return ""
+	}
+
+	if (value("scenario") == "") == (value("feature") == "") {
+		v.fail(node, path, "exactly one of 'scenario' or 'feature' is required")
+	}
+	if _, err := parseCron(value("cron")); err != nil {
+		v.fail(configValueNode(node, "cron"), path+".cron", "%s", err)
+	}
+	if tz := value("timezone"); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			v.fail(configValueNode(node, "timezone"), path+".timezone", "invalid timezone '%s'", tz)
+		}
+	}
+}
+
+// configValueNode returns the value node of the key or the mapping itself if
+// the key is missing.
+func configValueNode(node *yaml.Node, key string) *yaml.Node {
+	if value := mappingValue(node, key); value != nil {
+		return value
+	}
+	return node
+}
+
+// configKeyType returns the type of the setting at the dotted key.
+func configKeyType(key string) (reflect.Type, bool) {
+	t := reflect.TypeOf(configSchema{})
+	for _, segment := range strings.Split(key, ".") {
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := schemaField(t, segment)
+			if !ok {
+				return nil, false
+			}
+			t = field.Type
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil, false
+		}
+	}
+	return t, t.Kind() != reflect.Struct && t.Kind() != reflect.Map
+}
+
+// resolveEnvKey maps an environment variable like
+// BABYLON_DRIVERS_SELENIUM_SECRET to the config key drivers.selenium.secret.
+// Names of map entries may contain underscores, the shortest name that leads
+// to a known setting wins.
+func resolveEnvKey(name string) (string, reflect.Type, bool) {
+	segments := strings.Split(strings.ToLower(strings.TrimPrefix(name, envPrefix)), "_")
+
+	var resolve func(t reflect.Type, segments []string) ([]string, reflect.Type, bool)
+	resolve = func(t reflect.Type, segments []string) ([]string, reflect.Type, bool) {
+		if len(segments) == 0 {
+			return nil, t, t.Kind() != reflect.Struct && t.Kind() != reflect.Map
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := schemaField(t, segments[0])
+			if !ok {
+				return nil, nil, false
+			}
+			rest, leaf, ok := resolve(field.Type, segments[1:])
+			return append([]string{strings.ToLower(schemaKey(field))}, rest...), leaf, ok
+		case reflect.Map:
+			for i := 1; i <= len(segments); i++ {
+				if rest, leaf, ok := resolve(t.Elem(), segments[i:]); ok {
+					return append([]string{strings.Join(segments[:i], "_")}, rest...), leaf, true
+				}
+			}
+		}
+		return nil, nil, false
+	}
+
+	key, t, ok := resolve(reflect.TypeOf(configSchema{}), segments)
+	if !ok {
+		return "", nil, false
+	}
+	return strings.Join(key, "."), t, true
+}
+
+// validateConfigOverride checks a value given by an environment variable or
+// flag for the config key of the type.
+func validateConfigOverride(key string, t reflect.Type, value string) error {
+	if t == nil {
+		return fmt.Errorf("unknown config key '%s'", key)
+	}
+
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if t.Kind() == reflect.Slice {
+		node = &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range envValue(t, value).([]string) {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: item})
+		}
+	}
+
+	v := &configValidator{}
+	v.walk(node, t, key)
+	if len(v.errors) > 0 {
+		return errors.New(v.errors[0].Message)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateConfig(t *testing.T) {
+	config := `port: 70000
+reporters:
+  junit:
+    type: junit
+reporter:
+  chat:
+    type: webhok
+  web:
+    callback: ftp://localhost
+  files:
+    type: junit
+actors:
+  web:
+    calback: http://localhost:9092
+session:
+  timeout: soon
+`
+	var got []string
+	for _, err := range validateConfig([]byte(config)) {
+		got = append(got, err.Error())
+	}
+
+	expected := []string{
+		"1:7: port: port must be between 1 and 65535",
+		"2:1: unknown key 'reporters' (did you mean 'reporter'?)",
+		"7:11: reporter.chat.type: unknown reporter type 'webhok', expected one of allure, html, junit, webhook",
+		"9:15: reporter.web.callback: invalid callback URL 'ftp://localhost', expected http(s)://host:port",
+		"11:5: reporter.files: missing 'directory'",
+		"14:5: actors.web: unknown key 'calback' (did you mean 'callback'?)",
+		"14:5: actors.web: missing 'callback'",
+		"16:12: session.timeout: invalid duration 'soon'",
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Unexpected errors (-want +got):\n%s", diff)
+	}
+}
+
+func TestValidateConfigRules(t *testing.T) {
+	for config, expected := range map[string]string{
+		"Port: 8080\nSecurity:\n  actor:\n    selfManagement: true\n": "",
+		"port: abc\n": "1:7: port: invalid number 'abc'",
+		"actors:\n  web:\n    callback: http://:1\n":                                                   "3:15: actors.web.callback: invalid callback URL 'http://:1', expected http(s)://host:port",
+		"drivers:\n  api:\n    callback: http://h:0\n":                                                 "3:15: drivers.api.callback: invalid port '0' in callback URL",
+		"reporter:\n  chat:\n    type: webhook\n    url: \"{{ .Session }}\"\n":                         "",
+		"reporter:\n  r:\n    callback: http://h\n    filter:\n      messageTypes: \"[\"\n":            "5:21: reporter.r.filter.messageTypes: invalid pattern '['",
+		"reporter:\n  r:\n    type: html\n    directory: out\n    groupBy: day\n":                      "5:14: reporter.r.groupBy: invalid value 'day', expected one of suite, session",
+		"retry:\n  actors:\n    web:\n      retryOn:\n        messagePatterns: [\"(\"]\n":              "5:27: retry.actors.web.retryOn.messagePatterns: invalid regular expression '(': error parsing regexp: missing closing ): `(`",
+		"schedules:\n  n:\n    cron: \"0 * * * *\"\n    feature: a.feature\n    timezone: Mars/Base\n": "5:15: schedules.n.timezone: invalid timezone 'Mars/Base'",
+		"scenarios:\n  parallelism: 0\n":                                                               "2:16: scenarios.parallelism: must be at least 1",
+		"gherkin:\n  bindings: bindings.yaml\n":                                                        "",
+		"hostname:\n  - a\n":                                                                           "2:3: hostname: expected a single value",
+		"port: [1\n":                                                                                   "1:1: did not find expected ',' or ']'",
+	} {
+		var got []string
+		for _, err := range validateConfig([]byte(config)) {
+			got = append(got, err.Error())
+		}
+		if strings.Join(got, "\n") != expected {
+			t.Errorf("Unexpected errors for %q:\nwant %s\ngot  %s", config, expected, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestValidateExampleConfig(t *testing.T) {
+	if err := validateConfigFile("babylon.yaml"); err != nil {
+		t.Errorf("Expected example config to be valid, got:\n%v", err)
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "babylon.yaml")
+	os.WriteFile(file, []byte("port: 8080\nreporters: {}\n"), 0644)
+
+	var stdout, stderr bytes.Buffer
+	if code := configCommand([]string{"validate", file}, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if expected := file + ":2:1: unknown key 'reporters' (did you mean 'reporter'?)\n"; stderr.String() != expected {
+		t.Errorf("Unexpected output %q", stderr.String())
+	}
+
+	stderr.Reset()
+	os.WriteFile(file, []byte("port: 8080\n"), 0644)
+	if code := configCommand([]string{"validate", file}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), "valid") {
+		t.Errorf("Expected valid config, got %d %s", code, stderr.String())
+	}
+
+	if code := configCommand([]string{"check"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected usage error, got %d", code)
+	}
+}
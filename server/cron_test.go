@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+	}
+
+	for _, expr := range invalid {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("Expected error for '%s'", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Monday, 2024-01-15 10:30
+	base := time.Date(2024, time.January, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 1, 16, 2, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2024, 1, 20, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 1, 21, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"30 10 29 feb *", time.Date(2024, 2, 29, 10, 30, 0, 0, time.UTC)},
+		// day of month or day of week if both are restricted
+		{"0 0 20 * mon", time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)},
+		// a stepped star is no restriction, both fields have to match
+		{"0 0 */2 * mon", time.Date(2024, 1, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1-5/2 jun *", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		c, err := parseCron(test.expr)
+		if err != nil {
+			t.Errorf("Unexpected error for '%s': %v", test.expr, err)
+			continue
+		}
+		if got := c.next(base); !got.Equal(test.want) {
+			t.Errorf("next('%s') = %s, expected %s", test.expr, got, test.want)
+		}
+	}
+
+	c, _ := parseCron("0 0 30 feb *")
+	if got := c.next(base); !got.IsZero() {
+		t.Errorf("Expected no next time for impossible date, got %s", got)
+	}
+}
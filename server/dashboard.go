@@ -0,0 +1,147 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// dashboardFiles is the web dashboard served at /ui. It only uses the public
+// API of the server: /sessions, /session/{id}/log, /session/{id}/report.html
+// and /registry.
+//
+//go:embed ui
+var dashboardFiles embed.FS
+
+// SessionSummary is the short description of a session in the session list.
+type SessionSummary struct {
+	UUID      uuid.UUID  `json:"uuid"`
+	Name      string     `json:"name,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+	Suite     string     `json:"suite,omitempty"`
+	Status    string     `json:"status"`
+	Active    bool       `json:"active"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	Messages  int        `json:"messages"`
+}
+
+// SessionLogPage is a part of the log of a session. Next is the offset to
+// request the following messages with.
+type SessionLogPage struct {
+	UUID     uuid.UUID           `json:"session"`
+	Status   string              `json:"status"`
+	Active   bool                `json:"active"`
+	Messages []SessionLogMessage `json:"messages"`
+	Next     int                 `json:"next"`
+}
+
+func dashboardHandler() http.Handler {
+	ui, err := fs.Sub(dashboardFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(ui)))
+}
+
+func newSessionSummary(sinfo *SessionInfo, active bool) SessionSummary {
+	sinfo.Context.mutex.Lock()
+	messages := len(sinfo.Context.Log)
+	sinfo.Context.mutex.Unlock()
+
+	summary := SessionSummary{
+		UUID:     sinfo.UUID,
+		Name:     sinfo.Name,
+		Tags:     sinfo.Tags,
+		Suite:    sinfo.Suite,
+		Status:   sinfo.status(),
+		Active:   active,
+		Messages: messages,
+	}
+	if !sinfo.createdAt.IsZero() {
+		createdAt := sinfo.createdAt
+		summary.CreatedAt = &createdAt
+	}
+	return summary
+}
+
+// handleSessions lists the active and the recently finished sessions, newest
+// first.
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+
+	s.sessions.sessionMutex.Lock()
+	active := make([]*SessionInfo, 0, len(s.sessions.activeSessions))
+	for _, sinfo := range s.sessions.activeSessions {
+		active = append(active, sinfo)
+	}
+	finished := append([]*SessionInfo{}, s.sessions.finishedSessions...)
+	s.sessions.sessionMutex.Unlock()
+
+	sort.Slice(active, func(i, j int) bool { return active[i].createdAt.After(active[j].createdAt) })
+
+	list := make([]SessionSummary, 0, len(active)+len(finished))
+	for _, sinfo := range active {
+		list = append(list, newSessionSummary(sinfo, true))
+	}
+	for i := len(finished) - 1; i >= 0; i-- {
+		list = append(list, newSessionSummary(finished[i], false))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleSessionLog returns the log messages of an active or finished session
+// starting at the offset given by the since parameter.
+func (s *Server) handleSessionLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("malformed session id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	since := 0
+	if s := r.URL.Query().Get("since"); s != "" {
+		if since, err = strconv.Atoi(s); err != nil || since < 0 {
+			http.Error(w, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sinfo := s.sessions.getSession(id)
+	active := sinfo != nil
+	if sinfo == nil {
+		sinfo = s.sessions.getFinishedSession(id)
+	}
+	if sinfo == nil {
+		http.Error(w, "invalid session", http.StatusNotFound)
+		return
+	}
+
+	sinfo.Context.mutex.Lock()
+	log := sinfo.Context.Log
+	page := SessionLogPage{UUID: sinfo.UUID, Active: active, Messages: []SessionLogMessage{}, Next: len(log)}
+	if since < len(log) {
+		page.Messages = append(page.Messages, log[since:]...)
+	}
+	sinfo.Context.mutex.Unlock()
+	page.Status = sinfo.status()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
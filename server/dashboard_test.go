@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardFiles(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/ui/", dashboardHandler())
+
+	for path, expected := range map[string]string{
+		"/ui/":              "<title>Babylon Dashboard</title>",
+		"/ui/dashboard.js":  `getJSON("/sessions")`,
+		"/ui/dashboard.css": ".session-list",
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("Expected %s to contain %s, got %d", path, expected, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui", nil))
+	if rec.Code/100 != 3 || rec.Header().Get("Location") != "/ui/" {
+		t.Errorf("Expected redirect to /ui/, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestHandleSessions(t *testing.T) {
+	s := newTestServer(t)
+	finished := runReportTestScenario(t, s, reportTestScenario)
+	active := s.newSession("dashboard", []string{"smoke"})
+	defer s.sessions.removeSession(active.UUID)
+
+	rec := httptest.NewRecorder()
+	s.handleSessions(rec, httptest.NewRequest(http.MethodGet, "/sessions", nil))
+
+	var list []SessionSummary
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := map[string]SessionSummary{}
+	for _, s := range list {
+		found[s.UUID.String()] = s
+	}
+	if s, ok := found[active.UUID.String()]; !ok || !s.Active || s.Status != sessionStatusRunning || s.Tags[0] != "smoke" || s.CreatedAt == nil {
+		t.Errorf("Expected active session in list, got %+v", s)
+	}
+	if s, ok := found[finished.UUID.String()]; !ok || s.Active || s.Status != sessionStatusFailed || s.Messages == 0 {
+		t.Errorf("Expected finished session in list, got %+v", s)
+	}
+	if !list[0].Active {
+		t.Errorf("Expected active sessions first")
+	}
+}
+
+func TestHandleSessionLog(t *testing.T) {
+	s := newTestServer(t)
+	sinfo := s.newSession("log", nil)
+	defer s.sessions.removeSession(sinfo.UUID)
+	sinfo.Context.appendLog("user", "first")
+	sinfo.Context.appendLog("user", "second")
+
+	get := func(id, since string) (*httptest.ResponseRecorder, SessionLogPage) {
+		req := httptest.NewRequest(http.MethodGet, "/session/"+id+"/log?since="+since, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		s.handleSessionLog(rec, req)
+
+		var page SessionLogPage
+		json.NewDecoder(rec.Body).Decode(&page)
+		return rec, page
+	}
+
+	_, page := get(sinfo.UUID.String(), "0")
+	if !page.Active || len(page.Messages) != 2 || page.Next != 2 {
+		t.Fatalf("Unexpected page %+v", page)
+	}
+
+	sinfo.Context.appendLog("user", "third")
+	_, page = get(sinfo.UUID.String(), "2")
+	if len(page.Messages) != 1 || page.Messages[0].Message != "third" || page.Next != 3 {
+		t.Errorf("Expected only new message, got %+v", page)
+	}
+
+	_, page = get(sinfo.UUID.String(), "10")
+	if len(page.Messages) != 0 || page.Next != 3 {
+		t.Errorf("Expected no messages beyond the log, got %+v", page)
+	}
+
+	for id, status := range map[string]int{"invalid": http.StatusBadRequest, "00000000-0000-0000-0000-000000000000": http.StatusNotFound} {
+		if rec, _ := get(id, "0"); rec.Code != status {
+			t.Errorf("Expected status %d for %s, got %d", status, id, rec.Code)
+		}
+	}
+	if rec, _ := get(sinfo.UUID.String(), "-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected negative offset to be rejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,639 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	deliveryKindReport = "report"
+	deliveryKindLive   = "live"
+
+	deliveryPendingDirectory    = "pending"
+	deliveryDeadLetterDirectory = "deadletters"
+
+	defaultDeliveryLaneSize = 1000
+)
+
+// deliveryMessage is a session report or live log message on its way to a
+// reporter.
+type deliveryMessage struct {
+	ID        uuid.UUID       `json:"id"`
+	Sequence  uint64          `json:"sequence"`
+	Reporter  string          `json:"reporter"`
+	Kind      string          `json:"kind"`
+	Session   string          `json:"session"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError,omitempty"`
+	FailedAt  *time.Time      `json:"failedAt,omitempty"`
+}
+
+// reporterQueue delivers the messages of a reporter. Every session has its own
+// lane so that the messages of a session arrive in order while a slow session
+// does not hold back the others. Failed deliveries are retried according to
+// the retry policy of the reporter:
+//
+//	retry:
+//	  reporters:
+//	    LiveDashboardReporter:
+//	      maxAttempts: 5
+//	      backoff: 1s
+//	      backoffMultiplier: 2
+//	      maxBackoff: 1m
+//
+// Messages that cannot be delivered are kept as dead letters until they are
+// redelivered. With delivery.directory set, pending messages and dead letters
+// are stored on disk and survive a restart of the server. Pending messages
+// are held back after a restart until their reporter registered again.
+//
+// Lanes are bounded by delivery.laneSize. New messages of a session wait
+// while its lane is full, which slows down the session that produces them.
+type reporterQueue struct {
+	server *Server
+	name   string
+	mutex  sync.Mutex
+	lanes  map[string][]*deliveryMessage
+	active map[string]bool
+	// advanced is closed and replaced whenever a lane advanced.
+	advanced    chan struct{}
+	deadLetters []*deliveryMessage
+	// held are resumed messages whose reporter has not registered yet.
+	held []*deliveryMessage
+}
+
+// errInvalidDeliveryPayload is returned by delivery targets for messages
+// that cannot be sent at all. They become dead letters without retries.
+var errInvalidDeliveryPayload = errors.New("invalid message payload")
+
+// deliveryTarget is implemented by builtin reporters whose messages are sent
+// through a reporter queue to somewhere else than a reporter callback.
+type deliveryTarget interface {
+	send(msg *deliveryMessage) (*http.Response, error)
+}
+
+type deliveryRegister struct {
+	server *Server
+	mutex  sync.Mutex
+	queues map[string]*reporterQueue
+}
+
+// reporterRetryPolicy returns the delivery policy of the reporter.
+func (s *Server) reporterRetryPolicy(name string) retryPolicy {
+	policy := retryPolicy{
+		MaxAttempts:           5,
+		Backoff:               time.Second,
+		BackoffMultiplier:     2,
+		MaxBackoff:            time.Minute,
+		RetryOnTransportError: true,
+	}
+	policy.apply(s, fmt.Sprintf("retry.reporters.%s", name))
+	return policy
+}
+
+func (s *Server) deliveryDirectory(sub string) string {
+	dir := s.config.GetString("delivery.directory")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, sub)
+}
+
+// queue returns the queue of the reporter and creates it if necessary.
+func (r *deliveryRegister) queue(name string) *reporterQueue {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	q, ok := r.queues[name]
+	if !ok {
+		q = &reporterQueue{
+			server:   r.server,
+			name:     name,
+			lanes:    make(map[string][]*deliveryMessage),
+			active:   make(map[string]bool),
+			advanced: make(chan struct{}),
+		}
+		r.queues[name] = q
+	}
+	return q
+}
+
+func (r *deliveryRegister) get(name string) *reporterQueue {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.queues[name]
+}
+
+// resumeDeliveries loads the pending messages and dead letters that were
+// stored on disk before the server stopped and continues their delivery.
+func (s *Server) resumeDeliveries() {
+	deadLetters, err := s.loadDeliveryMessages(s.deliveryDirectory(deliveryDeadLetterDirectory))
+	if err != nil {
+		s.logger.With("error", err).Error("Failed to load dead letters.")
+	}
+	for _, msg := range deadLetters {
+		q := s.deliveries.queue(msg.Reporter)
+		q.mutex.Lock()
+		q.deadLetters = append(q.deadLetters, msg)
+		q.mutex.Unlock()
+	}
+
+	pending, err := s.loadDeliveryMessages(s.deliveryDirectory(deliveryPendingDirectory))
+	if err != nil {
+		s.logger.With("error", err).Error("Failed to load pending reporter messages.")
+	}
+	for _, msg := range pending {
+		q := s.deliveries.queue(msg.Reporter)
+		q.mutex.Lock()
+		q.held = append(q.held, msg)
+		q.mutex.Unlock()
+	}
+	for _, reporter := range s.reporters.list() {
+		s.deliveries.release(reporter.Name)
+	}
+
+	if len(pending) > 0 || len(deadLetters) > 0 {
+		s.logger.With("pending", len(pending), "deadLetters", len(deadLetters)).Info("Resumed reporter deliveries.")
+	}
+}
+
+func (s *Server) loadDeliveryMessages(dir string) ([]*deliveryMessage, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var messages []*deliveryMessage
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return messages, err
+		}
+		var msg deliveryMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.logger.With("file", entry.Name(), "error", err).Warn("Skipping unreadable reporter message.")
+			continue
+		}
+		messages = append(messages, &msg)
+
+		for seq := s.deliverySequence.Load(); seq < msg.Sequence; seq = s.deliverySequence.Load() {
+			s.deliverySequence.CompareAndSwap(seq, msg.Sequence)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].CreatedAt.Equal(messages[j].CreatedAt) {
+			return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+		}
+		return messages[i].Sequence < messages[j].Sequence
+	})
+	return messages, nil
+}
+
+// laneSize returns how many messages a lane of a reporter queue holds before
+// new messages of the session wait.
+func (s *Server) laneSize() int {
+	if s.config.IsSet("delivery.laneSize") {
+		return s.config.GetInt("delivery.laneSize")
+	}
+	return defaultDeliveryLaneSize
+}
+
+// enqueueDelivery queues the payload for delivery to the reporter. It blocks
+// while the lane of the session is full. Messages enqueued after the server
+// stopped are only stored and delivered after a restart. It must not be
+// called while a session or register lock is held.
+func (s *Server) enqueueDelivery(reporter, kind, session string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		s.logger.With("reporter", reporter, "kind", kind, "error", err, "session", session).Error("Failed to marshal reporter message.")
+		return
+	}
+
+	msg := &deliveryMessage{
+		ID:        uuid.New(),
+		Sequence:  s.deliverySequence.Add(1),
+		Reporter:  reporter,
+		Kind:      kind,
+		Session:   session,
+		Payload:   data,
+		CreatedAt: time.Now(),
+	}
+	q := s.deliveries.queue(reporter)
+	q.store(msg, deliveryPendingDirectory)
+	q.pushBounded(msg)
+}
+
+// store writes the message to the given delivery directory and removes it
+// from the other one.
+func (q *reporterQueue) store(m *deliveryMessage, sub string) {
+	dir := q.server.deliveryDirectory(sub)
+	if dir == "" {
+		return
+	}
+
+	for _, other := range []string{deliveryPendingDirectory, deliveryDeadLetterDirectory} {
+		if other != sub {
+			os.Remove(filepath.Join(q.server.deliveryDirectory(other), m.ID.String()+".json"))
+		}
+	}
+
+	// messages may carry credentials, e.g. the headers of webhook requests
+	data, err := json.Marshal(m)
+	if err == nil {
+		err = os.MkdirAll(dir, 0o700)
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, m.ID.String()+".json"), data, 0o600)
+	}
+	if err != nil {
+		q.server.logger.With("reporter", m.Reporter, "message", m.ID.String(), "error", err).Error("Failed to store reporter message.")
+	}
+}
+
+func (q *reporterQueue) remove(m *deliveryMessage) {
+	if dir := q.server.deliveryDirectory(deliveryPendingDirectory); dir != "" {
+		os.Remove(filepath.Join(dir, m.ID.String()+".json"))
+	}
+}
+
+// push appends the message to the lane of its session and starts the lane if
+// it is idle. Resumed and redelivered messages are pushed regardless of the
+// lane size.
+func (q *reporterQueue) push(msg *deliveryMessage) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.append(msg)
+}
+
+// pushBounded waits until the lane of the session has space for the message
+// and pushes it. It gives up once the server stopped.
+func (q *reporterQueue) pushBounded(msg *deliveryMessage) {
+	size := q.server.laneSize()
+	logged := false
+	for {
+		q.mutex.Lock()
+		if len(q.lanes[msg.Session]) < size {
+			q.append(msg)
+			q.mutex.Unlock()
+			return
+		}
+		advanced := q.advanced
+		q.mutex.Unlock()
+
+		if !logged {
+			q.server.logger.With("reporter", q.name, "session", msg.Session).Warn("Delivery lane of reporter full. Waiting for delivery.")
+			logged = true
+		}
+		select {
+		case <-advanced:
+		case <-q.server.stop:
+			return
+		}
+	}
+}
+
+func (q *reporterQueue) append(msg *deliveryMessage) {
+	q.lanes[msg.Session] = append(q.lanes[msg.Session], msg)
+	if !q.active[msg.Session] {
+		q.active[msg.Session] = true
+		go q.run(msg.Session)
+	}
+}
+
+func (q *reporterQueue) run(session string) {
+	for {
+		q.mutex.Lock()
+		lane := q.lanes[session]
+		if len(lane) == 0 {
+			delete(q.lanes, session)
+			delete(q.active, session)
+			q.mutex.Unlock()
+			return
+		}
+		msg := lane[0]
+		q.mutex.Unlock()
+
+		q.deliver(msg)
+
+		q.mutex.Lock()
+		q.lanes[session] = q.lanes[session][1:]
+		close(q.advanced)
+		q.advanced = make(chan struct{})
+		q.mutex.Unlock()
+	}
+}
+
+// deliver sends the message until it is accepted or the retry policy gives up
+// and the message becomes a dead letter. Retries end once the server stopped.
+func (q *reporterQueue) deliver(msg *deliveryMessage) {
+	policy := q.server.reporterRetryPolicy(q.name)
+	for {
+		msg.Attempts++
+		retry, err := q.server.sendDeliveryMessage(msg)
+		if err == nil {
+			q.remove(msg)
+			return
+		}
+		msg.LastError = err.Error()
+
+		if !retry || msg.Attempts >= policy.MaxAttempts {
+			q.server.metrics.reporterFailures.inc(q.name, "deadLetter")
+			q.deadLetter(msg)
+			return
+		}
+		q.server.metrics.reporterFailures.inc(q.name, "retry")
+		// keep the stored message in line with what is still to be delivered
+		q.store(msg, deliveryPendingDirectory)
+
+		delay := policy.backoff(msg.Attempts)
+		q.server.logger.With("reporter", q.name, "kind", msg.Kind, "session", msg.Session, "attempt", msg.Attempts, "delay", delay, "error", err).Warn("Reporter delivery failed. Retrying.")
+		if !waitBackoff(delay, q.server.stop) {
+			// the stored message is delivered again after a restart
+			q.server.logger.With("reporter", q.name, "kind", msg.Kind, "session", msg.Session).Warn("Server stopped. Giving up reporter delivery.")
+			return
+		}
+	}
+}
+
+func (q *reporterQueue) deadLetter(msg *deliveryMessage) {
+	limit := defaultSessionHistorySize
+	if q.server.config.IsSet("delivery.deadLetters") {
+		limit = q.server.config.GetInt("delivery.deadLetters")
+	}
+
+	failed := time.Now()
+	msg.FailedAt = &failed
+	q.store(msg, deliveryDeadLetterDirectory)
+
+	q.mutex.Lock()
+	q.deadLetters = append(q.deadLetters, msg)
+	var evicted []*deliveryMessage
+	if len(q.deadLetters) > limit {
+		evicted = q.deadLetters[:len(q.deadLetters)-limit]
+		q.deadLetters = q.deadLetters[len(q.deadLetters)-limit:]
+	}
+	q.mutex.Unlock()
+
+	if dir := q.server.deliveryDirectory(deliveryDeadLetterDirectory); dir != "" {
+		for _, d := range evicted {
+			os.Remove(filepath.Join(dir, d.ID.String()+".json"))
+		}
+	}
+	q.server.logger.With("reporter", q.name, "kind", msg.Kind, "session", msg.Session, "attempts", msg.Attempts, "error", msg.LastError).Error("Reporter delivery failed permanently. Message moved to dead letters.")
+}
+
+// release starts the delivery of the resumed messages that were held back
+// until the reporter registered.
+func (r *deliveryRegister) release(name string) {
+	q := r.get(name)
+	if q == nil {
+		return
+	}
+
+	q.mutex.Lock()
+	held := q.held
+	q.held = nil
+	q.mutex.Unlock()
+
+	for _, msg := range held {
+		q.push(msg)
+	}
+}
+
+// pending returns the number of messages that are queued or in delivery.
+// Held messages are not counted, they stay stored until their reporter
+// registers.
+func (q *reporterQueue) pending() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	count := 0
+	for _, lane := range q.lanes {
+		count += len(lane)
+	}
+	return count
+}
+
+// flush waits until all queues delivered their pending messages. It returns
+// early if the context expires.
+func (r *deliveryRegister) flush(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for r.pending() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// pending returns the number of messages that are queued or in delivery in
+// all queues.
+func (r *deliveryRegister) pending() int {
+	r.mutex.Lock()
+	queues := make([]*reporterQueue, 0, len(r.queues))
+	for _, q := range r.queues {
+		queues = append(queues, q)
+	}
+	r.mutex.Unlock()
+
+	count := 0
+	for _, q := range queues {
+		count += q.pending()
+	}
+	return count
+}
+
+// listDeadLetters returns copies of the dead letters of the reporter.
+func (q *reporterQueue) listDeadLetters() []deliveryMessage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	list := make([]deliveryMessage, len(q.deadLetters))
+	for i, msg := range q.deadLetters {
+		list[i] = *msg
+	}
+	return list
+}
+
+// redeliver moves the dead letters with the given ids, or all of them if no
+// id is given, back into the queue and returns how many were requeued.
+func (q *reporterQueue) redeliver(ids ...uuid.UUID) int {
+	q.mutex.Lock()
+	var requeue, keep []*deliveryMessage
+	for _, msg := range q.deadLetters {
+		if len(ids) == 0 || containsUUID(ids, msg.ID) {
+			requeue = append(requeue, msg)
+		} else {
+			keep = append(keep, msg)
+		}
+	}
+	q.deadLetters = keep
+	q.mutex.Unlock()
+
+	for _, msg := range requeue {
+		msg.Attempts = 0
+		msg.LastError = ""
+		msg.FailedAt = nil
+		q.store(msg, deliveryPendingDirectory)
+		q.push(msg)
+	}
+	if len(requeue) > 0 {
+		q.server.logger.With("reporter", q.name, "messages", len(requeue)).Info("Redelivering dead letters.")
+	}
+	return len(requeue)
+}
+
+func containsUUID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sendDeliveryMessage posts the message to the reporter. It reports whether a
+// failed delivery may be retried. Messages of reporters that are not
+// registered are not retried, they become dead letters right away.
+func (s *Server) sendDeliveryMessage(msg *deliveryMessage) (bool, error) {
+	reporter, ok := s.reporters.getReporter(msg.Reporter)
+	if !ok {
+		return false, fmt.Errorf("reporter '%s' is not registered", msg.Reporter)
+	}
+
+	breaker := s.breakers.get("reporter", reporter.Name)
+	if !breaker.allow() {
+		return true, errors.New("circuit breaker open")
+	}
+
+	var resp *http.Response
+	var err error
+	if target, ok := reporter.builtin.(deliveryTarget); ok {
+		resp, err = target.send(msg)
+	} else {
+		reportURL := fmt.Sprintf("%sreporter/%s/%s", reporter.Callback, strings.ToLower(reporter.Name), msg.Kind)
+		resp, err = http.Post(reportURL, "application/json", bytes.NewBuffer(msg.Payload))
+	}
+	if errors.Is(err, errInvalidDeliveryPayload) {
+		breaker.release()
+		return false, err
+	}
+	if err != nil {
+		breaker.record(false)
+		return true, err
+	}
+	defer resp.Body.Close()
+	breaker.record(resp.StatusCode < http.StatusInternalServerError)
+
+	if msg.Kind == deliveryKindLiveBatch && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		acknowledgeBatch(msg, resp.Body)
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= http.StatusInternalServerError, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("reporter responded with %s", resp.Status)
+	default:
+		return false, fmt.Errorf("reporter rejected message with %s", resp.Status)
+	}
+}
+
+// handleReporterDeadLetters lists the dead letters of a reporter. The headers
+// and the URL of webhook requests are redacted.
+func (s *Server) handleReporterDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+
+	q := s.reporterQueueOf(w, r.PathValue("name"))
+	if q == nil {
+		return
+	}
+
+	letters := q.listDeadLetters()
+	for i := range letters {
+		if letters[i].Kind == deliveryKindWebhook {
+			letters[i] = redactWebhookRequest(letters[i])
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letters)
+}
+
+// handleReporterRedeliver requeues a single dead letter or, without id, all
+// dead letters of a reporter.
+func (s *Server) handleReporterRedeliver(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+
+	q := s.reporterQueueOf(w, r.PathValue("name"))
+	if q == nil {
+		return
+	}
+
+	var ids []uuid.UUID
+	if sid := r.PathValue("id"); sid != "" {
+		id, err := uuid.Parse(sid)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("malformed message id: %s", err), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	count := q.redeliver(ids...)
+	if len(ids) > 0 && count == 0 {
+		http.Error(w, "dead letter not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"redelivered": count})
+}
+
+// reporterQueueOf returns the queue of a known reporter or writes a not found
+// error.
+func (s *Server) reporterQueueOf(w http.ResponseWriter, name string) *reporterQueue {
+	if q := s.deliveries.get(name); q != nil {
+		return q
+	}
+	if _, ok := s.reporters.getReporter(name); ok {
+		return s.deliveries.queue(name)
+	}
+	http.Error(w, "reporter not found", http.StatusNotFound)
+	return nil
+}
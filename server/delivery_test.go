@@ -0,0 +1,314 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// deliveryTestReporter is a fake reporter that answers with the status
+// returned by respond and records all accepted live messages.
+type deliveryTestReporter struct {
+	mutex    sync.Mutex
+	respond  func(attempt int) int
+	attempts int
+	received []string
+}
+
+func newDeliveryTestReporter(t *testing.T, s *Server, name string, respond func(attempt int) int) *deliveryTestReporter {
+	s.config.Set("retry.reporters."+name+".backoff", "1ms")
+
+	fake := &deliveryTestReporter{respond: respond}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data LiveLogMessageData
+		json.NewDecoder(r.Body).Decode(&data)
+
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+		fake.attempts++
+		status := fake.respond(fake.attempts)
+		if status == http.StatusOK {
+			fake.received = append(fake.received, data.Message.Message)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(ts.Close)
+
+	s.reporters.AddReporter(ReporterInfo{Name: name, Callback: ts.URL + "/", LiveReport: true})
+	t.Cleanup(func() {
+		s.reporters.RemoveReporter(name)
+		if q := s.deliveries.get(name); q != nil {
+			waitForDelivery(t, func() bool { return q.pending() == 0 })
+		}
+		s.deliveries.mutex.Lock()
+		delete(s.deliveries.queues, name)
+		s.deliveries.mutex.Unlock()
+	})
+	return fake
+}
+
+func (f *deliveryTestReporter) messages() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string{}, f.received...)
+}
+
+// waitForDelivery polls the condition until it holds or a second passed.
+func waitForDelivery(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("Condition not met in time")
+}
+
+func enqueueTestLiveMessage(s *Server, reporter, session, message string) {
+	s.enqueueDelivery(reporter, deliveryKindLive, session, LiveLogMessageData{UUID: session, Message: SessionLogMessage{Message: message}})
+}
+
+func TestDeliveryRetriesInOrder(t *testing.T) {
+	s := newTestServer(t)
+	fake := newDeliveryTestReporter(t, s, "ordered", func(attempt int) int {
+		if attempt <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+
+	session := uuid.NewString()
+	for _, msg := range []string{"one", "two", "three"} {
+		enqueueTestLiveMessage(s, "ordered", session, msg)
+	}
+
+	waitForDelivery(t, func() bool { return len(fake.messages()) == 3 })
+	if got := fake.messages(); got[0] != "one" || got[1] != "two" || got[2] != "three" {
+		t.Errorf("Expected messages in order, got %v", got)
+	}
+	if dead := s.deliveries.get("ordered").listDeadLetters(); len(dead) != 0 {
+		t.Errorf("Expected no dead letters, got %+v", dead)
+	}
+}
+
+func TestDeliveryDeadLetters(t *testing.T) {
+	s := newTestServer(t)
+	var mutex sync.Mutex
+	accept := false
+	fake := newDeliveryTestReporter(t, s, "dead", func(int) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if accept {
+			return http.StatusOK
+		}
+		return http.StatusBadRequest
+	})
+
+	enqueueTestLiveMessage(s, "dead", uuid.NewString(), "rejected")
+	q := s.deliveries.get("dead")
+	waitForDelivery(t, func() bool { return len(q.listDeadLetters()) == 1 })
+
+	req := httptest.NewRequest(http.MethodGet, "/reporter/dead/deadletters", nil)
+	req.SetPathValue("name", "dead")
+	rec := httptest.NewRecorder()
+	s.handleReporterDeadLetters(rec, req)
+
+	var dead []deliveryMessage
+	json.NewDecoder(rec.Body).Decode(&dead)
+	if rec.Code != http.StatusOK || len(dead) != 1 || dead[0].Attempts != 1 || dead[0].FailedAt == nil || dead[0].LastError == "" {
+		t.Fatalf("Expected permanently rejected message after one attempt, got %d %+v", rec.Code, dead)
+	}
+
+	for id, status := range map[string]int{uuid.NewString(): http.StatusNotFound, "invalid": http.StatusBadRequest} {
+		req = httptest.NewRequest(http.MethodPost, "/reporter/dead/deadletters/"+id+"/redeliver", nil)
+		req.SetPathValue("name", "dead")
+		req.SetPathValue("id", id)
+		rec = httptest.NewRecorder()
+		s.handleReporterRedeliver(rec, req)
+		if rec.Code != status {
+			t.Errorf("Expected status %d for %s, got %d", status, id, rec.Code)
+		}
+	}
+
+	mutex.Lock()
+	accept = true
+	mutex.Unlock()
+
+	req = httptest.NewRequest(http.MethodPost, "/reporter/dead/deadletters/"+dead[0].ID.String()+"/redeliver", nil)
+	req.SetPathValue("name", "dead")
+	req.SetPathValue("id", dead[0].ID.String())
+	rec = httptest.NewRecorder()
+	s.handleReporterRedeliver(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected redelivery to be accepted, got %d", rec.Code)
+	}
+
+	waitForDelivery(t, func() bool { return len(fake.messages()) == 1 })
+	if len(q.listDeadLetters()) != 0 {
+		t.Errorf("Expected dead letter to be removed")
+	}
+}
+
+func TestDeliveryUnknownReporter(t *testing.T) {
+	s := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/reporter/nobody/deadletters", nil)
+	req.SetPathValue("name", "nobody")
+	rec := httptest.NewRecorder()
+	s.handleReporterDeadLetters(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected not found, got %d", rec.Code)
+	}
+}
+
+func TestDeliveryPersistence(t *testing.T) {
+	s := newTestServer(t)
+	fake := newDeliveryTestReporter(t, s, "durable", func(int) int { return http.StatusOK })
+	dir := t.TempDir()
+	s.config.Set("delivery.directory", dir)
+
+	session := uuid.NewString()
+	q := s.deliveries.queue("durable")
+	pending := &deliveryMessage{ID: uuid.New(), Sequence: 1, Reporter: "durable", Kind: deliveryKindLive, Session: session, CreatedAt: time.Now()}
+	pending.Payload, _ = json.Marshal(LiveLogMessageData{UUID: session, Message: SessionLogMessage{Message: "before restart"}})
+	q.store(pending, deliveryPendingDirectory)
+
+	failed := time.Now()
+	dead := &deliveryMessage{ID: uuid.New(), Sequence: 2, Reporter: "durable", Kind: deliveryKindLive, Session: session, CreatedAt: time.Now(), FailedAt: &failed}
+	q.store(dead, deliveryDeadLetterDirectory)
+
+	s.resumeDeliveries()
+
+	waitForDelivery(t, func() bool { return len(fake.messages()) == 1 })
+	if got := fake.messages()[0]; got != "before restart" {
+		t.Errorf("Expected persisted message to be delivered, got %s", got)
+	}
+	waitForDelivery(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, deliveryPendingDirectory, pending.ID.String()+".json"))
+		return os.IsNotExist(err)
+	})
+	if letters := q.listDeadLetters(); len(letters) != 1 || letters[0].ID != dead.ID {
+		t.Fatalf("Expected persisted dead letter, got %+v", letters)
+	}
+	if s.deliverySequence.Load() < 2 {
+		t.Errorf("Expected sequence to continue after persisted messages")
+	}
+
+	q.redeliver()
+	waitForDelivery(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, deliveryDeadLetterDirectory, dead.ID.String()+".json"))
+		return os.IsNotExist(err)
+	})
+}
+
+func TestDeliveryBatchPartialAck(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("retry.reporters.partial.backoff", "1ms")
+
+	var mutex sync.Mutex
+	var received []string
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch LiveLogBatchData
+		json.NewDecoder(r.Body).Decode(&batch)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		delivered := len(batch.Messages)
+		if attempts == 1 {
+			delivered = 1
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		for _, msg := range batch.Messages[:delivered] {
+			received = append(received, msg.Message)
+		}
+		json.NewEncoder(w).Encode(LiveLogBatchAck{Delivered: delivered})
+	}))
+	defer ts.Close()
+	s.reporters.AddReporter(ReporterInfo{Name: "partial", Callback: ts.URL + "/", LiveReport: true})
+
+	session := uuid.NewString()
+	s.enqueueDelivery("partial", deliveryKindLiveBatch, session, LiveLogBatchData{UUID: session, Messages: []SessionLogMessage{{Message: "one"}, {Message: "two"}, {Message: "three"}}})
+
+	q := s.deliveries.get("partial")
+	waitForDelivery(t, func() bool { return q.pending() == 0 })
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(received) != 3 || received[0] != "one" || received[1] != "two" || received[2] != "three" {
+		t.Errorf("Expected accepted messages not to be sent again, got %v", received)
+	}
+}
+
+func TestDeliveryUnregisteredReporter(t *testing.T) {
+	s := newTestServer(t)
+
+	enqueueTestLiveMessage(s, "removed", uuid.NewString(), "orphaned")
+	q := s.deliveries.get("removed")
+	waitForDelivery(t, func() bool { return len(q.listDeadLetters()) == 1 })
+	if letter := q.listDeadLetters()[0]; letter.Attempts != 1 {
+		t.Errorf("Expected message of unregistered reporter not to be retried, got %d attempts", letter.Attempts)
+	}
+}
+
+func TestDeliveryHeldUntilReporterRegisters(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("delivery.directory", t.TempDir())
+
+	session := uuid.NewString()
+	pending := &deliveryMessage{ID: uuid.New(), Sequence: 1, Reporter: "late", Kind: deliveryKindLive, Session: session, CreatedAt: time.Now()}
+	pending.Payload, _ = json.Marshal(LiveLogMessageData{UUID: session, Message: SessionLogMessage{Message: "before restart"}})
+	s.deliveries.queue("late").store(pending, deliveryPendingDirectory)
+
+	s.resumeDeliveries()
+	q := s.deliveries.get("late")
+	if q.pending() != 0 || len(q.listDeadLetters()) != 0 {
+		t.Fatalf("Expected message to be held until the reporter registers")
+	}
+
+	fake := newDeliveryTestReporter(t, s, "late", func(int) int { return http.StatusOK })
+	waitForDelivery(t, func() bool { return len(fake.messages()) == 1 })
+}
+
+func TestDeliveryReleasedForPreconfiguredReporter(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("delivery.directory", t.TempDir())
+
+	var mutex sync.Mutex
+	var received []string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/reporter/preconfigured/serverConnect" {
+			json.NewEncoder(w).Encode(reporterRegisterRequest{Name: "preconfigured", Callback: ts.URL + "/", Live: true})
+			return
+		}
+		var data LiveLogMessageData
+		json.NewDecoder(r.Body).Decode(&data)
+		mutex.Lock()
+		received = append(received, data.Message.Message)
+		mutex.Unlock()
+	}))
+	t.Cleanup(ts.Close)
+	s.config.Set("reporter.preconfigured.callback", ts.URL)
+	t.Cleanup(func() { s.reporters.RemoveReporter("preconfigured") })
+
+	session := uuid.NewString()
+	pending := &deliveryMessage{ID: uuid.New(), Sequence: 1, Reporter: "preconfigured", Kind: deliveryKindLive, Session: session, CreatedAt: time.Now()}
+	pending.Payload, _ = json.Marshal(LiveLogMessageData{UUID: session, Message: SessionLogMessage{Message: "before restart"}})
+	s.deliveries.queue("preconfigured").store(pending, deliveryPendingDirectory)
+
+	s.resumeDeliveries()
+	s.setupPreconfiguredReporter("preconfigured")
+
+	waitForDelivery(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == 1 && received[0] == "before restart"
+	})
+}
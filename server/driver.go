@@ -1,7 +1,8 @@
-package main
+package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,7 +11,6 @@ import (
 	"sync"
 
 	"github.com/google/uuid"
-	"github.com/spf13/viper"
 )
 
 type Driver struct {
@@ -21,45 +21,60 @@ type Driver struct {
 }
 
 type DriverRegister struct {
+	server  *Server
 	mutex   sync.Mutex
 	drivers map[string]Driver
 }
 
-var drivers DriverRegister
-
-func init() {
-	drivers = DriverRegister{
-		drivers: make(map[string]Driver),
-	}
-}
-
 func (r *DriverRegister) AddDriver(a Driver) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	r.drivers[a.Name] = a
-	logger.With("name", a.Name, "type", a.Type, "callback", a.Callback).Info("New driver registered.")
+	r.server.breakers.reset("driver", a.Name)
+	r.server.logger.With("name", a.Name, "type", a.Type, "callback", a.Callback).Info("New driver registered.")
 }
 
-func (r *DriverRegister) informEndOfSessioNnid(id uuid.UUID) {
+// informEndOfSessioNnid tells all drivers that the session ended. The
+// requests are sent without holding the register lock and end with the
+// context.
+func (r *DriverRegister) informEndOfSessioNnid(ctx context.Context, id uuid.UUID) {
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	drivers := make([]Driver, 0, len(r.drivers))
+	for _, driver := range r.drivers {
+		drivers = append(drivers, driver)
+	}
+	r.mutex.Unlock()
+
+	client := &http.Client{Timeout: r.server.executionTimeout()}
+	for _, driver := range drivers {
+		if ctx.Err() != nil {
+			return
+		}
+		breaker := r.server.breakers.get("driver", driver.Name)
+		if !breaker.allow() {
+			r.server.logger.With("driver", driver.Name, "session", id.String()).Warn("Circuit breaker open. Not informing driver of session end.")
+			continue
+		}
 
-	for k, driver := range r.drivers {
-		logger.With("driver", k, "session", id.String()).Info("Informing driver of session end.")
+		r.server.logger.With("driver", driver.Name, "session", id.String()).Info("Informing driver of session end.")
 		driverURL := fmt.Sprintf("%sdriver/%s/session/%s", driver.Callback, driver.Name, id.String())
-		req, err := http.NewRequest(http.MethodDelete, driverURL, nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, driverURL, nil)
 		if err != nil {
-			logger.With("driver", k, "session", id.String(), "error", err.Error()).Error("Creating request to inform driver of session end failed.")
+			breaker.record(false)
+			r.server.logger.With("driver", driver.Name, "session", id.String(), "error", err.Error()).Error("Creating request to inform driver of session end failed.")
 			continue
 		}
-		client := &http.Client{}
 		resp, err := client.Do(req)
 		if err != nil {
-			logger.With("driver", k, "session", id.String(), "error", err.Error()).Error("Informing driver of session end failed.")
+			breaker.record(false)
+			r.server.logger.With("driver", driver.Name, "session", id.String(), "error", err.Error()).Error("Informing driver of session end failed.")
 			continue
 		}
+		resp.Body.Close()
+		breaker.record(resp.StatusCode < http.StatusInternalServerError)
+
 		if resp.StatusCode != http.StatusOK {
-			logger.With("driver", k, "session", id.String(), "statusCode", resp.StatusCode).Error("Informing driver of session end failed.")
+			r.server.logger.With("driver", driver.Name, "session", id.String(), "statusCode", resp.StatusCode).Error("Informing driver of session end failed.")
 			continue
 		}
 	}
@@ -88,9 +103,9 @@ type DriverDeleteRequest struct {
 	Name string `json:"name"`
 }
 
-func registerDriver(w http.ResponseWriter, r *http.Request) {
-	drivers.mutex.Lock()
-	defer drivers.mutex.Unlock()
+func (s *Server) registerDriver(w http.ResponseWriter, r *http.Request) {
+	s.drivers.mutex.Lock()
+	defer s.drivers.mutex.Unlock()
 
 	if r.Method == http.MethodPost {
 		var req DriverRegisterRequest
@@ -103,8 +118,9 @@ func registerDriver(w http.ResponseWriter, r *http.Request) {
 			req.Callback += "/"
 		}
 
-		drivers.drivers[req.Name] = Driver(req)
-		logger.With("name", req.Name, "type", req.Type, "callback", req.Callback).Info("New driver registered.")
+		s.drivers.drivers[req.Name] = Driver(req)
+		s.breakers.reset("driver", req.Name)
+		s.logger.With("name", req.Name, "type", req.Type, "callback", req.Callback).Info("New driver registered.")
 		return
 	} else if r.Method == http.MethodDelete {
 		var req DriverDeleteRequest
@@ -112,8 +128,8 @@ func registerDriver(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		delete(drivers.drivers, req.Name)
-		logger.With("name", req.Name).Info("Driver deleted.")
+		delete(s.drivers.drivers, req.Name)
+		s.logger.With("name", req.Name).Info("Driver deleted.")
 		return
 	}
 
@@ -121,101 +137,110 @@ func registerDriver(w http.ResponseWriter, r *http.Request) {
 }
 
 type DriverExecutionRequest struct {
+	ID         string         `json:"id,omitempty"`
 	DriverType string         `json:"type"`
 	Action     string         `json:"action"`
 	Parameters map[string]any `json:"parameters"`
 	Session    string         `json:"session"`
+	Expect     []Expectation  `json:"expect,omitempty"`
 }
 
-type DriverExecutionResult struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-}
+type DriverExecutionResult = ExecutionResult
 
-func executeDriver(w http.ResponseWriter, r *http.Request) {
+func (s *Server) executeDriver(w http.ResponseWriter, r *http.Request) {
 	var req DriverExecutionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	driver := drivers.GetDriverByType(req.DriverType)
-	if driver == nil {
-		http.Error(w, "no supported driver", http.StatusBadGateway)
-		return
-	}
+	s.logger.With("session", req.Session, "type", req.DriverType, "action", req.Action).Info("Driver execution request received.")
 
-	if len(req.Session) < 1 || req.Session == "" {
-		http.Error(w, "missing session id", http.StatusBadRequest)
+	sinfo, err := s.lookupExecutionSession(req.Session)
+	if err != nil {
+		writeExecutionError(w, err)
+		return
 	}
 
-	uuid, err := uuid.Parse(req.Session)
+	result, err := s.executeDriverAction(sinfo, req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("malformed session id: %s", err.Error()), http.StatusBadRequest)
+		writeExecutionError(w, err)
 		return
 	}
 
-	sinfo := session_register.getSession(uuid)
-	if sinfo == nil {
-		http.Error(w, "unknown session id", http.StatusBadRequest)
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
 
-	logger.With("session", req.Session, "type", req.DriverType, "action", req.Action).Info("Driver execution request received.")
+// executeDriverAction forwards the request to a driver of the requested type,
+// records the outcome in the session context and evaluates the expectations
+// of the request.
+func (s *Server) executeDriverAction(sinfo *SessionInfo, req DriverExecutionRequest) (result *DriverExecutionResult, err error) {
+	name := req.DriverType
+	execution := sinfo.Context.nextExecution()
+	defer func() {
+		if err != nil {
+			failAction(sinfo, execution, "driver", name, req.Action, err)
+		}
+		s.recordAction("driver", req.DriverType, req.Action, result, err)
+	}()
 
-	driverURL := fmt.Sprintf("%sdriver/%s/execute", driver.Callback, driver.Name)
-	reqJSON, err := json.Marshal(req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if !s.beginAction() {
+		return nil, errShuttingDown
 	}
+	defer s.endAction()
+	sinfo.beginActivity()
+	defer sinfo.endActivity()
 
-	sinfo.Context.appendLog(fmt.Sprintf("system::driver::%s", driver.Name), fmt.Sprintf("Executing action '%s'.", req.Action))
+	if err := validateExpectations(req.Expect); err != nil {
+		return nil, newCodedExecutionError(http.StatusBadRequest, ErrorCodeInvalidRequest, err.Error())
+	}
 
-	resp, err := http.Post(driverURL, "application/json", bytes.NewBuffer(reqJSON))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	driver := s.drivers.GetDriverByType(req.DriverType)
+	if driver == nil {
+		return nil, newCodedExecutionError(http.StatusBadGateway, ErrorCodeNoExtension, "no supported driver")
 	}
-	defer resp.Body.Close()
+	name = driver.Name
 
-	body, err := io.ReadAll(resp.Body)
+	driverURL := fmt.Sprintf("%sdriver/%s/execute", driver.Callback, driver.Name)
+	forwarded := req
+	forwarded.Expect = nil
+	forwarded.Parameters, err = s.resolveParameters(sinfo, req.Action, req.Parameters)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	var result DriverExecutionResult
-	if err := json.Unmarshal(body, &result); err != nil {
-		http.Error(w, err.Error(), http.StatusFailedDependency)
-		return
+	reqJSON, err := json.Marshal(forwarded)
+	if err != nil {
+		return nil, newExecutionError(http.StatusInternalServerError, err.Error())
 	}
 
-	if result.Success {
-		sinfo.Context.appendLog(fmt.Sprintf("system::driver::%s", driver.Name), "Driver action: SUCCESS")
-	} else {
-		sinfo.Context.appendLog(fmt.Sprintf("system::driver::%s", driver.Name), "Driver action: FAILED")
+	policy := s.retryPolicyFor("drivers", req.DriverType, req.Action)
+	result, err = s.forwardExecution(sinfo, execution, "driver", driver.Name, driverURL, req.Action, forwarded.Parameters, reqJSON, policy)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(result.Message) > 0 {
-		sinfo.Context.appendLog(fmt.Sprintf("message::driver::%s", driver.Name), result.Message)
+	completeAction(sinfo, execution, "driver", driver.Name, req.Action, req.Expect, result)
+	if req.ID != "" {
+		sinfo.Context.setStepResult(req.ID, result)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	return result, nil
 }
 
-func setupPreconfiguredDriver(name string) {
-	drivers.mutex.Lock()
-	defer drivers.mutex.Unlock()
+func (s *Server) setupPreconfiguredDriver(name string) {
+	s.drivers.mutex.Lock()
+	defer s.drivers.mutex.Unlock()
 
-	if !viper.IsSet(fmt.Sprintf("drivers.%s.callback", name)) {
-		logger.With("driver", name).Error("Preconfigured driver is missing callback.")
+	if !s.config.IsSet(fmt.Sprintf("drivers.%s.callback", name)) {
+		s.logger.With("driver", name).Error("Preconfigured driver is missing callback.")
 		return
 	}
 
-	callback := viper.GetString(fmt.Sprintf("drivers.%s.callback", name))
-	secret := viper.GetString(fmt.Sprintf("drivers.%s.secret", name))
-	if !viper.IsSet(fmt.Sprintf("drivers.%s.secret", name)) {
+	callback := s.config.GetString(fmt.Sprintf("drivers.%s.callback", name))
+	secret := s.config.GetString(fmt.Sprintf("drivers.%s.secret", name))
+	if !s.config.IsSet(fmt.Sprintf("drivers.%s.secret", name)) {
 		secret = ""
 	}
 
@@ -225,22 +250,22 @@ func setupPreconfiguredDriver(name string) {
 
 	driverURL := fmt.Sprintf("%sdriver/%s/serverConnect", callback, name)
 	req := DriverRegisterRequest{
-		Callback: fmt.Sprintf("http://%s:%d/", viper.GetString("hostname"), viper.GetInt("port")),
+		Callback: s.callbackURL(),
 	}
 	reqJSON, err := json.Marshal(req)
 	if err != nil {
-		logger.With("driver", name, "error", err).Error("Failed to marshal server side registration request.")
+		s.logger.With("driver", name, "error", err).Error("Failed to marshal server side registration request.")
 		return
 	}
 
 	resp, err := http.Post(driverURL, "application/json", bytes.NewBuffer(reqJSON))
 	if err != nil {
-		logger.With("driver", name, "error", err).Error("Failed to attach server to driver.")
+		s.logger.With("driver", name, "error", err).Error("Failed to attach server to driver.")
 		return
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		logger.With("driver", name, "statusCode", resp.StatusCode).Error("Failed to attach server to driver. Check driver logs.")
+		s.logger.With("driver", name, "statusCode", resp.StatusCode).Error("Failed to attach server to driver. Check driver logs.")
 		return
 	}
 
@@ -248,21 +273,22 @@ func setupPreconfiguredDriver(name string) {
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.With("driver", name, "error", err).Error("Failed reading driver response on server side registration.")
+		s.logger.With("driver", name, "error", err).Error("Failed reading driver response on server side registration.")
 		return
 	}
 
 	var result DriverRegisterRequest
 	if err := json.Unmarshal(body, &result); err != nil {
-		logger.With("driver", name, "error", err).Error("Failed parsing driver response on server side registration.")
+		s.logger.With("driver", name, "error", err).Error("Failed parsing driver response on server side registration.")
 		return
 	}
 
 	if result.Secret != secret {
-		logger.With("driver", name).Error("Server side driver registration aborted. Invalid secret from driver.")
+		s.logger.With("driver", name).Error("Server side driver registration aborted. Invalid secret from driver.")
 		return
 	}
 
-	drivers.drivers[name] = Driver(result)
-	logger.With("driver", name).Info("Server side driver registered.")
+	s.drivers.drivers[name] = Driver(result)
+	s.breakers.reset("driver", name)
+	s.logger.With("driver", name).Info("Server side driver registered.")
 }
@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"bytes"
@@ -8,16 +8,10 @@ import (
 	"testing"
 
 	"github.com/lycis/verify"
-	"github.com/spf13/viper"
-	"go.uber.org/zap"
 )
 
-func init() {
-	// Initialize a no-op logger to prevent panics.
-	logger = zap.NewNop().Sugar()
-}
-
 func TestRegisterDriverHandler(t *testing.T) {
+	s := newTestServer(t)
 	reg := DriverRegister{
 		drivers: make(map[string]Driver),
 	}
@@ -34,7 +28,7 @@ func TestRegisterDriverHandler(t *testing.T) {
 	r.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	registerDriver(w, r)
+	s.registerDriver(w, r)
 
 	verify.Number(w.Code).Equal(http.StatusOK)
 	verify.Map(reg.drivers).Len(1)
@@ -42,6 +36,7 @@ func TestRegisterDriverHandler(t *testing.T) {
 }
 
 func TestDeleteDriverHandler(t *testing.T) {
+	s := newTestServer(t)
 	reg := DriverRegister{
 		drivers: map[string]Driver{
 			"test-driver": {Name: "test-driver", Type: "test-type"},
@@ -54,7 +49,7 @@ func TestDeleteDriverHandler(t *testing.T) {
 	r.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	registerDriver(w, r)
+	s.registerDriver(w, r)
 
 	verify.Number(w.Code).Equal(http.StatusOK)
 	verify.Map(reg.drivers).Len(0)
@@ -71,11 +66,12 @@ func TestGetDriverByTypeNotFound(t *testing.T) {
 }
 
 func TestSetupPreconfiguredDriver(t *testing.T) {
-	viper.Set("drivers.test-driver.callback", "http://localhost:8083/")
-	viper.Set("drivers.test-driver.secret", "supersecret")
+	s := newTestServer(t)
+	s.config.Set("drivers.test-driver.callback", "http://localhost:8083/")
+	s.config.Set("drivers.test-driver.secret", "supersecret")
 
-	setupPreconfiguredDriver("test-driver")
+	s.setupPreconfiguredDriver("test-driver")
 
-	verify.Map(drivers.drivers).Len(1)
-	verify.String(drivers.drivers["test-driver"].Name).Equal("test-driver")
+	verify.Map(s.drivers.drivers).Len(1)
+	verify.String(s.drivers.drivers["test-driver"].Name).Equal("test-driver")
 }
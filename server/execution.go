@@ -0,0 +1,276 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrorCode classifies why an action failed. Extensions may report their own
+// codes, the server uses the predefined ones below.
+type ErrorCode string
+
+const (
+	ErrorCodeActionFailed        ErrorCode = "ACTION_FAILED"
+	ErrorCodeTransport           ErrorCode = "TRANSPORT_ERROR"
+	ErrorCodeInvalidResponse     ErrorCode = "INVALID_RESPONSE"
+	ErrorCodeNoExtension         ErrorCode = "NO_EXTENSION"
+	ErrorCodeCircuitOpen         ErrorCode = "CIRCUIT_OPEN"
+	ErrorCodeAssertion           ErrorCode = "ASSERTION_FAILED"
+	ErrorCodeInvalidRequest      ErrorCode = "INVALID_REQUEST"
+	ErrorCodeUnresolvedReference ErrorCode = "UNRESOLVED_REFERENCE"
+	ErrorCodeInternal            ErrorCode = "INTERNAL_ERROR"
+	ErrorCodeShuttingDown        ErrorCode = "SHUTTING_DOWN"
+)
+
+// ExecutionResult returned by actors and drivers for an executed action. Data
+// holds arbitrary JSON provided by the extension, e.g. the id of a created entity.
+type ExecutionResult struct {
+	Success    bool              `json:"success"`
+	Message    string            `json:"message"`
+	Data       any               `json:"data,omitempty"`
+	ErrorCode  ErrorCode         `json:"errorCode,omitempty"`
+	Artifacts  []Artifact        `json:"artifacts,omitempty"`
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+}
+
+// Artifact is a file an extension attaches to the result of an action, e.g. a
+// screenshot. The content is base64 encoded.
+type Artifact struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+// ActionRequestData is the structured part of the session log entry that
+// records the start of an action attempt.
+type ActionRequestData struct {
+	Action     string         `json:"action"`
+	Attempt    int            `json:"attempt"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+}
+
+// ActionResultData is the structured part of the session log entry that
+// records the outcome of an action.
+type ActionResultData struct {
+	Action    string    `json:"action"`
+	Success   bool      `json:"success"`
+	ErrorCode ErrorCode `json:"errorCode,omitempty"`
+	Data      any       `json:"data,omitempty"`
+}
+
+func newActionResultData(action string, result *ExecutionResult) *ActionResultData {
+	return &ActionResultData{
+		Action:    action,
+		Success:   result.Success,
+		ErrorCode: result.ErrorCode,
+		Data:      result.Data,
+	}
+}
+
+// completeAction records the outcome of an executed action in the session
+// context. Expectations are evaluated against the result and a failed
+// expectation fails the action even if the extension reported success.
+func completeAction(sinfo *SessionInfo, execution int, kind, name, action string, expect []Expectation, result *ExecutionResult) {
+	if !result.Success && result.ErrorCode == "" {
+		result.ErrorCode = ErrorCodeActionFailed
+	}
+
+	label := strings.ToUpper(kind[:1]) + kind[1:]
+	resultData := newActionResultData(action, result)
+	if result.Success {
+		sinfo.Context.appendExecutionLog(execution, fmt.Sprintf("system::%s::%s", kind, name), fmt.Sprintf("%s action: SUCCESS", label), resultData)
+	} else {
+		sinfo.Context.appendExecutionLog(execution, fmt.Sprintf("system::%s::%s", kind, name), fmt.Sprintf("%s action: FAILED", label), resultData)
+	}
+
+	if len(result.Message) > 0 {
+		sinfo.Context.appendExecutionLog(execution, fmt.Sprintf("message::%s::%s", kind, name), result.Message, nil)
+	}
+
+	for i := range result.Artifacts {
+		artifact := &result.Artifacts[i]
+		sinfo.Context.appendExecutionLog(execution, fmt.Sprintf("system::artifact::%s", name), fmt.Sprintf("Artifact '%s' (%s) attached.", artifact.Name, artifact.ContentType), artifact)
+	}
+
+	if len(expect) > 0 {
+		result.Assertions = evaluateExpectations(result, expect)
+		for _, ar := range result.Assertions {
+			sinfo.Context.appendExecutionLog(execution, fmt.Sprintf("system::assertion::%s", name), ar.describe(), ar)
+			if !ar.Passed && result.Success {
+				result.Success = false
+				result.ErrorCode = ErrorCodeAssertion
+			}
+		}
+
+		if result.ErrorCode == ErrorCodeAssertion {
+			sinfo.Context.appendExecutionLog(execution, fmt.Sprintf("system::%s::%s", kind, name), fmt.Sprintf("Action '%s' failed: expectation not met.", action), nil)
+		}
+	}
+
+	if !result.Success {
+		sinfo.markFailed()
+	}
+}
+
+// failAction records an action that could not be executed and marks the
+// session as failed.
+func failAction(sinfo *SessionInfo, execution int, kind, name, action string, err error) {
+	sinfo.Context.appendExecutionLog(execution, fmt.Sprintf("system::%s::%s", kind, name), fmt.Sprintf("Action '%s' failed: %s", action, err.Error()), &ActionResultData{Action: action, ErrorCode: errorCodeOf(err)})
+	sinfo.markFailed()
+}
+
+// executionError is returned by the action execution paths and carries the
+// HTTP status that should be reported back to the client.
+type executionError struct {
+	Status  int
+	Code    ErrorCode
+	Message string
+	// RetryAfter is sent as Retry-After header if the client may try again
+	// later, e.g. once an open circuit breaker allows calls again.
+	RetryAfter time.Duration
+}
+
+func (e *executionError) Error() string {
+	return e.Message
+}
+
+func newExecutionError(status int, message string) *executionError {
+	return newCodedExecutionError(status, ErrorCodeInternal, message)
+}
+
+func newCodedExecutionError(status int, code ErrorCode, message string) *executionError {
+	return &executionError{Status: status, Code: code, Message: message}
+}
+
+// errorCodeOf returns the error code of an execution error.
+func errorCodeOf(err error) ErrorCode {
+	var execErr *executionError
+	if errors.As(err, &execErr) {
+		return execErr.Code
+	}
+	return ErrorCodeInternal
+}
+
+func writeExecutionError(w http.ResponseWriter, err error) {
+	var execErr *executionError
+	if errors.As(err, &execErr) {
+		w.Header().Set("X-Babylon-Error-Code", string(execErr.Code))
+		if execErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(execErr.RetryAfter.Seconds()))))
+		}
+		http.Error(w, execErr.Message, execErr.Status)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// lookupExecutionSession resolves the session id of an execution request.
+func (s *Server) lookupExecutionSession(sid string) (*SessionInfo, error) {
+	if len(sid) < 1 {
+		return nil, newExecutionError(http.StatusBadRequest, "missing session id")
+	}
+
+	id, err := uuid.Parse(sid)
+	if err != nil {
+		return nil, newExecutionError(http.StatusBadRequest, fmt.Sprintf("malformed session id: %s", err.Error()))
+	}
+
+	sinfo := s.sessions.getSession(id)
+	if sinfo == nil {
+		return nil, newExecutionError(http.StatusBadRequest, "unknown session id")
+	}
+
+	return sinfo, nil
+}
+
+// forwardExecution sends the execution request to the extension. Depending on
+// the retry policy failed attempts are repeated until the server shuts down.
+// Every attempt is logged in the session context together with the redacted
+// parameters.
+func (s *Server) forwardExecution(sinfo *SessionInfo, execution int, kind, name, actionURL, action string, params map[string]any, payload []byte, policy retryPolicy) (*ExecutionResult, error) {
+	logType := fmt.Sprintf("system::%s::%s", kind, name)
+	breaker := s.breakers.get(kind, name)
+
+	_, vars := sinfo.Context.snapshotReferences()
+	logParams := s.redactParameters(params, s.secretValues(vars))
+
+	for attempt := 1; ; attempt++ {
+		if !breaker.allow() {
+			sinfo.Context.appendExecutionLog(execution, logType, fmt.Sprintf("Action '%s' not executed. Circuit breaker of %s '%s' is open.", action, kind, name), &ActionResultData{Action: action, ErrorCode: ErrorCodeCircuitOpen})
+			err := newCodedExecutionError(http.StatusServiceUnavailable, ErrorCodeCircuitOpen, fmt.Sprintf("circuit breaker of %s '%s' is open", kind, name))
+			err.RetryAfter = breaker.retryAfter()
+			return nil, err
+		}
+
+		requestData := &ActionRequestData{Action: action, Attempt: attempt, Parameters: logParams}
+		if policy.MaxAttempts > 1 {
+			sinfo.Context.appendExecutionLog(execution, logType, fmt.Sprintf("Executing action '%s' (attempt %d/%d).", action, attempt, policy.MaxAttempts), requestData)
+		} else {
+			sinfo.Context.appendExecutionLog(execution, logType, fmt.Sprintf("Executing action '%s'.", action), requestData)
+		}
+
+		start := time.Now()
+		result, err := s.postExecution(actionURL, payload)
+		s.observeExtensionCall(kind, name, start)
+		breaker.record(err == nil)
+		retry, reason := policy.shouldRetry(result, err)
+		if !retry || attempt >= policy.MaxAttempts {
+			return result, err
+		}
+
+		delay := policy.backoff(attempt)
+		s.logger.With("session", sinfo.UUID.String(), kind, name, "action", action, "attempt", attempt, "reason", reason).Info("Retrying action.")
+		sinfo.Context.appendExecutionLog(execution, logType, fmt.Sprintf("Attempt %d/%d of action '%s' failed (%s). Retrying in %s.", attempt, policy.MaxAttempts, action, reason, delay), nil)
+		if !waitBackoff(delay, s.draining) {
+			sinfo.Context.appendExecutionLog(execution, logType, fmt.Sprintf("Action '%s' not retried. Server is shutting down.", action), nil)
+			return result, err
+		}
+	}
+}
+
+const defaultExecutionTimeout = time.Minute
+
+// executionTimeout is the time an extension may take to answer an execution
+// request. A timeout counts as transport error.
+func (s *Server) executionTimeout() time.Duration {
+	if s.config.IsSet("execution.timeout") {
+		return s.config.GetDuration("execution.timeout")
+	}
+	return defaultExecutionTimeout
+}
+
+// postExecution sends the execution request to the extension. Server errors
+// of the extension are transport errors even if the body is a valid result.
+func (s *Server) postExecution(actionURL string, payload []byte) (*ExecutionResult, error) {
+	client := &http.Client{Timeout: s.executionTimeout()}
+	resp, err := client.Post(actionURL, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, newCodedExecutionError(http.StatusInternalServerError, ErrorCodeTransport, err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newCodedExecutionError(http.StatusInternalServerError, ErrorCodeTransport, err.Error())
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, newCodedExecutionError(http.StatusInternalServerError, ErrorCodeTransport, fmt.Sprintf("extension responded with %s", resp.Status))
+	}
+
+	var result ExecutionResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, newCodedExecutionError(http.StatusFailedDependency, ErrorCodeInvalidResponse, err.Error())
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	expectEquals    = "equals"
+	expectNotEquals = "notEquals"
+	expectMatches   = "matches"
+	expectContains  = "contains"
+	expectExists    = "exists"
+	expectGreater   = "gt"
+	expectGreaterEq = "gte"
+	expectLess      = "lt"
+	expectLessEq    = "lte"
+)
+
+// Expectation is an assertion that the server evaluates against the result
+// of an action. Path is a JSON path into the result, e.g. "$.data.orderId"
+// or "$.message". Op defaults to equals.
+type Expectation struct {
+	Path  string `json:"path"`
+	Op    string `json:"op"`
+	Value any    `json:"value,omitempty"`
+}
+
+// AssertionResult records the outcome of a single expectation.
+type AssertionResult struct {
+	Path     string `json:"path"`
+	Op       string `json:"op"`
+	Expected any    `json:"expected,omitempty"`
+	Actual   any    `json:"actual,omitempty"`
+	Passed   bool   `json:"passed"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func (e Expectation) operator() string {
+	if e.Op == "" {
+		return expectEquals
+	}
+	return e.Op
+}
+
+// validateExpectations checks the expectations before an action is executed.
+func validateExpectations(expect []Expectation) error {
+	for i, e := range expect {
+		if _, err := parsePath(e.Path); err != nil {
+			return fmt.Errorf("expectation %d: %s", i, err.Error())
+		}
+
+		switch e.operator() {
+		case expectEquals, expectNotEquals, expectContains, expectExists:
+		case expectMatches:
+			pattern, ok := e.Value.(string)
+			if !ok {
+				return fmt.Errorf("expectation %d: regular expression must be a string", i)
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("expectation %d: %s", i, err.Error())
+			}
+		case expectGreater, expectGreaterEq, expectLess, expectLessEq:
+			if _, ok := toNumber(e.Value); !ok {
+				return fmt.Errorf("expectation %d: '%s' requires a numeric value", i, e.Op)
+			}
+		default:
+			return fmt.Errorf("expectation %d: unknown operator '%s'", i, e.Op)
+		}
+	}
+	return nil
+}
+
+// evaluateExpectations checks all expectations against the action result.
+func evaluateExpectations(result *ExecutionResult, expect []Expectation) []AssertionResult {
+	doc := normalizeJSON(result)
+
+	assertions := make([]AssertionResult, 0, len(expect))
+	for _, e := range expect {
+		assertions = append(assertions, evaluateExpectation(doc, e))
+	}
+	return assertions
+}
+
+func evaluateExpectation(doc any, e Expectation) AssertionResult {
+	ar := AssertionResult{
+		Path:     e.Path,
+		Op:       e.operator(),
+		Expected: normalizeJSON(e.Value),
+	}
+
+	actual, found, err := lookupPath(doc, e.Path)
+	if err != nil {
+		ar.Reason = err.Error()
+		return ar
+	}
+	ar.Actual = actual
+
+	if ar.Op == expectExists {
+		want := true
+		if b, ok := e.Value.(bool); ok {
+			want = b
+		}
+		ar.Passed = found == want
+		if !ar.Passed {
+			ar.Reason = fmt.Sprintf("path exists: %t", found)
+		}
+		return ar
+	}
+
+	if !found {
+		ar.Reason = "path not found"
+		return ar
+	}
+
+	switch ar.Op {
+	case expectEquals:
+		ar.Passed = reflect.DeepEqual(actual, ar.Expected)
+	case expectNotEquals:
+		ar.Passed = !reflect.DeepEqual(actual, ar.Expected)
+	case expectMatches:
+		pattern, _ := e.Value.(string)
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			ar.Reason = err.Error()
+			return ar
+		}
+		ar.Passed = re.MatchString(valueString(actual))
+	case expectContains:
+		ar.Passed = containsValue(actual, ar.Expected)
+	case expectGreater, expectGreaterEq, expectLess, expectLessEq:
+		a, ok := toNumber(actual)
+		if !ok {
+			ar.Reason = "actual value is not numeric"
+			return ar
+		}
+		b, _ := toNumber(e.Value)
+		switch ar.Op {
+		case expectGreater:
+			ar.Passed = a > b
+		case expectGreaterEq:
+			ar.Passed = a >= b
+		case expectLess:
+			ar.Passed = a < b
+		case expectLessEq:
+			ar.Passed = a <= b
+		}
+	default:
+		ar.Reason = fmt.Sprintf("unknown operator '%s'", ar.Op)
+	}
+
+	return ar
+}
+
+// describe renders the assertion for the session log.
+func (ar AssertionResult) describe() string {
+	expected, _ := json.Marshal(ar.Expected)
+	if ar.Op == expectExists {
+		expected = []byte("")
+	}
+	text := strings.TrimSpace(fmt.Sprintf("%s %s %s", ar.Path, ar.Op, expected))
+	if ar.Passed {
+		return fmt.Sprintf("Assertion passed: %s", text)
+	}
+
+	if ar.Reason != "" {
+		return fmt.Sprintf("Assertion failed: %s (%s)", text, ar.Reason)
+	}
+	actual, _ := json.Marshal(ar.Actual)
+	return fmt.Sprintf("Assertion failed: %s (actual: %s)", text, actual)
+}
+
+// normalizeJSON converts a value into the generic representation used by
+// encoding/json so that values of different Go types can be compared.
+func normalizeJSON(v any) any {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func toNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func valueString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
+
+func containsValue(actual, expected any) bool {
+	switch a := actual.(type) {
+	case string:
+		return strings.Contains(a, valueString(expected))
+	case []any:
+		for _, item := range a {
+			if reflect.DeepEqual(item, expected) {
+				return true
+			}
+		}
+	case map[string]any:
+		if key, ok := expected.(string); ok {
+			_, exists := a[key]
+			return exists
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLookupPath(t *testing.T) {
+	doc := normalizeJSON(map[string]any{
+		"data": map[string]any{
+			"items":      []any{map[string]any{"id": "first"}, map[string]any{"id": "second"}},
+			"order name": "A-1",
+		},
+	})
+
+	tests := []struct {
+		path  string
+		want  any
+		found bool
+	}{
+		{"$.data.items[0].id", "first", true},
+		{"data.items[-1].id", "second", true},
+		{"$.data['order name']", "A-1", true},
+		{"$.data.items.length", float64(2), true},
+		{"$.data.missing", nil, false},
+		{"$.data.items[5]", nil, false},
+	}
+
+	for _, tc := range tests {
+		got, found, err := lookupPath(doc, tc.path)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", tc.path, err)
+			continue
+		}
+		if found != tc.found || got != tc.want {
+			t.Errorf("Path %s: expected (%v, %t), got (%v, %t)", tc.path, tc.want, tc.found, got, found)
+		}
+	}
+
+	if _, _, err := lookupPath(doc, "$.data.items[x]"); err == nil {
+		t.Errorf("Expected error for invalid index")
+	}
+}
+
+func TestEvaluateExpectations(t *testing.T) {
+	result := &ExecutionResult{
+		Success: true,
+		Message: "order A-42 created",
+		Data:    map[string]any{"orderId": "A-42", "total": 99.5, "tags": []string{"new"}},
+	}
+
+	expect := []Expectation{
+		{Path: "$.data.orderId", Value: "A-42"},
+		{Path: "$.message", Op: expectMatches, Value: "^order A-\\d+"},
+		{Path: "$.data.total", Op: expectGreater, Value: 50},
+		{Path: "$.data.total", Op: expectLessEq, Value: "99.5"},
+		{Path: "$.data.tags", Op: expectContains, Value: "new"},
+		{Path: "$.data.missing", Op: expectExists, Value: false},
+		{Path: "$.data.orderId", Op: expectNotEquals, Value: "A-42"},
+		{Path: "$.data.nothing", Value: 1},
+	}
+
+	assertions := evaluateExpectations(result, expect)
+	expected := []bool{true, true, true, true, true, true, false, false}
+	for i, want := range expected {
+		if assertions[i].Passed != want {
+			t.Errorf("Expectation %d (%s %s): expected passed=%t, got %+v", i, expect[i].Path, expect[i].Op, want, assertions[i])
+		}
+	}
+	if assertions[7].Reason != "path not found" {
+		t.Errorf("Expected reason for missing path, got %q", assertions[7].Reason)
+	}
+}
+
+func TestValidateExpectations(t *testing.T) {
+	invalid := [][]Expectation{
+		{{Path: "$.data", Op: "approximately"}},
+		{{Path: "$.data", Op: expectMatches, Value: "("}},
+		{{Path: "$.data", Op: expectGreater, Value: "many"}},
+		{{Path: "$.data[", Op: expectEquals}},
+	}
+	for i, expect := range invalid {
+		if err := validateExpectations(expect); err == nil {
+			t.Errorf("Expected validation error for case %d", i)
+		}
+	}
+
+	if err := validateExpectations([]Expectation{{Path: "$.message", Value: "ok"}}); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+}
+
+func TestExecuteDriverActionFailedExpectation(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "expectDriver", &testDriver{respond: func(w http.ResponseWriter, req DriverExecutionRequest) {
+		w.Write([]byte(`{"success": true, "message": "ok", "data": {"count": 2}}`))
+	}})
+
+	sinfo := newTestSession(s)
+	result, err := s.executeDriverAction(sinfo, DriverExecutionRequest{
+		Session:    sinfo.UUID.String(),
+		DriverType: "expectDriver",
+		Action:     "count",
+		Expect:     []Expectation{{Path: "$.data.count", Op: expectGreaterEq, Value: 3}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Success || result.ErrorCode != ErrorCodeAssertion {
+		t.Errorf("Expected failed expectation to fail the action, got %+v", result)
+	}
+	if sinfo.status() != sessionStatusFailed {
+		t.Errorf("Expected session to be marked failed, got %q", sinfo.status())
+	}
+
+	assertionEntries := 0
+	for _, msg := range sinfo.Context.Log {
+		if _, ok := msg.Data.(AssertionResult); ok {
+			assertionEntries++
+		}
+	}
+	if assertionEntries != 1 {
+		t.Errorf("Expected one assertion entry in session log, got %d", assertionEntries)
+	}
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const gherkinStepUndefined = "undefined"
+
+// StepBinding maps the text of Gherkin steps to an actor or driver action.
+// Capture groups of the pattern are available as ${args.1} or by name; data
+// tables and doc strings as ${args.table}, ${args.rows}, ${args.docString} and
+// ${args.mediaType}:
+//
+//	bindings:
+//	  - pattern: '^I log in as "(?P<user>[^"]+)"$'
+//	    actor: odoo_user
+//	    action: login
+//	    parameters:
+//	      user: ${args.user}
+//	      password: ${vars.password}
+type StepBinding struct {
+	Pattern string `json:"pattern"`
+	ScenarioStep
+
+	re *regexp.Regexp
+}
+
+type stepBindingFile struct {
+	Bindings []StepBinding `json:"bindings"`
+}
+
+type FeatureResult struct {
+	Name      string                  `json:"name"`
+	Verdict   string                  `json:"verdict"`
+	Scenarios []FeatureScenarioResult `json:"scenarios"`
+}
+
+type FeatureScenarioResult struct {
+	Name    string              `json:"name"`
+	Tags    []string            `json:"tags,omitempty"`
+	Session string              `json:"session"`
+	Verdict string              `json:"verdict"`
+	Steps   []FeatureStepResult `json:"steps"`
+}
+
+// FeatureStepResult is the outcome of a single Gherkin step and the action it
+// was bound to.
+type FeatureStepResult struct {
+	Keyword string             `json:"keyword"`
+	Text    string             `json:"text"`
+	Line    int                `json:"line"`
+	Status  string             `json:"status"`
+	Message string             `json:"message,omitempty"`
+	Action  *BatchActionResult `json:"action,omitempty"`
+}
+
+func parseStepBindings(data []byte) ([]StepBinding, error) {
+	var f stepBindingFile
+	if err := decodeYAML(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid step bindings: %s", err.Error())
+	}
+
+	for i := range f.Bindings {
+		b := &f.Bindings[i]
+		if b.Pattern == "" {
+			return nil, fmt.Errorf("binding %d: missing pattern", i+1)
+		}
+		re, err := regexp.Compile(b.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("binding %d: invalid pattern: %s", i+1, err.Error())
+		}
+		b.re = re
+
+		if err := b.ScenarioStep.validate(); err != nil {
+			return nil, fmt.Errorf("binding %d: %s", i+1, err.Error())
+		}
+	}
+	return f.Bindings, nil
+}
+
+// loadStepBindings reads all binding files configured in gherkin.bindings.
+// Relative paths are resolved against the config file. The files are read on
+// every run so that changes apply without a restart. It fails if no bindings
+// are configured at all.
+func (s *Server) loadStepBindings() ([]StepBinding, error) {
+	var bindings []StepBinding
+	for _, file := range s.config.GetStringSlice("gherkin.bindings") {
+		file = s.resolveConfigPath("gherkin.bindings", file)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := parseStepBindings(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err.Error())
+		}
+		bindings = append(bindings, b...)
+	}
+
+	if len(bindings) == 0 {
+		return nil, errors.New("no step bindings configured")
+	}
+	return bindings, nil
+}
+
+// matchStepBinding returns the first binding matching the step text together
+// with the arguments of the step.
+func matchStepBinding(bindings []StepBinding, step GherkinStep) (*StepBinding, map[string]any) {
+	for i := range bindings {
+		b := &bindings[i]
+		match := b.re.FindStringSubmatch(step.Text)
+		if match == nil {
+			continue
+		}
+
+		args := make(map[string]any, len(match))
+		for j, m := range match {
+			args[strconv.Itoa(j)] = m
+		}
+		for j, name := range b.re.SubexpNames() {
+			if name != "" {
+				args[name] = match[j]
+			}
+		}
+		if step.Table != nil {
+			args["rows"] = step.Table
+			args["table"] = tableRecords(step.Table)
+		}
+		if step.DocString != "" {
+			args["docString"] = step.DocString
+		}
+		if step.MediaType != "" {
+			args["mediaType"] = step.MediaType
+		}
+		return b, args
+	}
+	return nil, nil
+}
+
+// tableRecords converts a data table into one map per row keyed by the header.
+func tableRecords(table [][]string) []map[string]string {
+	if len(table) == 0 {
+		return nil
+	}
+
+	records := make([]map[string]string, 0, len(table)-1)
+	for _, row := range table[1:] {
+		record := make(map[string]string, len(row))
+		for i, cell := range row {
+			if i < len(table[0]) {
+				record[table[0][i]] = cell
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// batchAction creates the action for a matched step. Only the args namespace is
+// resolved here, all other references are resolved by the session later on.
+func (b *StepBinding) batchAction(args map[string]any) (BatchAction, error) {
+	scope := newPartialScope(map[string]any{"args": args})
+	action := b.ScenarioStep.batchAction()
+
+	name, err := scope.resolveString(action.Action)
+	if err != nil {
+		return action, err
+	}
+	action.Action = valueString(name)
+
+	if action.Parameters != nil {
+		params, err := scope.resolve(normalizeJSON(action.Parameters))
+		if err != nil {
+			return action, err
+		}
+		action.Parameters, _ = params.(map[string]any)
+	}
+
+	if action.Expect != nil {
+		expect := make([]Expectation, len(action.Expect))
+		for i, e := range action.Expect {
+			value, err := scope.resolve(normalizeJSON(e.Value))
+			if err != nil {
+				return action, err
+			}
+			e.Value = value
+			expect[i] = e
+		}
+		action.Expect = expect
+	}
+	return action, nil
+}
+
+// loadFeatureFromDirectory loads a feature file relative to the scenario
+// directory.
+func (s *Server) loadFeatureFromDirectory(file string) (*Feature, error) {
+	path, err := s.resolveScenarioPath(file)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFeature(string(data))
+}
+
+// runFeature runs every scenario and every example row of the feature in its
+// own session.
+func (s *Server) runFeature(f *Feature, bindings []StepBinding) *FeatureResult {
+	result := &FeatureResult{Name: f.Name, Verdict: verdictPassed}
+	for _, c := range f.cases() {
+		sr := s.runFeatureScenario(f, c, bindings)
+		if sr.Verdict != verdictPassed {
+			result.Verdict = verdictFailed
+		}
+		result.Scenarios = append(result.Scenarios, sr)
+	}
+
+	s.logger.With("feature", f.Name, "scenarios", len(result.Scenarios), "verdict", result.Verdict).Info("Feature finished.")
+	return result
+}
+
+func (s *Server) runFeatureScenario(f *Feature, c gherkinCase, bindings []StepBinding) FeatureScenarioResult {
+	sinfo := s.newSession(fmt.Sprintf("%s: %s", f.Name, c.Name), c.Tags)
+	result := FeatureScenarioResult{
+		Name:    c.Name,
+		Tags:    c.Tags,
+		Session: sinfo.UUID.String(),
+		Steps:   make([]FeatureStepResult, 0, len(c.Steps)),
+	}
+
+	sinfo.Context.appendLogData("system::gherkin::scenario", fmt.Sprintf("Scenario: %s", c.Name), map[string]any{
+		"feature":  f.Name,
+		"scenario": c.Name,
+	})
+
+	failed := false
+	for _, step := range c.Steps {
+		sr := FeatureStepResult{Keyword: step.Keyword, Text: step.Text, Line: step.Line}
+		if failed {
+			sr.Status = batchStatusSkipped
+			sr.Message = "skipped after previous failure"
+			result.Steps = append(result.Steps, sr)
+			continue
+		}
+
+		sinfo.Context.setGherkinStep(step.Line)
+		sinfo.Context.appendLogData("system::gherkin::step", fmt.Sprintf("%s %s", step.Keyword, step.Text), map[string]any{
+			"feature":  f.Name,
+			"scenario": c.Name,
+			"line":     step.Line,
+		})
+		s.runFeatureStep(sinfo, step, bindings, &sr)
+		sinfo.Context.setGherkinStep(0)
+		if sr.Status != batchStatusSuccess {
+			failed = true
+		}
+		result.Steps = append(result.Steps, sr)
+	}
+
+	result.Verdict = sessionVerdict(sinfo)
+
+	sinfo.Context.appendLogData("system::gherkin::scenario", fmt.Sprintf("Scenario '%s' finished: %s.", c.Name, result.Verdict), map[string]any{
+		"feature":  f.Name,
+		"scenario": c.Name,
+		"verdict":  result.Verdict,
+	})
+	s.sessions.removeSession(sinfo.UUID)
+	return result
+}
+
+func (s *Server) runFeatureStep(sinfo *SessionInfo, step GherkinStep, bindings []StepBinding, sr *FeatureStepResult) {
+	binding, args := matchStepBinding(bindings, step)
+	if binding == nil {
+		sr.Status = gherkinStepUndefined
+		sr.Message = "no step binding matches the step text"
+		sinfo.Context.appendLog("system::gherkin::step", fmt.Sprintf("Step '%s' is undefined.", step.Text))
+		sinfo.markFailed()
+		return
+	}
+
+	action, err := binding.batchAction(args)
+	if err != nil {
+		sr.Status = batchStatusError
+		sr.Message = err.Error()
+		sinfo.Context.appendLog("system::gherkin::step", fmt.Sprintf("Binding of step '%s' failed: %s", step.Text, err.Error()))
+		sinfo.markFailed()
+		return
+	}
+
+	r := s.runBatchAction(sinfo, action)
+	sr.Status = r.Status
+	sr.Message = r.Message
+	sr.Action = &r
+}
+
+// handleFeatureRun runs a feature that is either posted as body or referenced
+// by the file query parameter relative to the scenario directory.
+func (s *Server) handleFeatureRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+	if !s.acceptingSessions(w) {
+		return
+	}
+
+	var f *Feature
+	var err error
+	if file := r.URL.Query().Get("file"); file != "" {
+		f, err = s.loadFeatureFromDirectory(file)
+	} else {
+		var data []byte
+		data, err = io.ReadAll(r.Body)
+		if err == nil {
+			f, err = parseFeature(string(data))
+		}
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid feature: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	bindings, err := s.loadStepBindings()
+	if err != nil {
+		s.logger.With("error", err).Error("Loading step bindings failed.")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.With("feature", f.Name, "scenarios", len(f.Scenarios)).Info("Feature run request received.")
+	result := s.runFeature(f, bindings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func printFeatureResult(w io.Writer, result *FeatureResult) {
+	fmt.Fprintf(w, "%s Feature: %s\n", strings.ToUpper(result.Verdict), result.Name)
+	for _, sc := range result.Scenarios {
+		fmt.Fprintf(w, "  %s Scenario: %s (session %s)\n", strings.ToUpper(sc.Verdict), sc.Name, sc.Session)
+		for _, step := range sc.Steps {
+			fmt.Fprintf(w, "    [%s] %s %s", step.Status, step.Keyword, step.Text)
+			if step.Status != batchStatusSuccess && step.Message != "" {
+				fmt.Fprintf(w, ": %s", step.Message)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testBindings = `
+bindings:
+  - pattern: '^I open the shop$'
+    driver: scenarioDriver
+    action: open
+  - pattern: '^I order "(?P<product>[^"]+)"$'
+    id: order
+    driver: scenarioDriver
+    action: create
+    parameters:
+      product: ${args.product}
+    expect:
+      - path: $.data.product
+        value: ${args.1}
+  - pattern: '^I send the note:$'
+    driver: scenarioDriver
+    action: note
+    parameters:
+      text: ${args.docString}
+      product: ${steps.order.data.product}
+  - pattern: '^the order contains:$'
+    driver: scenarioDriver
+    action: fail
+    parameters:
+      items: ${args.table}
+      rows: ${args.rows}
+`
+
+func writeTestBindings(t *testing.T, s *Server) {
+	file := filepath.Join(t.TempDir(), "steps.yaml")
+	os.WriteFile(file, []byte(testBindings), 0o644)
+
+	s.config.Set("gherkin.bindings", []string{file})
+}
+
+func TestLoadStepBindingsRelativeToConfig(t *testing.T) {
+	s := newTestServer(t)
+	dir := writeConfigFiles(t, map[string]string{
+		"babylon.yaml":    "gherkin:\n  bindings: [steps/shop.yaml]\n",
+		"steps/shop.yaml": testBindings,
+	})
+	if err := s.loadConfig(configOptions{File: filepath.Join(dir, "babylon.yaml")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	bindings, err := s.loadStepBindings()
+	if err != nil {
+		t.Fatalf("Expected bindings to be resolved relative to the config file: %v", err)
+	}
+	if len(bindings) == 0 {
+		t.Errorf("Expected bindings to be loaded")
+	}
+}
+
+func TestParseStepBindingsErrors(t *testing.T) {
+	invalid := map[string]string{
+		"missing pattern": "bindings:\n  - driver: d\n    action: a\n",
+		"bad pattern":     "bindings:\n  - pattern: '('\n    driver: d\n    action: a\n",
+		"missing action":  "bindings:\n  - pattern: x\n    driver: d\n",
+		"unknown field":   "bindings:\n  - pattern: x\n    driver: d\n    action: a\n    param: {}\n",
+	}
+
+	for name, data := range invalid {
+		if _, err := parseStepBindings([]byte(data)); err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+}
+
+func TestStepBindingAction(t *testing.T) {
+	bindings, err := parseStepBindings([]byte(testBindings))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	b, args := matchStepBinding(bindings, GherkinStep{Text: "I send the note:", DocString: "hello"})
+	if b == nil {
+		t.Fatalf("Expected step to match a binding")
+	}
+
+	action, err := b.batchAction(args)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if action.Parameters["text"] != "hello" {
+		t.Errorf("Expected doc string argument, got %v", action.Parameters["text"])
+	}
+	if action.Parameters["product"] != "${steps.order.data.product}" {
+		t.Errorf("Expected step reference to be kept, got %v", action.Parameters["product"])
+	}
+
+	if b, _ := matchStepBinding(bindings, GherkinStep{Text: "I fly away"}); b != nil {
+		t.Errorf("Expected no binding for unknown step")
+	}
+}
+
+func TestRunFeature(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "scenarioDriver", nil)
+	writeTestBindings(t, s)
+
+	f, err := parseFeature(testFeature + "\n  Scenario: Unknown\n    Given I fly away\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bindings, err := s.loadStepBindings()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result := s.runFeature(f, bindings)
+	if result.Verdict != verdictFailed || len(result.Scenarios) != 4 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	expected := []string{verdictFailed, verdictPassed, verdictPassed, verdictFailed}
+	for i, verdict := range expected {
+		if result.Scenarios[i].Verdict != verdict {
+			t.Errorf("Expected scenario %d to be %s, got %s: %+v", i, verdict, result.Scenarios[i].Verdict, result.Scenarios[i].Steps)
+		}
+	}
+
+	note := result.Scenarios[2].Steps[2]
+	data, _ := note.Action.Data.(map[string]any)
+	if data["product"] != "pencil" || data["text"] != "Please deliver pencil." {
+		t.Errorf("Expected arguments and step references to be resolved, got %v", note.Action.Data)
+	}
+	if result.Scenarios[3].Steps[1].Status != gherkinStepUndefined {
+		t.Errorf("Expected undefined step, got %+v", result.Scenarios[3].Steps[1])
+	}
+
+	finished := s.sessions.getFinishedSession(uuid.MustParse(result.Scenarios[1].Session))
+	if finished == nil || finished.Name != "Ordering: Order pen (example #1)" {
+		t.Fatalf("Expected example session in history, got %+v", finished)
+	}
+	steps := 0
+	for _, msg := range finished.Context.Log {
+		if msg.MessageType == "system::gherkin::step" {
+			steps++
+		}
+	}
+	if steps != 3 {
+		t.Errorf("Expected 3 gherkin step log entries, got %d", steps)
+	}
+}
+
+func TestHandleFeatureRun(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "scenarioDriver", nil)
+	writeTestBindings(t, s)
+
+	body := "Feature: Shop\n  Scenario: Open\n    Given I open the shop\n"
+	w := httptest.NewRecorder()
+	s.handleFeatureRun(w, httptest.NewRequest(http.MethodPost, "/features/run", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result FeatureResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if result.Verdict != verdictPassed {
+		t.Errorf("Expected passed verdict, got %+v", result)
+	}
+
+	var out bytes.Buffer
+	printFeatureResult(&out, &result)
+	if !strings.HasPrefix(out.String(), "PASSED Feature: Shop") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.handleFeatureRun(w, httptest.NewRequest(http.MethodPost, "/features/run", strings.NewReader("Scenario: x")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid feature, got %d", http.StatusBadRequest, w.Code)
+	}
+}
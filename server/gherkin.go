@@ -0,0 +1,346 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Feature is a parsed Gherkin feature file.
+type Feature struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Background  []GherkinStep     `json:"background,omitempty"`
+	Scenarios   []GherkinScenario `json:"scenarios"`
+}
+
+// GherkinScenario is a Scenario or a Scenario Outline with its examples.
+// Background holds the background steps of the rule the scenario belongs to.
+type GherkinScenario struct {
+	Name       string            `json:"name"`
+	Tags       []string          `json:"tags,omitempty"`
+	Line       int               `json:"line"`
+	Outline    bool              `json:"outline,omitempty"`
+	Background []GherkinStep     `json:"background,omitempty"`
+	Steps      []GherkinStep     `json:"steps"`
+	Examples   []GherkinExamples `json:"examples,omitempty"`
+}
+
+type GherkinExamples struct {
+	Name   string     `json:"name,omitempty"`
+	Tags   []string   `json:"tags,omitempty"`
+	Header []string   `json:"header"`
+	Rows   [][]string `json:"rows"`
+}
+
+type GherkinStep struct {
+	Keyword   string     `json:"keyword"`
+	Text      string     `json:"text"`
+	Line      int        `json:"line"`
+	Table     [][]string `json:"table,omitempty"`
+	DocString string     `json:"docString,omitempty"`
+	MediaType string     `json:"mediaType,omitempty"`
+}
+
+// gherkinCase is a single runnable scenario. Scenario outlines are expanded
+// into one case per example row.
+type gherkinCase struct {
+	Name  string
+	Tags  []string
+	Steps []GherkinStep
+}
+
+var gherkinStepKeywords = []string{"Given ", "When ", "Then ", "And ", "But ", "* "}
+
+type gherkinParser struct {
+	feature        *Feature
+	pendingTags    []string
+	steps          *[]GherkinStep
+	scenario       *GherkinScenario
+	examples       *GherkinExamples
+	inFeature      bool
+	inRule         bool
+	ruleBackground []GherkinStep
+	docString      *strings.Builder
+	docDelim       string
+	docIndent      int
+}
+
+func gherkinError(line int, format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// parseFeature parses the Gherkin feature file. It supports backgrounds,
+// scenario outlines with examples, tags, data tables and doc strings.
+func parseFeature(data string) (*Feature, error) {
+	p := &gherkinParser{feature: &Feature{}}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if err := p.parseLine(scanner.Text(), lineNo); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if p.docString != nil {
+		return nil, gherkinError(lineNo, "unterminated doc string")
+	}
+	if p.feature.Name == "" {
+		return nil, fmt.Errorf("missing 'Feature:' declaration")
+	}
+	p.feature.Description = strings.TrimSpace(p.feature.Description)
+
+	for _, sc := range p.feature.Scenarios {
+		if sc.Outline && len(sc.Examples) == 0 {
+			return nil, gherkinError(sc.Line, "scenario outline '%s' has no examples", sc.Name)
+		}
+	}
+	return p.feature, nil
+}
+
+func (p *gherkinParser) parseLine(raw string, lineNo int) error {
+	line := strings.TrimSpace(raw)
+
+	if p.docString != nil {
+		if line == p.docDelim {
+			steps := *p.steps
+			steps[len(steps)-1].DocString = strings.TrimSuffix(p.docString.String(), "\n")
+			p.docString = nil
+			return nil
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " \t"))
+		if indent > p.docIndent {
+			indent = p.docIndent
+		}
+		p.docString.WriteString(raw[indent:])
+		p.docString.WriteString("\n")
+		return nil
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(line, "@"):
+		p.pendingTags = append(p.pendingTags, strings.Fields(line)...)
+	case strings.HasPrefix(line, "Feature:"):
+		if p.inFeature {
+			return gherkinError(lineNo, "only one feature per file is supported")
+		}
+		p.inFeature = true
+		p.feature.Name = strings.TrimSpace(strings.TrimPrefix(line, "Feature:"))
+		p.feature.Tags = p.takeTags()
+	case strings.HasPrefix(line, "Rule:"):
+		p.takeTags()
+		p.inRule, p.ruleBackground = true, nil
+		p.steps, p.scenario, p.examples = nil, nil, nil
+	case strings.HasPrefix(line, "Background:"):
+		if p.inRule {
+			p.steps = &p.ruleBackground
+		} else {
+			p.steps = &p.feature.Background
+		}
+		p.scenario, p.examples = nil, nil
+	case hasAnyPrefix(line, "Scenario Outline:", "Scenario Template:"):
+		p.startScenario(line, lineNo, true)
+	case hasAnyPrefix(line, "Scenario:", "Example:"):
+		p.startScenario(line, lineNo, false)
+	case hasAnyPrefix(line, "Examples:", "Scenarios:"):
+		if p.scenario == nil || !p.scenario.Outline {
+			return gherkinError(lineNo, "examples without scenario outline")
+		}
+		p.scenario.Examples = append(p.scenario.Examples, GherkinExamples{
+			Name: strings.TrimSpace(line[strings.Index(line, ":")+1:]),
+			Tags: p.takeTags(),
+		})
+		p.examples = &p.scenario.Examples[len(p.scenario.Examples)-1]
+	case strings.HasPrefix(line, "|"):
+		return p.addTableRow(line, lineNo)
+	case hasAnyPrefix(line, `"""`, "```"):
+		if p.steps == nil || len(*p.steps) == 0 {
+			return gherkinError(lineNo, "doc string without step")
+		}
+		// the opening delimiter may be followed by a media type like """json
+		steps := *p.steps
+		steps[len(steps)-1].MediaType = strings.TrimSpace(line[3:])
+		p.docString = &strings.Builder{}
+		p.docDelim = line[:3]
+		p.docIndent = len(raw) - len(strings.TrimLeft(raw, " \t"))
+	default:
+		for _, kw := range gherkinStepKeywords {
+			if strings.HasPrefix(line, kw) {
+				if p.steps == nil {
+					return gherkinError(lineNo, "step outside of scenario or background")
+				}
+				if p.examples != nil {
+					return gherkinError(lineNo, "step after examples")
+				}
+				*p.steps = append(*p.steps, GherkinStep{
+					Keyword: strings.TrimSpace(kw),
+					Text:    strings.TrimSpace(line[len(kw):]),
+					Line:    lineNo,
+				})
+				return nil
+			}
+		}
+
+		if !p.inFeature {
+			return gherkinError(lineNo, "unexpected text before 'Feature:'")
+		}
+		if p.steps == nil {
+			p.feature.Description += line + "\n"
+		}
+	}
+	return nil
+}
+
+func (p *gherkinParser) startScenario(line string, lineNo int, outline bool) {
+	p.feature.Scenarios = append(p.feature.Scenarios, GherkinScenario{
+		Name:       strings.TrimSpace(line[strings.Index(line, ":")+1:]),
+		Tags:       p.takeTags(),
+		Line:       lineNo,
+		Outline:    outline,
+		Background: p.ruleBackground,
+	})
+	p.scenario = &p.feature.Scenarios[len(p.feature.Scenarios)-1]
+	p.steps = &p.scenario.Steps
+	p.examples = nil
+}
+
+func (p *gherkinParser) addTableRow(line string, lineNo int) error {
+	cells := parseTableRow(line)
+
+	if p.examples != nil {
+		if p.examples.Header == nil {
+			p.examples.Header = cells
+			return nil
+		}
+		if len(cells) != len(p.examples.Header) {
+			return gherkinError(lineNo, "example row has %d cells, expected %d", len(cells), len(p.examples.Header))
+		}
+		p.examples.Rows = append(p.examples.Rows, cells)
+		return nil
+	}
+
+	if p.steps == nil || len(*p.steps) == 0 {
+		return gherkinError(lineNo, "table without step")
+	}
+	steps := *p.steps
+	steps[len(steps)-1].Table = append(steps[len(steps)-1].Table, cells)
+	return nil
+}
+
+func (p *gherkinParser) takeTags() []string {
+	tags := p.pendingTags
+	p.pendingTags = nil
+	return tags
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTableRow splits a table row into its cells. "\|" escapes a pipe.
+func parseTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && (line[i+1] == '|' || line[i+1] == '\\'):
+			cell.WriteByte(line[i+1])
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// cases expands the feature into runnable scenarios. The background steps of
+// the feature and of the rule are prepended and outline placeholders like
+// <name> are replaced per example row.
+func (f *Feature) cases() []gherkinCase {
+	var cases []gherkinCase
+	for _, sc := range f.Scenarios {
+		tags := append(append([]string{}, f.Tags...), sc.Tags...)
+		if !sc.Outline {
+			cases = append(cases, gherkinCase{
+				Name:  sc.Name,
+				Tags:  tags,
+				Steps: append(sc.background(f), sc.Steps...),
+			})
+			continue
+		}
+
+		n := 0
+		for _, ex := range sc.Examples {
+			for _, row := range ex.Rows {
+				n++
+				values := make(map[string]string, len(ex.Header))
+				for i, h := range ex.Header {
+					values[h] = row[i]
+				}
+
+				steps := sc.background(f)
+				for _, step := range sc.Steps {
+					steps = append(steps, step.withExampleValues(values))
+				}
+
+				cases = append(cases, gherkinCase{
+					Name:  fmt.Sprintf("%s (example #%d)", replacePlaceholders(sc.Name, values), n),
+					Tags:  append(append([]string{}, tags...), ex.Tags...),
+					Steps: steps,
+				})
+			}
+		}
+	}
+	return cases
+}
+
+// background returns the background steps of the feature and the rule that
+// run before the scenario.
+func (sc GherkinScenario) background(f *Feature) []GherkinStep {
+	return append(append([]GherkinStep{}, f.Background...), sc.Background...)
+}
+
+func (s GherkinStep) withExampleValues(values map[string]string) GherkinStep {
+	out := s
+	out.Text = replacePlaceholders(s.Text, values)
+	out.DocString = replacePlaceholders(s.DocString, values)
+	if s.Table != nil {
+		out.Table = make([][]string, len(s.Table))
+		for i, row := range s.Table {
+			out.Table[i] = make([]string, len(row))
+			for j, cell := range row {
+				out.Table[i][j] = replacePlaceholders(cell, values)
+			}
+		}
+	}
+	return out
+}
+
+func replacePlaceholders(s string, values map[string]string) string {
+	for k, v := range values {
+		s = strings.ReplaceAll(s, "<"+k+">", v)
+	}
+	return s
+}
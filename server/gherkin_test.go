@@ -0,0 +1,165 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testFeature = `
+# comment
+@web
+Feature: Ordering
+  Customers can order products.
+
+  Background:
+    Given I open the shop
+
+  @smoke
+  Scenario: Simple order
+    When I order "book"
+    Then the order contains:
+      | product | amount |
+      | book    | 1      |
+
+  Scenario Outline: Order <product>
+    When I order "<product>"
+    And I send the note:
+      """
+      Please deliver <product>.
+      """
+
+    @regression
+    Examples:
+      | product |
+      | pen     |
+      | pencil  |
+`
+
+func TestParseFeature(t *testing.T) {
+	f, err := parseFeature(testFeature)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if f.Name != "Ordering" || f.Description != "Customers can order products." {
+		t.Errorf("Unexpected feature header %q / %q", f.Name, f.Description)
+	}
+	if diff := cmp.Diff([]string{"@web"}, f.Tags); diff != "" {
+		t.Errorf("Unexpected feature tags (-want +got):\n%s", diff)
+	}
+	if len(f.Background) != 1 || len(f.Scenarios) != 2 {
+		t.Fatalf("Unexpected feature structure %+v", f)
+	}
+
+	table := f.Scenarios[0].Steps[1].Table
+	if diff := cmp.Diff([][]string{{"product", "amount"}, {"book", "1"}}, table); diff != "" {
+		t.Errorf("Unexpected data table (-want +got):\n%s", diff)
+	}
+
+	outline := f.Scenarios[1]
+	if !outline.Outline || len(outline.Examples) != 1 || len(outline.Examples[0].Rows) != 2 {
+		t.Fatalf("Unexpected outline %+v", outline)
+	}
+	if outline.Steps[1].DocString != "Please deliver <product>." {
+		t.Errorf("Unexpected doc string %q", outline.Steps[1].DocString)
+	}
+}
+
+func TestFeatureCases(t *testing.T) {
+	f, err := parseFeature(testFeature)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cases := f.cases()
+	if len(cases) != 3 {
+		t.Fatalf("Expected 3 cases, got %d", len(cases))
+	}
+
+	c := cases[2]
+	if c.Name != "Order pencil (example #2)" {
+		t.Errorf("Unexpected case name %q", c.Name)
+	}
+	if diff := cmp.Diff([]string{"@web", "@regression"}, c.Tags); diff != "" {
+		t.Errorf("Unexpected case tags (-want +got):\n%s", diff)
+	}
+	if len(c.Steps) != 3 || c.Steps[0].Text != "I open the shop" {
+		t.Fatalf("Expected background to be prepended, got %+v", c.Steps)
+	}
+	if c.Steps[1].Text != `I order "pencil"` || c.Steps[2].DocString != "Please deliver pencil." {
+		t.Errorf("Expected placeholders to be replaced, got %+v", c.Steps[1:])
+	}
+}
+
+func TestParseFeatureDocStringMediaType(t *testing.T) {
+	f, err := parseFeature("Feature: x\n  Scenario: y\n    Given the payload\n      \"\"\"json\n      {\"a\": 1}\n      \"\"\"\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	step := f.Scenarios[0].Steps[0]
+	if step.MediaType != "json" || step.DocString != `{"a": 1}` {
+		t.Errorf("Unexpected doc string %q with media type %q", step.DocString, step.MediaType)
+	}
+}
+
+func TestFeatureRuleBackground(t *testing.T) {
+	f, err := parseFeature(`Feature: Rules
+  Background:
+    Given I open the shop
+
+  Scenario: Outside
+    When I browse
+
+  Rule: Members
+    Background:
+      Given I am logged in
+
+    Scenario: Inside
+      When I order
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var steps [][]string
+	for _, c := range f.cases() {
+		var texts []string
+		for _, step := range c.Steps {
+			texts = append(texts, step.Text)
+		}
+		steps = append(steps, texts)
+	}
+	want := [][]string{
+		{"I open the shop", "I browse"},
+		{"I open the shop", "I am logged in", "I order"},
+	}
+	if diff := cmp.Diff(want, steps); diff != "" {
+		t.Errorf("Expected rule background only for its scenarios (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseFeatureErrors(t *testing.T) {
+	invalid := map[string]string{
+		"no feature":          "Scenario: x\n  Given y\n",
+		"step outside":        "Feature: x\n  Given y\n",
+		"outline no examples": "Feature: x\n  Scenario Outline: y\n    Given <a>\n",
+		"examples no outline": "Feature: x\n  Scenario: y\n    Given z\n  Examples:\n    | a |\n",
+		"bad example row":     "Feature: x\n  Scenario Outline: y\n    Given <a>\n  Examples:\n    | a |\n    | 1 | 2 |\n",
+		"open doc string":     "Feature: x\n  Scenario: y\n    Given z\n    \"\"\"\n    text\n",
+	}
+
+	for name, data := range invalid {
+		if _, err := parseFeature(data); err == nil {
+			t.Errorf("Expected parse error for %s", name)
+		}
+	}
+}
+
+func TestParseTableRow(t *testing.T) {
+	cells := parseTableRow(`| a | b \| c |  |`)
+	if diff := cmp.Diff([]string{"a", "b | c", ""}, cells); diff != "" {
+		t.Errorf("Unexpected cells (-want +got):\n%s", diff)
+	}
+}
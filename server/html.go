@@ -0,0 +1,296 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// htmlReporter writes every finished session as a standalone HTML file:
+//
+//	reporter:
+//	  html:
+//	    type: html
+//	    directory: reports/html
+//
+// The files contain all styles and artifacts so they can be shared without
+// access to the server.
+type htmlReporter struct {
+	directory string
+}
+
+// htmlArtifact is an artifact prepared for rendering. Images are embedded,
+// text is shown inline and everything else can be downloaded.
+type htmlArtifact struct {
+	Name        string
+	ContentType string
+	Size        int
+	Image       bool
+	Text        string
+	URL         template.URL
+	Error       string
+}
+
+// htmlAction is an action rendered within the report of its session.
+type htmlAction struct {
+	Report *sessionReport
+	*reportStep
+}
+
+func newHTMLReporter(s *Server, name string) (builtinReporter, error) {
+	directory := s.config.GetString(fmt.Sprintf("reporter.%s.directory", name))
+	if directory == "" {
+		return nil, errors.New("missing directory")
+	}
+	return &htmlReporter{directory: directory}, nil
+}
+
+func (r *htmlReporter) reportSession(session *SessionInfo) error {
+	var buf bytes.Buffer
+	if err := renderSessionHTML(&buf, newSessionReport(session)); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(r.directory, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.directory, fmt.Sprintf("session-%s.html", session.UUID)), buf.Bytes(), 0o644)
+}
+
+func renderSessionHTML(w io.Writer, report *sessionReport) error {
+	return htmlReportTemplate.Execute(w, report)
+}
+
+// handleSessionReportHTML renders an active or finished session as HTML.
+func (s *Server) handleSessionReportHTML(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("malformed session id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	sinfo := s.sessions.getSession(id)
+	if sinfo == nil {
+		sinfo = s.sessions.getFinishedSession(id)
+	}
+	if sinfo == nil {
+		http.Error(w, "invalid session", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := renderSessionHTML(&buf, newSessionReport(sinfo)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func newHTMLArtifact(a *Artifact) htmlArtifact {
+	view := htmlArtifact{Name: a.Name, ContentType: a.ContentType}
+
+	content, err := base64.StdEncoding.DecodeString(a.Content)
+	if err != nil {
+		view.Error = "invalid base64 content"
+		return view
+	}
+	view.Size = len(content)
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(a.ContentType, ";", 2)[0]))
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		view.Image = true
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json", mediaType == "application/xml":
+		view.Text = string(content)
+		return view
+	case mediaType == "":
+		mediaType = "application/octet-stream"
+	}
+	view.URL = template.URL(fmt.Sprintf("data:%s;base64,%s", mediaType, a.Content))
+	return view
+}
+
+// htmlLogClass returns the CSS classes of a log message, e.g. "log-system
+// log-driver" for "system::driver::selenium".
+func htmlLogClass(msgType string) string {
+	source, category, _ := splitLogType(msgType)
+	classes := []string{}
+	for _, part := range []string{source, category} {
+		part = strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+				return r
+			}
+			return -1
+		}, strings.ToLower(part))
+		if part != "" {
+			classes = append(classes, "log-"+part)
+		}
+	}
+	return strings.Join(classes, " ")
+}
+
+// htmlTimelineBar positions a step on the timeline of the session.
+func htmlTimelineBar(report *sessionReport, step *reportStep) template.CSS {
+	total := report.Duration()
+	if total <= 0 {
+		return "left:0%;width:100%"
+	}
+
+	left := float64(step.Start.Sub(report.Start)) / float64(total) * 100
+	width := float64(step.Duration()) / float64(total) * 100
+	if width < 0.5 {
+		width = 0.5
+	}
+	if left+width > 100 {
+		left = 100 - width
+	}
+	return template.CSS(fmt.Sprintf("left:%.2f%%;width:%.2f%%", left, width))
+}
+
+func htmlJSON(v any) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"json":     htmlJSON,
+	"status":   func(s *SessionInfo) string { return s.status() },
+	"describe": func(ar AssertionResult) string { return ar.describe() },
+	"logClass": htmlLogClass,
+	"bar":      htmlTimelineBar,
+	"artifact": newHTMLArtifact,
+	"action":   func(report *sessionReport, step *reportStep) htmlAction { return htmlAction{report, step} },
+	"seconds":  func(d time.Duration) string { return fmt.Sprintf("%.3fs", d.Seconds()) },
+	"offset":   func(start, t time.Time) string { return fmt.Sprintf("+%.3fs", t.Sub(start).Seconds()) },
+	"time":     func(t time.Time) string { return t.Format("2006-01-02 15:04:05.000 MST") },
+}).Parse(htmlReportSource))
+
+const htmlReportSource = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - babylon session report</title>
+<style>
+body{font-family:-apple-system,"Segoe UI",Helvetica,Arial,sans-serif;margin:0;padding:1.5em 2em;color:#222;background:#fafafa}
+h1{margin:0 0 .3em}
+h2{margin-top:1.5em;border-bottom:1px solid #ddd;padding-bottom:.2em}
+table{border-collapse:collapse;width:100%}
+th,td{text-align:left;vertical-align:top;padding:.25em .5em;border-bottom:1px solid #eee}
+pre{margin:0;white-space:pre-wrap;word-break:break-all;font-size:.85em}
+.meta td:first-child{width:10em;color:#666}
+.status{display:inline-block;padding:.1em .6em;border-radius:.8em;color:#fff;font-size:.85em;text-transform:uppercase}
+.passed{background:#2e7d32}.failed{background:#c62828}.broken,.aborted{background:#ef6c00}.running{background:#1565c0}
+.timeline{position:relative;background:#fff;border:1px solid #ddd}
+.lane{position:relative;height:1.4em;border-bottom:1px solid #f0f0f0}
+.lane .bar{position:absolute;top:.2em;height:1em;border-radius:.2em;opacity:.85}
+.lane .label{position:relative;font-size:.75em;padding-left:.3em;white-space:nowrap}
+details.step{background:#fff;border:1px solid #ddd;border-left:.4em solid #999;margin:.5em 0;padding:.4em .8em}
+details.step.passed{border-left-color:#2e7d32;background:#fff}
+details.step.failed{border-left-color:#c62828;background:#fff}
+details.step.broken{border-left-color:#ef6c00;background:#fff}
+details.step summary{cursor:pointer}
+details.step details.step{margin-left:1em}
+.artifact img{max-width:100%;border:1px solid #ccc}
+.assertion-failed{color:#c62828}
+.log td{font-family:monospace;font-size:.85em}
+.log tr{border-left:.3em solid #bbb}
+.log-system{color:#555}
+.log-message{color:#0d47a1}
+.log-actor{border-left-color:#6a1b9a!important}
+.log-driver{border-left-color:#00838f!important}
+.log-assertion{border-left-color:#558b2f!important}
+.log-artifact{border-left-color:#8d6e63!important}
+.log-reference,.log-variables{border-left-color:#9e9d24!important}
+.log-scenario,.log-gherkin,.log-batch{border-left-color:#283593!important}
+.log-warning,.log-error{color:#c62828;border-left-color:#c62828!important}
+.log-user{color:#222;border-left-color:#f9a825!important}
+</style>
+</head>
+<body>
+<h1>{{.Name}} <span class="status {{status .Session}}">{{status .Session}}</span></h1>
+<table class="meta">
+<tr><td>Session</td><td>{{.Session.UUID}}</td></tr>
+{{- if .Session.Tags}}<tr><td>Tags</td><td>{{range $i, $t := .Session.Tags}}{{if $i}}, {{end}}{{$t}}{{end}}</td></tr>{{end}}
+{{- if .Session.Suite}}<tr><td>Suite</td><td>{{.Session.Suite}}</td></tr>{{end}}
+{{- if .Session.Parameters}}<tr><td>Parameters</td><td><pre>{{json .Session.Parameters}}</pre></td></tr>{{end}}
+{{- if .Log}}
+<tr><td>Started</td><td>{{time .Start}}</td></tr>
+<tr><td>Duration</td><td>{{seconds .Duration}}</td></tr>
+{{- end}}
+</table>
+{{- if .Failures}}
+<h2>Failures</h2>
+{{range .Failures}}<pre class="assertion-failed">{{.}}</pre>
+{{end}}
+{{- end}}
+{{- $report := .}}
+<h2>Timeline</h2>
+{{- if .Steps}}
+<div class="timeline">
+{{- range .Steps}}
+<div class="lane"><div class="bar {{.Status}}" style="{{bar $report .}}"></div><span class="label">{{.Title}} ({{seconds .Duration}})</span></div>
+{{- end}}
+</div>
+{{- else}}
+<p>No actions were executed.</p>
+{{- end}}
+<h2>Steps</h2>
+{{- range .GherkinSteps}}
+<details class="step {{.Status}}"{{if ne .Status "passed"}} open{{end}}>
+<summary><span class="status {{.Status}}">{{.Status}}</span> {{.Name}} <small>line {{.Line}}, {{offset $report.Start .Start}}, {{seconds .Duration}}</small></summary>
+{{- if and .Message (not .Steps)}}<pre>{{.Message}}</pre>{{end}}
+{{- range .Steps}}{{template "action" (action $report .)}}{{end}}
+</details>
+{{- end}}
+{{- range .UnlinkedSteps}}{{template "action" (action $report .)}}{{end}}
+<h2>Log</h2>
+<table class="log">
+{{- range .Log}}
+<tr class="{{logClass .MessageType}}"><td>{{offset $report.Start .TimeStamp}}</td><td>{{.MessageType}}</td><td><pre>{{.Message}}</pre></td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+{{define "action"}}
+<details class="step {{.Status}}"{{if ne .Status "passed"}} open{{end}}>
+<summary><span class="status {{.Status}}">{{.Status}}</span> {{.Title}} <small>{{offset .Report.Start .Start}}, {{seconds .Duration}}{{if gt .Attempts 1}}, {{.Attempts}} attempts{{end}}</small></summary>
+<table>
+{{- if .Parameters}}<tr><td>Parameters</td><td><pre>{{json .Parameters}}</pre></td></tr>{{end}}
+{{- if .Message}}<tr><td>Message</td><td><pre>{{.Message}}</pre></td></tr>{{end}}
+{{- if .ErrorCode}}<tr><td>Error code</td><td>{{.ErrorCode}}</td></tr>{{end}}
+{{- if .Data}}<tr><td>Result</td><td><pre>{{json .Data}}</pre></td></tr>{{end}}
+{{- if .Assertions}}<tr><td>Assertions</td><td><table>
+{{- range .Assertions}}<tr{{if not .Passed}} class="assertion-failed"{{end}}><td>{{if .Passed}}&#10003;{{else}}&#10007;{{end}}</td><td><pre>{{describe .}}</pre></td></tr>{{end}}
+</table></td></tr>{{end}}
+{{- range .Artifacts}}{{with artifact .}}
+<tr class="artifact"><td>{{.Name}}</td><td>
+{{- if .Error}}<em>{{.Error}}</em>
+{{- else if .Image}}<img src="{{.URL}}" alt="{{.Name}}">
+{{- else if .Text}}<pre>{{.Text}}</pre>
+{{- else}}<a href="{{.URL}}" download="{{.Name}}">Download {{.Name}}</a> ({{.ContentType}}, {{.Size}} bytes)
+{{- end}}</td></tr>{{end}}
+{{- end}}
+</table>
+</details>
+{{- end}}
+`
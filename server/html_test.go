@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var testScreenshot = base64.StdEncoding.EncodeToString([]byte("\x89PNG fake image"))
+
+const htmlArtifactScenario = `
+name: Artifacts
+steps:
+  - driver: artifactDriver
+    action: screenshot
+`
+
+// respondWithArtifacts attaches a screenshot and a text file to every action.
+func respondWithArtifacts(w http.ResponseWriter, req DriverExecutionRequest) {
+	json.NewEncoder(w).Encode(ExecutionResult{
+		Success: true,
+		Message: "captured",
+		Artifacts: []Artifact{
+			{Name: "page.png", ContentType: "image/png", Content: testScreenshot},
+			{Name: "console.txt", ContentType: "text/plain", Content: base64.StdEncoding.EncodeToString([]byte("<b>console</b> output"))},
+		},
+	})
+}
+
+func TestReportStepArtifacts(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "artifactDriver", &testDriver{respond: respondWithArtifacts})
+	report := newSessionReport(runReportTestScenario(t, s, htmlArtifactScenario))
+
+	if len(report.Steps) != 1 {
+		t.Fatalf("Expected 1 step, got %d", len(report.Steps))
+	}
+	artifacts := report.Steps[0].Artifacts
+	if len(artifacts) != 2 || artifacts[0].Name != "page.png" || artifacts[1].Name != "console.txt" {
+		t.Errorf("Unexpected artifacts %+v", artifacts)
+	}
+}
+
+func TestRenderSessionHTML(t *testing.T) {
+	s := newTestServer(t)
+	report := newSessionReport(runReportTestScenario(t, s, reportTestScenario))
+
+	var buf bytes.Buffer
+	if err := renderSessionHTML(&buf, report); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	for _, expected := range []string{
+		"<title>Report - babylon session report</title>",
+		`<span class="status failed">failed</span>`,
+		"driver scenarioDriver: open",
+		"driver unknownDriver: open",
+		"http://shop",
+		`class="log-system log-driver"`,
+		`class="log-message log-driver"`,
+		"Assertion failed: $.data.total equals 4",
+		"&#34;password&#34;: &#34;***&#34;",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected report to contain %q", expected)
+		}
+	}
+	if strings.Contains(out, "<script") || strings.Contains(out, "http-equiv") {
+		t.Errorf("Expected a static report")
+	}
+}
+
+func TestRenderSessionHTMLArtifacts(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "artifactDriver", &testDriver{respond: respondWithArtifacts})
+	report := newSessionReport(runReportTestScenario(t, s, htmlArtifactScenario))
+
+	var buf bytes.Buffer
+	if err := renderSessionHTML(&buf, report); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	if !strings.Contains(out, `<img src="data:image/png;base64,`+testScreenshot+`"`) {
+		t.Errorf("Expected embedded screenshot")
+	}
+	if !strings.Contains(out, "&lt;b&gt;console&lt;/b&gt; output") {
+		t.Errorf("Expected escaped text artifact")
+	}
+
+	view := newHTMLArtifact(&Artifact{Name: "trace.zip", ContentType: "application/zip", Content: "UEsDBA=="})
+	if view.Image || view.Text != "" || view.Size != 4 || !strings.HasPrefix(string(view.URL), "data:application/zip;base64,") {
+		t.Errorf("Expected downloadable artifact, got %+v", view)
+	}
+	if view := newHTMLArtifact(&Artifact{Name: "broken", Content: "%%%"}); view.Error == "" {
+		t.Errorf("Expected error for invalid content")
+	}
+}
+
+func TestHtmlLogClass(t *testing.T) {
+	cases := map[string]string{
+		"system::driver::selenium":  "log-system log-driver",
+		"message::actor::user":      "log-message log-actor",
+		"warning":                   "log-warning",
+		`x" onclick="y::Fancy Type`: "log-xonclicky log-fancytype",
+	}
+	for msgType, expected := range cases {
+		if got := htmlLogClass(msgType); got != expected {
+			t.Errorf("htmlLogClass(%q) = %q, expected %q", msgType, got, expected)
+		}
+	}
+}
+
+func TestHandleSessionReportHTML(t *testing.T) {
+	s := newTestServer(t)
+	sinfo := runReportTestScenario(t, s, reportTestScenario)
+
+	cases := map[string]int{
+		sinfo.UUID.String():        http.StatusOK,
+		uuid.New().String():        http.StatusNotFound,
+		"not-a-session-identifier": http.StatusBadRequest,
+	}
+	for id, status := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/session/"+id+"/report.html", nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+
+		s.handleSessionReportHTML(rec, req)
+		if rec.Code != status {
+			t.Errorf("Expected status %d for %s, got %d", status, id, rec.Code)
+		}
+		if status == http.StatusOK && !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("Unexpected content type %s", rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestHTMLReporter(t *testing.T) {
+	s := newTestServer(t)
+
+	if _, err := newHTMLReporter(s, "html"); err == nil {
+		t.Errorf("Expected error for missing directory")
+	}
+
+	dir := filepath.Join(t.TempDir(), "html")
+	s.config.Set("reporter.html.directory", dir)
+	r, err := newHTMLReporter(s, "html")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sinfo := runReportTestScenario(t, s, reportTestScenario)
+	if err := r.reportSession(sinfo); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "session-"+sinfo.UUID.String()+".html"))
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	if !strings.Contains(string(data), sinfo.UUID.String()) {
+		t.Errorf("Expected report of session %s", sinfo.UUID)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is either an object key or an array index.
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath splits a simple JSON path like "$.data.items[0].id" or
+// "data['order id']" into its segments. The leading "$" is optional.
+func parsePath(path string) ([]pathSegment, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+
+	var segments []pathSegment
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("missing ']' in path '%s'", path)
+			}
+			inner := strings.TrimSpace(p[1:end])
+			p = p[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+
+			idx, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index '%s' in path '%s'", inner, path)
+			}
+			segments = append(segments, pathSegment{index: idx, isIndex: true})
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			segments = append(segments, pathSegment{key: p[:end]})
+			p = p[end:]
+		}
+	}
+
+	return segments, nil
+}
+
+// lookupPath resolves the path in a JSON document as produced by
+// encoding/json (maps, slices and scalars). The boolean result is false if
+// the path does not exist in the document.
+func lookupPath(doc any, path string) (any, bool, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	current := doc
+	for _, seg := range segments {
+		if seg.isIndex {
+			list, ok := current.([]any)
+			if !ok {
+				return nil, false, nil
+			}
+			idx := seg.index
+			if idx < 0 {
+				idx += len(list)
+			}
+			if idx < 0 || idx >= len(list) {
+				return nil, false, nil
+			}
+			current = list[idx]
+			continue
+		}
+
+		switch obj := current.(type) {
+		case map[string]any:
+			v, ok := obj[seg.key]
+			if !ok {
+				return nil, false, nil
+			}
+			current = v
+		case []any:
+			if seg.key != "length" {
+				return nil, false, nil
+			}
+			current = float64(len(obj))
+		default:
+			return nil, false, nil
+		}
+	}
+
+	return current, true, nil
+}
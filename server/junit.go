@@ -0,0 +1,231 @@
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const junitTimestampFormat = "2006-01-02T15:04:05"
+
+// junitReporter writes JUnit XML files that CI systems can read:
+//
+//	reporter:
+//	  junit:
+//	    type: junit
+//	    directory: reports/junit
+//	    groupBy: suite
+//
+// Every session becomes a test case. With groupBy "suite" (default) the
+// sessions of a suite are written into a single file, with "session" every
+// session gets its own file.
+type junitReporter struct {
+	directory    string
+	groupBySuite bool
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+func newJUnitReporter(s *Server, name string) (builtinReporter, error) {
+	key := fmt.Sprintf("reporter.%s.", name)
+
+	directory := s.config.GetString(key + "directory")
+	if directory == "" {
+		return nil, errors.New("missing directory")
+	}
+
+	groupBy := "suite"
+	if s.config.IsSet(key + "groupBy") {
+		groupBy = s.config.GetString(key + "groupBy")
+	}
+	if groupBy != "suite" && groupBy != "session" {
+		return nil, fmt.Errorf("invalid groupBy '%s', expected 'suite' or 'session'", groupBy)
+	}
+
+	return &junitReporter{directory: directory, groupBySuite: groupBy == "suite"}, nil
+}
+
+func (r *junitReporter) reportSession(session *SessionInfo) error {
+	if r.groupBySuite && session.Suite != "" {
+		return nil
+	}
+
+	report := newSessionReport(session)
+	suite := junitTestSuite{
+		Name:       report.Name(),
+		Timestamp:  report.Start.Format(junitTimestampFormat),
+		Properties: junitSessionProperties(session),
+	}
+	suite.add(report, "babylon")
+
+	return r.write(fmt.Sprintf("TEST-session-%s.xml", session.UUID), suite)
+}
+
+func (r *junitReporter) reportSuite(info *SuiteInfo, sessions []*SessionInfo) error {
+	if !r.groupBySuite {
+		return nil
+	}
+
+	suite := junitTestSuite{
+		Name:       info.Name,
+		Timestamp:  info.StartedAt.Format(junitTimestampFormat),
+		Properties: []junitProperty{{Name: "suite", Value: info.ID.String()}},
+	}
+	for _, session := range sessions {
+		suite.add(newSessionReport(session), info.Name)
+	}
+	if info.FinishedAt != nil {
+		suite.Time = junitSeconds(info.FinishedAt.Sub(info.StartedAt))
+	}
+
+	return r.write(fmt.Sprintf("TEST-suite-%s.xml", info.ID), suite)
+}
+
+func (r *junitReporter) write(file string, suite junitTestSuite) error {
+	doc := junitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(r.directory, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.directory, file), append([]byte(xml.Header), data...), 0o644)
+}
+
+// add adds the session as test case to the suite.
+func (s *junitTestSuite) add(report *sessionReport, classname string) {
+	tc := junitTestCase{
+		Name:      report.Name(),
+		Classname: classname,
+		Time:      junitSeconds(report.Duration()),
+		SystemOut: junitSystemOut(report),
+	}
+
+	if report.Failed() {
+		failure := &junitFailure{
+			Message: "session failed",
+			Type:    string(report.ErrorCode()),
+			Text:    strings.Join(report.Failures, "\n"),
+		}
+		if len(report.Failures) > 0 {
+			failure.Message = strings.SplitN(report.Failures[0], "\n", 2)[0]
+		}
+
+		if report.Broken() {
+			tc.Error = failure
+			s.Errors++
+		} else {
+			tc.Failure = failure
+			s.Failures++
+		}
+	}
+
+	s.Tests++
+	s.Cases = append(s.Cases, tc)
+	if s.Time == "" {
+		s.Time = tc.Time
+	}
+}
+
+func junitSessionProperties(session *SessionInfo) []junitProperty {
+	props := []junitProperty{
+		{Name: "session", Value: session.UUID.String()},
+		{Name: "status", Value: session.status()},
+	}
+	if len(session.Tags) > 0 {
+		props = append(props, junitProperty{Name: "tags", Value: strings.Join(session.Tags, ",")})
+	}
+
+	names := make([]string, 0, len(session.Parameters))
+	for name := range session.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		props = append(props, junitProperty{Name: "parameter." + name, Value: valueString(session.Parameters[name])})
+	}
+	return props
+}
+
+// junitSystemOut lists the steps with their durations followed by the log of
+// the session with timestamps relative to its start. The actions of Gherkin
+// steps are listed below their step.
+func junitSystemOut(report *sessionReport) string {
+	var sb strings.Builder
+	if len(report.Steps) > 0 || len(report.GherkinSteps) > 0 {
+		sb.WriteString("Steps:\n")
+		for _, gs := range report.GherkinSteps {
+			fmt.Fprintf(&sb, "  [%s] %s (%ss)\n", gs.Status, gs.Name, junitSeconds(gs.Duration()))
+			for _, step := range gs.Steps {
+				fmt.Fprintf(&sb, "    [%s] %s (%ss)\n", step.Status, step.Title(), junitSeconds(step.Duration()))
+			}
+		}
+		for _, step := range report.UnlinkedSteps() {
+			fmt.Fprintf(&sb, "  [%s] %s (%ss)\n", step.Status, step.Title(), junitSeconds(step.Duration()))
+		}
+	}
+
+	sb.WriteString("Log:\n")
+	for _, msg := range report.Log {
+		fmt.Fprintf(&sb, "  [+%ss] %s: %s\n", junitSeconds(msg.TimeStamp.Sub(report.Start)), msg.MessageType, msg.Message)
+	}
+	return sb.String()
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func newTestJUnitReporter(t *testing.T, s *Server, groupBy string) (*junitReporter, string) {
+	dir := filepath.Join(t.TempDir(), "junit")
+
+	s.config.Set("reporter.junit.type", "junit")
+	s.config.Set("reporter.junit.directory", dir)
+	s.config.Set("reporter.junit.groupBy", groupBy)
+
+	r, err := newJUnitReporter(s, "junit")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return r.(*junitReporter), dir
+}
+
+func readJUnitFile(t *testing.T, path string) junitTestSuites {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+
+	var doc junitTestSuites
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to parse report: %v", err)
+	}
+	return doc
+}
+
+func TestNewJUnitReporterErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	if _, err := newJUnitReporter(s, "junit"); err == nil {
+		t.Errorf("Expected error for missing directory")
+	}
+
+	s.config.Set("reporter.junit.directory", t.TempDir())
+	s.config.Set("reporter.junit.groupBy", "tag")
+	if _, err := newJUnitReporter(s, "junit"); err == nil {
+		t.Errorf("Expected error for invalid groupBy")
+	}
+}
+
+func TestJUnitReporterSession(t *testing.T) {
+	s := newTestServer(t)
+	r, dir := newTestJUnitReporter(t, s, "session")
+	sinfo := runReportTestScenario(t, s, reportTestScenario)
+
+	if err := r.reportSession(sinfo); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	doc := readJUnitFile(t, filepath.Join(dir, "TEST-session-"+sinfo.UUID.String()+".xml"))
+	if doc.Tests != 1 || doc.Failures != 1 || len(doc.Suites) != 1 || len(doc.Suites[0].Cases) != 1 {
+		t.Fatalf("Unexpected report %+v", doc)
+	}
+
+	tc := doc.Suites[0].Cases[0]
+	if tc.Name != "Report" || tc.Failure == nil {
+		t.Fatalf("Expected failed test case, got %+v", tc)
+	}
+	if tc.Failure.Type != string(ErrorCodeAssertion) || !strings.Contains(tc.Failure.Text, "driver unknownDriver: open") {
+		t.Errorf("Unexpected failure %+v", tc.Failure)
+	}
+	if !strings.Contains(tc.SystemOut, "[passed] driver scenarioDriver: open (") {
+		t.Errorf("Expected step durations in system-out, got %q", tc.SystemOut)
+	}
+}
+
+func TestJUnitReporterSuite(t *testing.T) {
+	s := newTestServer(t)
+	r, dir := newTestJUnitReporter(t, s, "suite")
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	sc, err := parseScenario([]byte(`
+name: JUnit suite
+matrix:
+  parameters:
+    product: [book, fail]
+steps:
+  - driver: scenarioDriver
+    action: order
+    parameters:
+      product: ${vars.product}
+    expect:
+      - path: $.data.product
+        op: notEquals
+        value: fail
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result := s.runScenario(sc)
+
+	var sessions []*SessionInfo
+	for _, c := range result.Combinations {
+		sinfo := s.sessions.getFinishedSession(uuid.MustParse(c.Session))
+		if err := r.reportSession(sinfo); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sessions = append(sessions, sinfo)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected suite sessions not to be written separately, got %d files", len(entries))
+	}
+
+	if err := r.reportSuite(s.suites.get(uuid.MustParse(result.Suite)), sessions); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	doc := readJUnitFile(t, filepath.Join(dir, "TEST-suite-"+result.Suite+".xml"))
+	if doc.Tests != 2 || doc.Failures != 1 || doc.Suites[0].Cases[1].Name != "JUnit suite [product=fail]" {
+		t.Errorf("Unexpected suite report %+v", doc)
+	}
+}
+
+func TestSetupBuiltinReporter(t *testing.T) {
+	s := newTestServer(t)
+	_, dir := newTestJUnitReporter(t, s, "session")
+
+	s.setupPreconfiguredReporter("junit")
+	defer s.reporters.RemoveReporter("junit")
+
+	reporter, ok := s.reporters.GetReporters()["junit"]
+	if !ok || reporter.Type != "junit" || reporter.builtin == nil {
+		t.Fatalf("Expected builtin reporter to be registered, got %+v", reporter)
+	}
+
+	s.config.Set("reporter.broken.type", "unknown")
+	s.setupPreconfiguredReporter("broken")
+	if _, ok := s.reporters.GetReporters()["broken"]; ok {
+		t.Errorf("Expected unknown reporter type to be rejected")
+	}
+
+	sinfo := runReportTestScenario(t, s, "name: Builtin\nsteps:\n  - driver: scenarioDriver\n    action: open\n")
+	s.endReportBy(&reporter, sinfo)
+	if _, err := os.Stat(filepath.Join(dir, "TEST-session-"+sinfo.UUID.String()+".xml")); err != nil {
+		t.Errorf("Expected report to be written by builtin reporter: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	deliveryKindLiveBatch = "live/batch"
+
+	defaultLiveBatchSize   = 50
+	defaultLiveBatchWindow = 200 * time.Millisecond
+	defaultLiveBufferSize  = 1000
+)
+
+type LiveLogBatchData struct {
+	UUID     string              `json:"session"`
+	Messages []SessionLogMessage `json:"messages"`
+}
+
+// LiveLogBatchAck is the answer of a reporter to a batch of live log
+// messages. Delivered counts the messages at the start of the batch that the
+// reporter accepted before one failed.
+type LiveLogBatchAck struct {
+	Delivered int `json:"delivered"`
+}
+
+// acknowledgeBatch removes the messages that the reporter accepted from a
+// live log batch that failed, so that a retry only sends the remaining ones.
+func acknowledgeBatch(msg *deliveryMessage, body io.Reader) {
+	var ack LiveLogBatchAck
+	if err := json.NewDecoder(body).Decode(&ack); err != nil || ack.Delivered <= 0 {
+		return
+	}
+
+	var batch LiveLogBatchData
+	if err := json.Unmarshal(msg.Payload, &batch); err != nil || ack.Delivered >= len(batch.Messages) {
+		return
+	}
+	batch.Messages = batch.Messages[ack.Delivered:]
+	if data, err := json.Marshal(batch); err == nil {
+		msg.Payload = data
+	}
+}
+
+// reporterWorker passes the live log messages and session reports of a single
+// reporter to its delivery queue in the order they were created. Reporters
+// that registered with batch support receive the messages of a session in
+// batches that are sent once they reach the batch size or the batch window
+// elapsed:
+//
+//	live:
+//	  batchSize: 50
+//	  batchWindow: 200ms
+//	  bufferSize: 1000
+//
+// The buffer of a worker is bounded and so are the delivery lanes it hands
+// the messages on to. Once they are full, sessions wait with their next log
+// message until the reporter caught up. Entries that are still buffered when
+// the server stops are stored with the pending deliveries.
+type reporterWorker struct {
+	server   *Server
+	reporter string
+	entries  chan reporterWorkerEntry
+}
+
+type reporterWorkerEntry struct {
+	session string
+	message *SessionLogMessage
+	report  *SessionInfo
+	batch   bool
+	// flushed is closed once all entries before it were handed on.
+	flushed chan struct{}
+}
+
+type reporterWorkerRegister struct {
+	server  *Server
+	mutex   sync.Mutex
+	workers map[string]*reporterWorker
+}
+
+// get returns the worker of the reporter and starts it if necessary.
+func (r *reporterWorkerRegister) get(name string) *reporterWorker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	w, ok := r.workers[name]
+	if !ok {
+		size := defaultLiveBufferSize
+		if r.server.config.IsSet("live.bufferSize") {
+			size = r.server.config.GetInt("live.bufferSize")
+		}
+
+		w = &reporterWorker{server: r.server, reporter: name, entries: make(chan reporterWorkerEntry, size)}
+		r.workers[name] = w
+		go w.run()
+	}
+	return w
+}
+
+// add queues the entry and blocks while the buffer of the worker is full.
+// Entries added after the server stopped are handed on directly. It must not
+// be called while a session or register lock is held.
+func (w *reporterWorker) add(entry reporterWorkerEntry) {
+	select {
+	case w.entries <- entry:
+	default:
+		w.server.logger.With("reporter", w.reporter, "session", entry.session).Warn("Live log buffer of reporter full. Waiting for delivery.")
+		select {
+		case w.entries <- entry:
+		case <-w.server.stop:
+			w.handOn(entry)
+		}
+	}
+}
+
+// handOn passes a single entry to the delivery queue of the reporter.
+func (w *reporterWorker) handOn(entry reporterWorkerEntry) {
+	switch {
+	case entry.flushed != nil:
+		close(entry.flushed)
+	case entry.report != nil:
+		w.server.enqueueDelivery(w.reporter, deliveryKindReport, entry.session, entry.report)
+	case entry.batch:
+		w.server.enqueueDelivery(w.reporter, deliveryKindLiveBatch, entry.session, LiveLogBatchData{UUID: entry.session, Messages: []SessionLogMessage{*entry.message}})
+	default:
+		w.server.enqueueDelivery(w.reporter, deliveryKindLive, entry.session, LiveLogMessageData{UUID: entry.session, Message: *entry.message})
+	}
+}
+
+// flush hands on all entries of the workers, including incomplete batches,
+// to the delivery queues. It returns early if the context expires.
+func (r *reporterWorkerRegister) flush(ctx context.Context) error {
+	r.mutex.Lock()
+	workers := make([]*reporterWorker, 0, len(r.workers))
+	for _, w := range r.workers {
+		workers = append(workers, w)
+	}
+	r.mutex.Unlock()
+
+	for _, w := range workers {
+		flushed := make(chan struct{})
+		w.add(reporterWorkerEntry{flushed: flushed})
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (w *reporterWorker) run() {
+	batchSize := defaultLiveBatchSize
+	if w.server.config.IsSet("live.batchSize") {
+		batchSize = w.server.config.GetInt("live.batchSize")
+	}
+	batchWindow := defaultLiveBatchWindow
+	if w.server.config.IsSet("live.batchWindow") {
+		batchWindow = w.server.config.GetDuration("live.batchWindow")
+	}
+
+	batches := make(map[string][]SessionLogMessage)
+	var window <-chan time.Time
+
+	flush := func(session string) {
+		if messages := batches[session]; len(messages) > 0 {
+			w.server.enqueueDelivery(w.reporter, deliveryKindLiveBatch, session, LiveLogBatchData{UUID: session, Messages: messages})
+		}
+		delete(batches, session)
+	}
+
+	for {
+		select {
+		case entry := <-w.entries:
+			switch {
+			case entry.flushed != nil:
+				for session := range batches {
+					flush(session)
+				}
+				close(entry.flushed)
+			case entry.report != nil || !entry.batch:
+				flush(entry.session)
+				w.handOn(entry)
+			default:
+				batches[entry.session] = append(batches[entry.session], *entry.message)
+				if len(batches[entry.session]) >= batchSize {
+					flush(entry.session)
+				} else if window == nil {
+					window = time.After(batchWindow)
+				}
+			}
+		case <-window:
+			window = nil
+			for session := range batches {
+				flush(session)
+			}
+		case <-w.server.stop:
+			// stored with the pending deliveries for the next start
+			for session := range batches {
+				flush(session)
+			}
+			for {
+				select {
+				case entry := <-w.entries:
+					w.handOn(entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// liveTestRequest is a request received by the fake live reporter with the
+// messages it contained.
+type liveTestRequest struct {
+	path     string
+	messages []string
+}
+
+type liveTestReporter struct {
+	mutex    sync.Mutex
+	requests []liveTestRequest
+	// gate holds up requests until it is closed.
+	gate chan struct{}
+}
+
+func newLiveTestReporter(t *testing.T, s *Server, name string, batch bool) *liveTestReporter {
+
+	fake := &liveTestReporter{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data struct {
+			Message  SessionLogMessage   `json:"message"`
+			Messages []SessionLogMessage `json:"messages"`
+			Status   string              `json:"status"`
+		}
+		json.NewDecoder(r.Body).Decode(&data)
+
+		req := liveTestRequest{path: strings.TrimPrefix(r.URL.Path, "/reporter/"+strings.ToLower(name)+"/")}
+		switch req.path {
+		case deliveryKindLive:
+			req.messages = []string{data.Message.Message}
+		case deliveryKindLiveBatch:
+			for _, msg := range data.Messages {
+				req.messages = append(req.messages, msg.Message)
+			}
+		}
+
+		fake.mutex.Lock()
+		gate := fake.gate
+		fake.mutex.Unlock()
+		if gate != nil {
+			<-gate
+		}
+
+		fake.mutex.Lock()
+		fake.requests = append(fake.requests, req)
+		fake.mutex.Unlock()
+	}))
+	t.Cleanup(ts.Close)
+
+	s.reporters.AddReporter(ReporterInfo{Name: name, Callback: ts.URL + "/", LiveReport: true, LiveBatch: batch})
+	t.Cleanup(func() {
+		s.reporters.RemoveReporter(name)
+		s.reporterWorkers.mutex.Lock()
+		delete(s.reporterWorkers.workers, name)
+		s.reporterWorkers.mutex.Unlock()
+		if q := s.deliveries.get(name); q != nil {
+			waitForDelivery(t, func() bool { return q.pending() == 0 })
+		}
+	})
+	return fake
+}
+
+func (f *liveTestReporter) received() []liveTestRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]liveTestRequest{}, f.requests...)
+}
+
+func (f *liveTestReporter) messageCount() int {
+	count := 0
+	for _, req := range f.received() {
+		count += len(req.messages)
+	}
+	return count
+}
+
+func TestLiveLogBatches(t *testing.T) {
+	s := newTestServer(t)
+	fake := newLiveTestReporter(t, s, "BatchReporter", true)
+	s.config.Set("live.batchSize", 3)
+	s.config.Set("live.batchWindow", "20ms")
+
+	sinfo := newTestSession(s)
+	for i := 1; i <= 7; i++ {
+		sinfo.Context.appendLog("user", fmt.Sprintf("message %d", i))
+	}
+
+	waitForDelivery(t, func() bool { return fake.messageCount() == 7 })
+
+	requests := fake.received()
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 batches, got %+v", requests)
+	}
+	n := 1
+	for i, size := range []int{3, 3, 1} {
+		if requests[i].path != deliveryKindLiveBatch || len(requests[i].messages) != size {
+			t.Errorf("Expected batch %d with %d messages, got %+v", i, size, requests[i])
+		}
+		for _, msg := range requests[i].messages {
+			if msg != fmt.Sprintf("message %d", n) {
+				t.Errorf("Expected message %d, got %s", n, msg)
+			}
+			n++
+		}
+	}
+}
+
+func TestLiveLogWithoutBatching(t *testing.T) {
+	s := newTestServer(t)
+	fake := newLiveTestReporter(t, s, "SingleReporter", false)
+
+	sinfo := newTestSession(s)
+	for i := 1; i <= 5; i++ {
+		sinfo.Context.appendLog("user", fmt.Sprintf("message %d", i))
+	}
+
+	waitForDelivery(t, func() bool { return fake.messageCount() == 5 })
+	for i, req := range fake.received() {
+		if req.path != deliveryKindLive || req.messages[0] != fmt.Sprintf("message %d", i+1) {
+			t.Errorf("Expected single message %d in order, got %+v", i+1, req)
+		}
+	}
+}
+
+func TestLiveLogReportAfterMessages(t *testing.T) {
+	s := newTestServer(t)
+	fake := newLiveTestReporter(t, s, "ReportAfterLive", true)
+	s.config.Set("live.batchWindow", "1h")
+
+	sinfo := newTestSession(s)
+	sinfo.Context.appendLog("user", "first")
+	sinfo.Context.appendLog("user", "second")
+
+	reporter, _ := s.reporters.getReporter("ReportAfterLive")
+	s.endReportBy(&reporter, sinfo)
+
+	waitForDelivery(t, func() bool { return len(fake.received()) == 2 })
+	requests := fake.received()
+	if requests[0].path != deliveryKindLiveBatch || len(requests[0].messages) != 2 || requests[1].path != deliveryKindReport {
+		t.Errorf("Expected pending batch to be sent before the report, got %+v", requests)
+	}
+}
+
+func TestLiveLogFullLaneSlowsDownSession(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("live.bufferSize", 1)
+	s.config.Set("delivery.laneSize", 1)
+	fake := newLiveTestReporter(t, s, "SlowReporter", false)
+	gate := make(chan struct{})
+	fake.mutex.Lock()
+	fake.gate = gate
+	fake.mutex.Unlock()
+
+	// one message in delivery, one waiting for the lane, one in the buffer
+	sinfo := s.newSession("Busy", nil)
+	logged := make(chan struct{})
+	go func() {
+		for i := 1; i <= 4; i++ {
+			sinfo.Context.appendLog("user", fmt.Sprintf("message %d", i))
+		}
+		close(logged)
+	}()
+
+	select {
+	case <-logged:
+		t.Fatalf("Expected logging to wait for the full delivery lane")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if snapshot := sinfo.snapshot(); len(snapshot.Context.Log) < 3 {
+		t.Errorf("Expected session to stay readable while it waits, got %d messages", len(snapshot.Context.Log))
+	}
+
+	close(gate)
+	<-logged
+	waitForDelivery(t, func() bool { return fake.messageCount() == 4 })
+	for i, req := range fake.received() {
+		if req.messages[0] != fmt.Sprintf("message %d", i+1) {
+			t.Errorf("Expected message %d in order, got %+v", i+1, req)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	actionResultPassed = "passed"
+	actionResultFailed = "failed"
+	actionResultError  = "error"
+)
+
+// metricVec is a counter or histogram with labels in the Prometheus text
+// exposition format. Series are created on first use.
+type metricVec struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels []string
+	value  float64
+	counts []uint64
+	count  uint64
+}
+
+func newCounterVec(name, help string, labels ...string) *metricVec {
+	m := &metricVec{name: name, help: help, kind: "counter", labels: labels, series: make(map[string]*metricSeries)}
+	if len(labels) == 0 {
+		m.get(nil)
+	}
+	return m
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets, series: make(map[string]*metricSeries)}
+}
+
+func (m *metricVec) get(values []string) *metricSeries {
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{labels: values, counts: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	return s
+}
+
+// inc increments the counter with the given label values.
+func (m *metricVec) inc(values ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.get(values).value++
+}
+
+// observe records a value of the histogram with the given label values.
+func (m *metricVec) observe(v float64, values ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s := m.get(values)
+	s.value += v
+	s.count++
+	for i, bound := range m.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+}
+
+func (m *metricVec) write(w io.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, metricLabels(m.labels, s.labels), formatMetricValue(s.value))
+			continue
+		}
+
+		for i, bound := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, metricLabels(withLabel(m.labels, "le"), withLabel(s.labels, formatMetricValue(bound))), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, metricLabels(withLabel(m.labels, "le"), withLabel(s.labels, "+Inf")), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, metricLabels(m.labels, s.labels), formatMetricValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, metricLabels(m.labels, s.labels), s.count)
+	}
+}
+
+// gaugeSample is a single value of a gauge that is computed on scrape.
+type gaugeSample struct {
+	labels []string
+	value  float64
+}
+
+func writeGauge(w io.Writer, name, help string, labels []string, samples []gaugeSample) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].labels, "\xff") < strings.Join(samples[j].labels, "\xff")
+	})
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", name, metricLabels(labels, s.labels), formatMetricValue(s.value))
+	}
+}
+
+func withLabel(list []string, label string) []string {
+	return append(append(make([]string, 0, len(list)+1), list...), label)
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func metricLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, metricLabelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// serverMetrics are the counters and histograms of a server.
+type serverMetrics struct {
+	sessionsCreated  *metricVec
+	sessionsTimedOut *metricVec
+	actions          *metricVec
+	extensionCalls   *metricVec
+	reporterFailures *metricVec
+}
+
+func newServerMetrics() serverMetrics {
+	return serverMetrics{
+		sessionsCreated: newCounterVec("babylon_sessions_created_total",
+			"Number of created sessions."),
+		sessionsTimedOut: newCounterVec("babylon_sessions_timed_out_total",
+			"Number of sessions that were cleaned up after missing keepalives."),
+		actions: newCounterVec("babylon_actions_total",
+			"Number of executed actions by extension kind, type, action and result.", "kind", "type", "action", "result"),
+		extensionCalls: newHistogramVec("babylon_extension_call_duration_seconds",
+			"Duration of calls to actors and drivers.", []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}, "kind", "name"),
+		reporterFailures: newCounterVec("babylon_reporter_delivery_failures_total",
+			"Number of failed reporter deliveries by reporter and outcome.", "reporter", "outcome"),
+	}
+}
+
+// recordAction counts an executed action. err is the error that prevented
+// the execution, result is the outcome otherwise.
+func (s *Server) recordAction(kind, extensionType, action string, result *ExecutionResult, err error) {
+	outcome := actionResultPassed
+	switch {
+	case err != nil:
+		outcome = actionResultError
+	case result == nil || !result.Success:
+		outcome = actionResultFailed
+	}
+	s.metrics.actions.inc(kind, extensionType, action, outcome)
+}
+
+func (s *Server) observeExtensionCall(kind, name string, start time.Time) {
+	s.metrics.extensionCalls.observe(time.Since(start).Seconds(), kind, name)
+}
+
+// handleMetrics exposes the metrics of the server in the Prometheus text
+// exposition format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writeMetrics(w)
+}
+
+func (s *Server) writeMetrics(w io.Writer) {
+	s.sessions.sessionMutex.Lock()
+	active := len(s.sessions.activeSessions)
+	s.sessions.sessionMutex.Unlock()
+	writeGauge(w, "babylon_sessions_active", "Number of active sessions.", nil, []gaugeSample{{value: float64(active)}})
+
+	s.metrics.sessionsCreated.write(w)
+	s.metrics.sessionsTimedOut.write(w)
+	s.metrics.actions.write(w)
+	s.metrics.extensionCalls.write(w)
+
+	registry := s.collectRegistry()
+	var registered, healthy, circuits []gaugeSample
+	for _, kind := range []struct {
+		name    string
+		entries []RegistryEntry
+	}{{"actor", registry.Actors}, {"driver", registry.Drivers}, {"reporter", registry.Reporters}} {
+		up := 0
+		for _, entry := range kind.entries {
+			if entry.Circuit.State == circuitClosed {
+				up++
+			}
+			for _, state := range []string{circuitClosed, circuitOpen, circuitHalfOpen} {
+				value := 0.0
+				if entry.Circuit.State == state {
+					value = 1
+				}
+				circuits = append(circuits, gaugeSample{labels: []string{kind.name, entry.Name, state}, value: value})
+			}
+		}
+		registered = append(registered, gaugeSample{labels: []string{kind.name}, value: float64(len(kind.entries))})
+		healthy = append(healthy, gaugeSample{labels: []string{kind.name}, value: float64(up)})
+	}
+	writeGauge(w, "babylon_extensions_registered", "Number of registered extensions by kind.", []string{"kind"}, registered)
+	writeGauge(w, "babylon_extensions_healthy", "Number of registered extensions with a closed circuit breaker by kind.", []string{"kind"}, healthy)
+	writeGauge(w, "babylon_circuit_breaker_state", "Circuit breaker state of the registered extensions.", []string{"kind", "name", "state"}, circuits)
+
+	s.metrics.reporterFailures.write(w)
+
+	var pending, deadLetters, buffered []gaugeSample
+	s.deliveries.mutex.Lock()
+	queues := make([]*reporterQueue, 0, len(s.deliveries.queues))
+	for _, q := range s.deliveries.queues {
+		queues = append(queues, q)
+	}
+	s.deliveries.mutex.Unlock()
+	for _, q := range queues {
+		pending = append(pending, gaugeSample{labels: []string{q.name}, value: float64(q.pending())})
+		deadLetters = append(deadLetters, gaugeSample{labels: []string{q.name}, value: float64(len(q.listDeadLetters()))})
+	}
+
+	s.reporterWorkers.mutex.Lock()
+	for name, worker := range s.reporterWorkers.workers {
+		buffered = append(buffered, gaugeSample{labels: []string{name}, value: float64(len(worker.entries))})
+	}
+	s.reporterWorkers.mutex.Unlock()
+
+	writeGauge(w, "babylon_reporter_queue_depth", "Number of reporter messages waiting for delivery.", []string{"reporter"}, pending)
+	writeGauge(w, "babylon_reporter_dead_letters", "Number of reporter messages kept as dead letters.", []string{"reporter"}, deadLetters)
+	writeGauge(w, "babylon_reporter_buffer_depth", "Number of live log entries buffered by the reporter workers.", []string{"reporter"}, buffered)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricVecHistogram(t *testing.T) {
+	m := newHistogramVec("test_duration_seconds", "Test durations.", []float64{0.1, 1}, "name")
+	m.observe(0.05, "a")
+	m.observe(0.5, "a")
+	m.observe(2, "a")
+	m.observe(0.5, `quote"d`)
+
+	var buf bytes.Buffer
+	m.write(&buf)
+
+	expected := `# HELP test_duration_seconds Test durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{name="a",le="0.1"} 1
+test_duration_seconds_bucket{name="a",le="1"} 2
+test_duration_seconds_bucket{name="a",le="+Inf"} 3
+test_duration_seconds_sum{name="a"} 2.55
+test_duration_seconds_count{name="a"} 3
+test_duration_seconds_bucket{name="quote\"d",le="0.1"} 0
+test_duration_seconds_bucket{name="quote\"d",le="1"} 1
+test_duration_seconds_bucket{name="quote\"d",le="+Inf"} 1
+test_duration_seconds_sum{name="quote\"d"} 0.5
+test_duration_seconds_count{name="quote\"d"} 1
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected histogram output:\n%s", buf.String())
+	}
+}
+
+func TestMetricVecCounter(t *testing.T) {
+	var buf bytes.Buffer
+	newCounterVec("test_total", "Test counter.").write(&buf)
+	if !strings.Contains(buf.String(), "\ntest_total 0\n") {
+		t.Errorf("Expected counter without labels to start at zero, got:\n%s", buf.String())
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	s := newTestServer(t)
+	runReportTestScenario(t, s, reportTestScenario)
+
+	rec := httptest.NewRecorder()
+	s.handleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("Unexpected response %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	body := rec.Body.String()
+	for _, expected := range []string{
+		"# TYPE babylon_sessions_active gauge",
+		"# TYPE babylon_sessions_created_total counter",
+		`babylon_actions_total{kind="driver",type="scenarioDriver",action="open",result="passed"}`,
+		`babylon_actions_total{kind="driver",type="scenarioDriver",action="check",result="failed"}`,
+		`babylon_actions_total{kind="driver",type="unknownDriver",action="open",result="error"}`,
+		`babylon_extension_call_duration_seconds_count{kind="driver",name="scenarioDriver"}`,
+		`babylon_circuit_breaker_state{kind="driver",name="scenarioDriver",state="closed"} 1`,
+		`babylon_extensions_registered{kind="driver"}`,
+		`babylon_extensions_healthy{kind="driver"}`,
+		"# TYPE babylon_reporter_queue_depth gauge",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %s", expected)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleMetrics(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid method, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// RegistryEntry describes a registered extension without exposing its secret.
+type RegistryEntry struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type,omitempty"`
+	Callback string          `json:"callback"`
+	Live     bool            `json:"live,omitempty"`
+	Batch    bool            `json:"batch,omitempty"`
+	Filter   *ReporterFilter `json:"filter,omitempty"`
+	Circuit  CircuitInfo     `json:"circuit"`
+}
+
+type RegistryInfo struct {
+	Actors    []RegistryEntry `json:"actors"`
+	Drivers   []RegistryEntry `json:"drivers"`
+	Reporters []RegistryEntry `json:"reporters"`
+}
+
+func (s *Server) handleRegistry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.collectRegistry())
+}
+
+func (s *Server) collectRegistry() RegistryInfo {
+	info := RegistryInfo{
+		Actors:    make([]RegistryEntry, 0),
+		Drivers:   make([]RegistryEntry, 0),
+		Reporters: make([]RegistryEntry, 0),
+	}
+
+	s.actorsMutex.Lock()
+	for _, a := range s.actors {
+		info.Actors = append(info.Actors, RegistryEntry{
+			Name:     a.Name,
+			Type:     a.Type,
+			Callback: a.Callback,
+			Circuit:  s.breakers.info("actor", a.Name),
+		})
+	}
+	s.actorsMutex.Unlock()
+
+	s.drivers.mutex.Lock()
+	for _, d := range s.drivers.drivers {
+		info.Drivers = append(info.Drivers, RegistryEntry{
+			Name:     d.Name,
+			Type:     d.Type,
+			Callback: d.Callback,
+			Circuit:  s.breakers.info("driver", d.Name),
+		})
+	}
+	s.drivers.mutex.Unlock()
+
+	s.reporters.mutex.Lock()
+	for _, rep := range s.reporters.reporters {
+		info.Reporters = append(info.Reporters, RegistryEntry{
+			Name:     rep.Name,
+			Type:     rep.Type,
+			Callback: rep.Callback,
+			Live:     rep.LiveReport,
+			Batch:    rep.LiveBatch,
+			Filter:   rep.Filter,
+			Circuit:  s.breakers.info("reporter", rep.Name),
+		})
+	}
+	s.reporters.mutex.Unlock()
+
+	for _, entries := range [][]RegistryEntry{info.Actors, info.Drivers, info.Reporters} {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	}
+
+	return info
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// preconfiguredSections are the config sections whose entries register
+// extensions. They are set up again or removed when the config file changes.
+var preconfiguredSections = []struct {
+	section string
+	setup   func(s *Server, name string)
+	remove  func(s *Server, name string)
+}{
+	{"actors", (*Server).setupPreconfiguredActor, (*Server).removePreconfiguredActor},
+	{"drivers", (*Server).setupPreconfiguredDriver, (*Server).removePreconfiguredDriver},
+	{"reporter", (*Server).setupPreconfiguredReporter, (*Server).removePreconfiguredReporter},
+}
+
+// watchConfig reloads the configuration whenever the config file or one of
+// the files it includes changes. Extensions that were added, changed or
+// removed in the actors, drivers and reporter sections are registered again
+// or removed. All other settings are read at use time and apply with the
+// next request, running sessions are kept.
+func (s *Server) watchConfig() {
+	s.configState.mutex.Lock()
+	files := len(s.configState.files)
+	s.configState.mutex.Unlock()
+	if files == 0 {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		s.logger.With("error", err).Warn("Could not watch config files for changes.")
+		return
+	}
+	watched := map[string]bool{}
+	s.watchConfigFiles(watcher, watched)
+
+	previous := flattenSettings(s.config.AllSettings())
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 || !s.isLoadedConfigFile(event.Name) {
+					continue
+				}
+
+				s.configReloadMutex.Lock()
+				previous = s.reloadConfig(event.Name, previous)
+				s.configReloadMutex.Unlock()
+				s.watchConfigFiles(watcher, watched)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				s.logger.With("error", err).Warn("Error while watching config files.")
+			}
+		}
+	}()
+}
+
+// watchConfigFiles watches the directories of all loaded config files that
+// are not watched yet. The directories are watched so that files replaced by
+// editors are noticed.
+func (s *Server) watchConfigFiles(watcher *fsnotify.Watcher, watched map[string]bool) {
+	s.configState.mutex.Lock()
+	files := append([]string(nil), s.configState.files...)
+	s.configState.mutex.Unlock()
+
+	for _, file := range files {
+		if watched[file] {
+			continue
+		}
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			s.logger.With("file", file, "error", err).Warn("Could not watch config file for changes.")
+			continue
+		}
+		watched[file] = true
+		s.logger.With("file", file).Info("Watching config file for changes.")
+	}
+}
+
+func (s *Server) isLoadedConfigFile(name string) bool {
+	name = filepath.Clean(name)
+	s.configState.mutex.Lock()
+	defer s.configState.mutex.Unlock()
+	return indexOf(s.configState.files, name) >= 0
+}
+
+// reloadConfig reads the changed configuration and applies it. The new
+// configuration is built from the files, environment variables, flags and
+// settings and replaces the current one at once. The previous configuration
+// is kept if the files are invalid.
+func (s *Server) reloadConfig(changed string, previous map[string]any) map[string]any {
+	s.configState.mutex.Lock()
+	file, profile := s.configState.files[0], s.configState.profile
+	s.configState.mutex.Unlock()
+
+	doc, err := loadConfigFile(file, profile)
+	if err != nil {
+		s.logger.With("file", changed, "errors", err.Error()).Error("Changed config file is invalid. Keeping the previous configuration.")
+		return previous
+	}
+	if len(doc.Root.Content) == 0 {
+		s.logger.With("file", changed).Warn("Changed config file is empty. Keeping the previous configuration.")
+		return previous
+	}
+	v := newConfigViper()
+	if err := useConfigDocument(v, doc); err != nil {
+		s.logger.With("file", changed, "error", err).Error("Could not apply changed config file. Keeping the previous configuration.")
+		return previous
+	}
+	if err := s.applyOverrides(v, s.options); err != nil {
+		s.logger.With("file", changed, "error", err).Error("Could not apply overrides to changed config file. Keeping the previous configuration.")
+		return previous
+	}
+	s.config.swap(v)
+	s.useConfigFiles(doc)
+	s.applyLogLevel()
+
+	current := flattenSettings(v.AllSettings())
+	s.applyConfigChange(previous, current)
+	return current
+}
+
+// applyConfigChange logs the difference between the previous and the current
+// settings and updates the preconfigured extensions accordingly.
+func (s *Server) applyConfigChange(previous, current map[string]any) {
+	added, removed, changed := s.diffSettings(previous, current)
+	if len(added)+len(removed)+len(changed) == 0 {
+		s.logger.Info("Config file changed without effective changes.")
+		return
+	}
+	s.logger.With("added", added, "removed", removed, "changed", changed).Info("Configuration reloaded.")
+
+	for _, section := range preconfiguredSections {
+		before := sectionEntries(previous, section.section)
+		after := sectionEntries(current, section.section)
+
+		for name, entry := range after {
+			if old, ok := before[name]; ok && reflect.DeepEqual(old, entry) {
+				continue
+			}
+			s.logger.With("section", section.section, "name", name).Info("Setting up changed preconfigured extension.")
+			go section.setup(s, name)
+		}
+
+		for name := range before {
+			if _, ok := after[name]; ok {
+				continue
+			}
+			s.logger.With("section", section.section, "name", name).Info("Removing preconfigured extension.")
+			section.remove(s, name)
+		}
+	}
+}
+
+func (s *Server) removePreconfiguredActor(name string) {
+	s.actorsMutex.Lock()
+	defer s.actorsMutex.Unlock()
+	delete(s.actors, name)
+	s.breakers.reset("actor", name)
+}
+
+func (s *Server) removePreconfiguredDriver(name string) {
+	s.drivers.mutex.Lock()
+	defer s.drivers.mutex.Unlock()
+	delete(s.drivers.drivers, name)
+	s.breakers.reset("driver", name)
+}
+
+func (s *Server) removePreconfiguredReporter(name string) {
+	s.reporters.RemoveReporter(name)
+}
+
+// flattenSettings turns nested settings into a map of dotted keys like
+// "actors.example.callback".
+func flattenSettings(settings map[string]any) map[string]any {
+	flat := make(map[string]any)
+	var walk func(prefix string, value any)
+	walk = func(prefix string, value any) {
+		if m, ok := value.(map[string]any); ok && len(m) > 0 {
+			for k, v := range m {
+				key := strings.ToLower(k)
+				if prefix != "" {
+					key = prefix + "." + key
+				}
+				walk(key, v)
+			}
+			return
+		}
+		flat[prefix] = value
+	}
+	walk("", settings)
+	delete(flat, "")
+	return flat
+}
+
+// sectionEntries groups the flattened settings of a section by entry name.
+func sectionEntries(flat map[string]any, section string) map[string]map[string]any {
+	entries := make(map[string]map[string]any)
+	for key, value := range flat {
+		rest, ok := strings.CutPrefix(key, section+".")
+		if !ok {
+			continue
+		}
+		name, setting, _ := strings.Cut(rest, ".")
+		if entries[name] == nil {
+			entries[name] = make(map[string]any)
+		}
+		entries[name][setting] = value
+	}
+	return entries
+}
+
+// diffSettings describes the differences between two flattened settings.
+// Values of sensitive keys are redacted.
+func (s *Server) diffSettings(previous, current map[string]any) (added, removed, changed []string) {
+	for key, value := range current {
+		old, ok := previous[key]
+		switch {
+		case !ok:
+			added = append(added, fmt.Sprintf("%s=%s", key, s.describeSetting(key, value)))
+		case !reflect.DeepEqual(old, value):
+			changed = append(changed, fmt.Sprintf("%s: %s -> %s", key, s.describeSetting(key, old), s.describeSetting(key, value)))
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+func (s *Server) describeSetting(key string, value any) string {
+	if s.isSensitiveKey(key[strings.LastIndex(key, ".")+1:]) {
+		return redactedValue
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFlattenAndDiffSettings(t *testing.T) {
+	s := newTestServer(t)
+	previous := flattenSettings(map[string]any{
+		"port": 8080,
+		"actors": map[string]any{
+			"web": map[string]any{"callback": "http://localhost:9092", "secret": "old"},
+		},
+		"session": map[string]any{"history": 100},
+	})
+	current := flattenSettings(map[string]any{
+		"port": 8080,
+		"actors": map[string]any{
+			"web": map[string]any{"callback": "http://localhost:9099", "secret": "new"},
+		},
+		"reporter": map[string]any{"junit": map[string]any{"type": "junit"}},
+	})
+
+	added, removed, changed := s.diffSettings(previous, current)
+	if diff := cmp.Diff([]string{"reporter.junit.type=junit"}, added); diff != "" {
+		t.Errorf("Unexpected added settings (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"session.history"}, removed); diff != "" {
+		t.Errorf("Unexpected removed settings (-want +got):\n%s", diff)
+	}
+	expected := []string{
+		"actors.web.callback: http://localhost:9092 -> http://localhost:9099",
+		"actors.web.secret: *** -> ***",
+	}
+	if diff := cmp.Diff(expected, changed); diff != "" {
+		t.Errorf("Unexpected changed settings (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyConfigChange(t *testing.T) {
+	s := newTestServer(t)
+	dir := t.TempDir()
+
+	s.actorsMutex.Lock()
+	s.actors["removedactor"] = ActorInfo{Name: "removedactor", Type: "web", Callback: "http://localhost:1/"}
+	s.actorsMutex.Unlock()
+	s.drivers.AddDriver(Driver{Name: "keptdriver", Type: "api", Callback: "http://localhost:1/"})
+	t.Cleanup(func() { s.removePreconfiguredDriver("keptdriver") })
+
+	previous := map[string]any{
+		"actors.removedactor.callback": "http://localhost:1/",
+		"drivers.keptdriver.callback":  "http://localhost:1/",
+	}
+	s.config.Set("drivers.keptdriver.callback", "http://localhost:1/")
+	s.config.Set("reporter.reloaded.type", "html")
+	s.config.Set("reporter.reloaded.directory", dir)
+	current := flattenSettings(s.config.AllSettings())
+	t.Cleanup(func() { s.reporters.RemoveReporter("reloaded") })
+
+	s.applyConfigChange(previous, current)
+
+	waitForDelivery(t, func() bool {
+		_, ok := s.reporters.getReporter("reloaded")
+		return ok
+	})
+	s.actorsMutex.Lock()
+	_, actorKept := s.actors["removedactor"]
+	s.actorsMutex.Unlock()
+	if actorKept {
+		t.Errorf("Expected removed actor to be deregistered")
+	}
+	if s.drivers.GetDriverByType("api") == nil {
+		t.Errorf("Expected unchanged driver to stay registered")
+	}
+
+	s.applyConfigChange(current, map[string]any{"drivers.keptdriver.callback": "http://localhost:1/"})
+	if _, ok := s.reporters.getReporter("reloaded"); ok {
+		t.Errorf("Expected removed reporter to be deregistered")
+	}
+}
+
+func TestRequireSelfManagement(t *testing.T) {
+	s := newTestServer(t)
+
+	called := false
+	handler := s.requireSelfManagement("actor", func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/actor/", strings.NewReader("{}")))
+	if rec.Code != http.StatusForbidden || called {
+		t.Errorf("Expected request to be rejected, got %d", rec.Code)
+	}
+
+	s.config.Set("security.actor.selfManagement", true)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/actor/", strings.NewReader("{}")))
+	if !called {
+		t.Errorf("Expected request to be passed on after enabling self-management")
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	s := newTestServer(t)
+
+	if got := s.sessionTimeout(); got != defaultSessionTimeout {
+		t.Errorf("Expected default timeout, got %s", got)
+	}
+	s.config.Set("session.timeout", "30s")
+	if got := s.sessionTimeout(); got != 30*time.Second {
+		t.Errorf("Expected configured timeout, got %s", got)
+	}
+}
+
+func TestReloadConfigWhileReading(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "babylon.yaml")
+	os.WriteFile(file, []byte("session:\n  history: 10\nscenarios:\n  directory: fromFile\n"), 0644)
+	t.Setenv("BABYLON_SCENARIOS_DIRECTORY", "fromEnv")
+
+	s := newTestServer(t, WithConfigFile(file), WithEnvironment(), WithSetting("session.timeout", "1m"))
+	previous := flattenSettings(s.config.AllSettings())
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var mismatches sync.Map
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if got := s.config.GetString("scenarios.directory"); got != "fromEnv" {
+					mismatches.Store("scenarios.directory", got)
+				}
+				if got := s.sessionTimeout(); got != time.Minute {
+					mismatches.Store("session.timeout", got)
+				}
+				s.config.GetInt("session.history")
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		os.WriteFile(file, []byte(fmt.Sprintf("session:\n  history: %d\nscenarios:\n  directory: fromFile\n", i+1)), 0644)
+		previous = s.reloadConfig(file, previous)
+	}
+	close(stop)
+	wg.Wait()
+
+	mismatches.Range(func(key, value any) bool {
+		t.Errorf("Expected override of %s to apply during reloads, got %v", key, value)
+		return true
+	})
+	if got := s.config.GetInt("session.history"); got != 20 {
+		t.Errorf("Expected reloaded history of 20, got %d", got)
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	reportStepPassed = "passed"
+	reportStepFailed = "failed"
+	reportStepBroken = "broken"
+)
+
+// sessionReport is the view of a finished session that the builtin reporters
+// render. The actions of the session are reconstructed from its log.
+type sessionReport struct {
+	Session      *SessionInfo
+	Log          []SessionLogMessage
+	Start        time.Time
+	Stop         time.Time
+	Steps        []*reportStep
+	GherkinSteps []*reportGherkinStep
+	Failures     []string
+}
+
+// reportStep is a single actor or driver action of a session including all
+// of its attempts.
+type reportStep struct {
+	Kind       string
+	Extension  string
+	Action     string
+	Parameters map[string]any
+	Attempts   int
+	Start      time.Time
+	Stop       time.Time
+	Status     string
+	ErrorCode  ErrorCode
+	Message    string
+	Data       any
+	Assertions []AssertionResult
+	Artifacts  []*Artifact
+	Log        []SessionLogMessage
+	// GherkinStep is the line of the Gherkin step that executed the action.
+	GherkinStep int
+}
+
+// reportGherkinStep is a Gherkin step of a feature session with the actions
+// that were executed for it. It takes the status of its first action that did
+// not pass, steps without binding are broken.
+type reportGherkinStep struct {
+	Name    string
+	Line    int
+	Status  string
+	Message string
+	Start   time.Time
+	Stop    time.Time
+	Steps   []*reportStep
+}
+
+func (s *reportGherkinStep) Duration() time.Duration {
+	return s.Stop.Sub(s.Start)
+}
+
+func (s *reportStep) Duration() time.Duration {
+	return s.Stop.Sub(s.Start)
+}
+
+func (s *reportStep) Title() string {
+	return fmt.Sprintf("%s %s: %s", s.Kind, s.Extension, s.Action)
+}
+
+func (r *sessionReport) Duration() time.Duration {
+	return r.Stop.Sub(r.Start)
+}
+
+// UnlinkedSteps returns the actions that were not executed for a Gherkin
+// step.
+func (r *sessionReport) UnlinkedSteps() []*reportStep {
+	var steps []*reportStep
+	for _, step := range r.Steps {
+		if step.GherkinStep == 0 {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+func (r *sessionReport) Name() string {
+	if r.Session.Name != "" {
+		return r.Session.Name
+	}
+	return r.Session.UUID.String()
+}
+
+// Failed reports whether the session failed or was aborted.
+func (r *sessionReport) Failed() bool {
+	status := r.Session.status()
+	return status == sessionStatusFailed || status == sessionStatusAborted
+}
+
+// Broken reports whether the session failed because an action could not be
+// executed rather than because an action or expectation failed. Aborted
+// sessions are always broken.
+func (r *sessionReport) Broken() bool {
+	if r.Session.status() == sessionStatusAborted {
+		return true
+	}
+	for _, step := range r.Steps {
+		if step.Status != reportStepPassed {
+			return step.Status == reportStepBroken
+		}
+	}
+	return false
+}
+
+// ErrorCode returns the error code of the first failed step.
+func (r *sessionReport) ErrorCode() ErrorCode {
+	for _, step := range r.Steps {
+		if step.Status != reportStepPassed {
+			return step.ErrorCode
+		}
+	}
+	return ""
+}
+
+// splitLogType splits a message type like "system::driver::selenium" into the
+// source ("system"), the category ("driver") and the name ("selenium").
+func splitLogType(msgType string) (source, category, name string) {
+	parts := strings.SplitN(msgType, "::", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// newSessionReport builds the report of the session from its log. All
+// entries of an action carry the number of its execution, so the attempts,
+// result and messages of actions that ran in parallel are told apart. In
+// feature sessions they also carry the line of their Gherkin step.
+func newSessionReport(sinfo *SessionInfo) *sessionReport {
+	sinfo = sinfo.snapshot()
+	log := sinfo.Context.Log
+
+	report := &sessionReport{Session: sinfo, Log: log}
+	if len(log) > 0 {
+		report.Start = log[0].TimeStamp
+		report.Stop = log[len(log)-1].TimeStamp
+	}
+
+	steps := map[int]*reportStep{}
+	gherkin := map[int]*reportGherkinStep{}
+	for _, msg := range log {
+		if msg.Execution == 0 {
+			if msg.MessageType == "system::gherkin::step" && msg.Step != 0 {
+				report.addGherkinMessage(gherkin, msg)
+			}
+			continue
+		}
+		source, category, name := splitLogType(msg.MessageType)
+
+		step := steps[msg.Execution]
+		if step == nil {
+			step = &reportStep{Kind: category, Extension: name, Start: msg.TimeStamp, Status: reportStepBroken, GherkinStep: msg.Step}
+			steps[msg.Execution] = step
+			report.Steps = append(report.Steps, step)
+		}
+
+		switch data := msg.Data.(type) {
+		case *ActionRequestData:
+			step.Action = data.Action
+			step.Parameters = data.Parameters
+			step.Attempts = data.Attempt
+		case *ActionResultData:
+			step.Action = data.Action
+			step.ErrorCode = data.ErrorCode
+			step.Data = data.Data
+			switch {
+			case data.Success:
+				step.Status = reportStepPassed
+			case data.ErrorCode == ErrorCodeActionFailed:
+				step.Status = reportStepFailed
+				step.Message = msg.Message
+			default:
+				step.Status = reportStepBroken
+				step.Message = msg.Message
+			}
+		case *Artifact:
+			step.Artifacts = append(step.Artifacts, data)
+		case AssertionResult:
+			step.Assertions = append(step.Assertions, data)
+			if !data.Passed {
+				step.Status = reportStepFailed
+				step.ErrorCode = ErrorCodeAssertion
+			}
+		}
+
+		if source == "message" {
+			step.Message = msg.Message
+		}
+		step.Log = append(step.Log, msg)
+		step.Stop = msg.TimeStamp
+	}
+
+	for _, step := range report.Steps {
+		if gs := gherkin[step.GherkinStep]; gs != nil {
+			gs.Steps = append(gs.Steps, step)
+			if step.Stop.After(gs.Stop) {
+				gs.Stop = step.Stop
+			}
+			if gs.Status == reportStepPassed && step.Status != reportStepPassed {
+				gs.Status = step.Status
+				gs.Message = step.Message
+			}
+		}
+		if step.Status == reportStepPassed {
+			continue
+		}
+
+		failure := fmt.Sprintf("%s: %s", step.Title(), step.Message)
+		for _, ar := range step.Assertions {
+			if !ar.Passed {
+				failure += "\n  " + ar.describe()
+			}
+		}
+		report.Failures = append(report.Failures, failure)
+	}
+
+	if report.Failed() && len(report.Failures) == 0 && len(log) > 0 {
+		report.Failures = append(report.Failures, log[len(log)-1].Message)
+	}
+	return report
+}
+
+// addGherkinMessage adds a Gherkin step on its first message. Further
+// messages of the step report that it has no binding or its binding failed.
+func (r *sessionReport) addGherkinMessage(gherkin map[int]*reportGherkinStep, msg SessionLogMessage) {
+	gs := gherkin[msg.Step]
+	if gs == nil {
+		gs = &reportGherkinStep{Name: msg.Message, Line: msg.Step, Status: reportStepPassed, Start: msg.TimeStamp, Stop: msg.TimeStamp}
+		gherkin[msg.Step] = gs
+		r.GherkinSteps = append(r.GherkinSteps, gs)
+		return
+	}
+	gs.Status = reportStepBroken
+	gs.Message = msg.Message
+	gs.Stop = msg.TimeStamp
+}
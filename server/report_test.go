@@ -0,0 +1,160 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const reportTestScenario = `
+name: Report
+vars:
+  password: hunter2
+continueOnFailure: true
+steps:
+  - driver: scenarioDriver
+    action: open
+    parameters:
+      url: http://shop
+      password: ${vars.password}
+  - driver: scenarioDriver
+    action: check
+    parameters:
+      total: 3
+    expect:
+      - path: $.data.total
+        value: 4
+  - driver: scenarioDriver
+    action: fail
+  - driver: unknownDriver
+    action: open
+`
+
+// runReportTestScenario runs the scenario and returns its finished session.
+func runReportTestScenario(t *testing.T, s *Server, data string) *SessionInfo {
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	sc, err := parseScenario([]byte(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result := s.runScenario(sc)
+	sinfo := s.sessions.getFinishedSession(uuid.MustParse(result.Session))
+	if sinfo == nil {
+		t.Fatalf("Expected finished session")
+	}
+	return sinfo
+}
+
+func TestNewSessionReport(t *testing.T) {
+	s := newTestServer(t)
+	report := newSessionReport(runReportTestScenario(t, s, reportTestScenario))
+
+	if !report.Failed() || report.Name() != "Report" {
+		t.Errorf("Unexpected report header name=%q failed=%v", report.Name(), report.Failed())
+	}
+	if len(report.Steps) != 4 {
+		t.Fatalf("Expected 4 steps, got %d", len(report.Steps))
+	}
+
+	open := report.Steps[0]
+	if open.Status != reportStepPassed || open.Action != "open" || open.Kind != "driver" || open.Extension != "scenarioDriver" {
+		t.Errorf("Unexpected first step %+v", open)
+	}
+	if open.Parameters["url"] != "http://shop" || open.Parameters["password"] != redactedValue {
+		t.Errorf("Expected redacted parameters, got %v", open.Parameters)
+	}
+	if open.Duration() < 0 || open.Start.Before(report.Start) || open.Stop.After(report.Stop) {
+		t.Errorf("Unexpected step timing %s - %s", open.Start, open.Stop)
+	}
+
+	check := report.Steps[1]
+	if check.Status != reportStepFailed || check.ErrorCode != ErrorCodeAssertion || len(check.Assertions) != 1 {
+		t.Errorf("Expected failed assertion step, got %+v", check)
+	}
+	if fail := report.Steps[2]; fail.Status != reportStepFailed || fail.Message != "fail" {
+		t.Errorf("Expected failed action step, got %+v", fail)
+	}
+
+	if unknown := report.Steps[3]; unknown.Status != reportStepBroken || unknown.ErrorCode != ErrorCodeNoExtension {
+		t.Errorf("Expected broken step for unknown driver, got %+v", unknown)
+	}
+
+	if len(report.Failures) != 3 || !strings.Contains(report.Failures[0], "Assertion failed") {
+		t.Errorf("Unexpected failures %q", report.Failures)
+	}
+	if report.ErrorCode() != ErrorCodeAssertion {
+		t.Errorf("Expected error code of first failed step, got %s", report.ErrorCode())
+	}
+}
+
+func TestNewSessionReportInterleavedActions(t *testing.T) {
+	s := newTestServer(t)
+	sinfo := s.newSession("Parallel", nil)
+
+	// two actions of a parallel batch, the second one finishes first
+	start := time.Now()
+	sinfo.Context.Log = []SessionLogMessage{
+		{TimeStamp: start, MessageType: "system::driver::web", Execution: 1, Data: &ActionRequestData{Action: "slow", Attempt: 1}},
+		{TimeStamp: start, MessageType: "system::driver::web", Execution: 2, Data: &ActionRequestData{Action: "fast", Attempt: 1}},
+		{TimeStamp: start.Add(time.Second), MessageType: "system::driver::web", Execution: 2, Data: &ActionResultData{Action: "fast", ErrorCode: ErrorCodeActionFailed}},
+		{TimeStamp: start.Add(time.Second), MessageType: "message::driver::web", Execution: 2, Message: "not found"},
+		{TimeStamp: start.Add(3 * time.Second), MessageType: "system::driver::web", Execution: 1, Data: &ActionResultData{Action: "slow", Success: true}},
+	}
+	report := newSessionReport(sinfo)
+
+	if len(report.Steps) != 2 {
+		t.Fatalf("Expected 2 steps, got %d", len(report.Steps))
+	}
+	if slow := report.Steps[0]; slow.Action != "slow" || slow.Status != reportStepPassed || slow.Duration() != 3*time.Second {
+		t.Errorf("Unexpected slow step %+v", slow)
+	}
+	if fast := report.Steps[1]; fast.Action != "fast" || fast.Status != reportStepFailed || fast.Message != "not found" || fast.Duration() != time.Second {
+		t.Errorf("Unexpected fast step %+v", fast)
+	}
+}
+
+func TestNewSessionReportGherkinSteps(t *testing.T) {
+	s := newTestServer(t)
+	sinfo := s.newSession("Shop: Browse", nil)
+
+	// the steps are linked by their line, not by the time they started
+	now := time.Now()
+	sinfo.Context.Log = []SessionLogMessage{
+		{TimeStamp: now, MessageType: "system::gherkin::step", Message: "Given I open the shop", Step: 3, Data: map[string]any{"line": 3}},
+		{TimeStamp: now, MessageType: "system::driver::web", Execution: 1, Step: 3, Data: &ActionRequestData{Action: "open", Attempt: 1}},
+		{TimeStamp: now, MessageType: "system::gherkin::step", Message: "And I fly away", Step: 4, Data: map[string]any{"line": 4}},
+		{TimeStamp: now, MessageType: "system::gherkin::step", Message: "Step 'I fly away' is undefined.", Step: 4},
+		{TimeStamp: now, MessageType: "system::driver::web", Execution: 1, Step: 3, Data: &ActionResultData{Action: "open", Success: true}},
+		{TimeStamp: now, MessageType: "system::driver::web", Execution: 2, Data: &ActionResultData{Action: "cleanup", Success: true}},
+	}
+	report := newSessionReport(sinfo)
+
+	if len(report.GherkinSteps) != 2 {
+		t.Fatalf("Expected 2 gherkin steps, got %d", len(report.GherkinSteps))
+	}
+	if open := report.GherkinSteps[0]; open.Line != 3 || open.Status != reportStepPassed || len(open.Steps) != 1 || open.Steps[0].Action != "open" {
+		t.Errorf("Expected action nested into its gherkin step, got %+v", open)
+	}
+	if undefined := report.GherkinSteps[1]; undefined.Status != reportStepBroken || len(undefined.Steps) != 0 || !strings.Contains(undefined.Message, "undefined") {
+		t.Errorf("Expected broken gherkin step without actions, got %+v", undefined)
+	}
+	if unlinked := report.UnlinkedSteps(); len(unlinked) != 1 || unlinked[0].Action != "cleanup" {
+		t.Errorf("Expected cleanup action outside of gherkin steps, got %+v", unlinked)
+	}
+
+	if out := junitSystemOut(report); !strings.Contains(out, "  [passed] Given I open the shop (0.000s)\n    [passed] driver web: open") {
+		t.Errorf("Expected action below its gherkin step, got %s", out)
+	}
+
+	var html strings.Builder
+	if err := renderSessionHTML(&html, report); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(html.String(), "Given I open the shop <small>line 3, &#43;0.000s, 0.000s</small></summary>\n<details class=\"step passed\">") {
+		t.Errorf("Expected action nested into gherkin step, got %s", html.String())
+	}
+}
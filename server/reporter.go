@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"bytes"
@@ -8,25 +8,60 @@ import (
 	"net/http"
 	"strings"
 	"sync"
-
-	"github.com/spf13/viper"
 )
 
 type ReporterRegister struct {
+	server    *Server
 	mutex     sync.Mutex
 	reporters map[string]ReporterInfo
 }
 
 type ReporterInfo struct {
 	Name       string `json:"name"`
+	Type       string `json:"type,omitempty"`
 	Callback   string `json:"callback"`
 	LiveReport bool   `json:"live"`
+	LiveBatch  bool   `json:"batch,omitempty"`
+
+	Filter *ReporterFilter `json:"filter,omitempty"`
+
+	builtin builtinReporter
+}
+
+// builtinReporter is a reporter that runs inside the server. It is configured
+// in the reporter section with a type instead of a callback.
+type builtinReporter interface {
+	reportSession(session *SessionInfo) error
+}
+
+// suiteReporter is implemented by builtin reporters that report suites as a
+// whole in addition to single sessions.
+type suiteReporter interface {
+	reportSuite(suite *SuiteInfo, sessions []*SessionInfo) error
+}
+
+// builtinReporterTypes creates the builtin reporters by type from the
+// configuration of the named reporter.
+var builtinReporterTypes = map[string]func(s *Server, name string) (builtinReporter, error){
+	"allure":  newAllureReporter,
+	"html":    newHTMLReporter,
+	"junit":   newJUnitReporter,
+	"webhook": newWebhookReporter,
 }
 
 func (r *ReporterRegister) AddReporter(reporter ReporterInfo) {
+	r.addReporter(reporter.Name, reporter)
+}
+
+// addReporter registers the reporter under the key and releases the messages
+// that were held for it since the last start.
+func (r *ReporterRegister) addReporter(key string, reporter ReporterInfo) {
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	r.reporters[reporter.Name] = reporter
+	r.reporters[key] = reporter
+	r.server.breakers.reset("reporter", reporter.Name)
+	r.mutex.Unlock()
+
+	r.server.deliveries.release(reporter.Name)
 }
 
 func (r *ReporterRegister) RemoveReporter(name string) {
@@ -35,41 +70,54 @@ func (r *ReporterRegister) RemoveReporter(name string) {
 	delete(r.reporters, name)
 }
 
-func (r *ReporterRegister) GetReporters() map[string]ReporterInfo {
+func (r *ReporterRegister) getReporter(name string) (ReporterInfo, bool) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	return r.reporters
+	reporter, ok := r.reporters[name]
+	return reporter, ok
 }
 
-var reporters ReporterRegister
+// list returns a snapshot of all reporters so that callers do not need to
+// hold the register lock while sending.
+func (r *ReporterRegister) list() []ReporterInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 
-func init() {
-	reporters = ReporterRegister{
-		reporters: make(map[string]ReporterInfo),
+	list := make([]ReporterInfo, 0, len(r.reporters))
+	for _, reporter := range r.reporters {
+		list = append(list, reporter)
 	}
+	return list
+}
+
+func (r *ReporterRegister) GetReporters() map[string]ReporterInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.reporters
 }
 
 type ReporterDeleteRequest struct {
 	Name string `json:"name"`
 }
 
-func registerReporter(w http.ResponseWriter, r *http.Request) {
-	reporters.mutex.Lock()
-	defer reporters.mutex.Unlock()
-
+func (s *Server) registerReporter(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		var req ReporterInfo
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if err := req.Filter.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		if req.Callback == "" {
 			req.Callback = fmt.Sprintf("http://%s:8080/", strings.Split(r.RemoteAddr, ":")[0])
 		}
 
-		reporters.AddReporter(ReporterInfo(req))
-		logger.With("name", req.Name, "callback", req.Callback, "live_report", req.LiveReport).Info("New reporter registered.")
+		s.reporters.AddReporter(ReporterInfo(req))
+		s.logger.With("name", req.Name, "callback", req.Callback, "live_report", req.LiveReport).Info("New reporter registered.")
 		return
 	} else if r.Method == http.MethodDelete {
 		var req ReporterDeleteRequest
@@ -78,42 +126,69 @@ func registerReporter(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		reporters.RemoveReporter(req.Name)
-		logger.With("name", req.Name).Info("Reporter deleted.")
+		s.reporters.RemoveReporter(req.Name)
+		s.logger.With("name", req.Name).Info("Reporter deleted.")
 		return
 	}
 
 	http.Error(w, "invalid HTTP method", http.StatusBadRequest)
 }
 
-func sendSessionReport(session *SessionInfo) {
-	reporters.mutex.Lock()
-	defer reporters.mutex.Unlock()
+func (s *Server) sendSessionReport(session *SessionInfo) {
+	if session == nil {
+		return
+	}
+	session = session.snapshot()
 
-	for _, reporter := range reporters.reporters {
-		go endReportBy(&reporter, session)
+	for _, reporter := range s.reporters.list() {
+		if !reporter.Filter.matchesSession(session) {
+			continue
+		}
+		s.reports.Add(1)
+		go func() {
+			defer s.reports.Done()
+			s.endReportBy(&reporter, session)
+		}()
 	}
 }
 
-func endReportBy(reporter *ReporterInfo, session *SessionInfo) {
-	reportURL := fmt.Sprintf("%sreporter/%s/report", reporter.Callback, strings.ToLower(reporter.Name))
-	reqJSON, err := json.Marshal(session)
-	if err != nil {
-		logger.With("reporter", reporter.Name, "error", err, "session", session.UUID.String()).Error("Failed to marshal session report.")
-		return
+// sendSuiteReport passes a finished suite to all builtin reporters that report
+// suites.
+func (s *Server) sendSuiteReport(suite *SuiteInfo, sessions []*SessionInfo) {
+	snapshots := make([]*SessionInfo, len(sessions))
+	for i, sinfo := range sessions {
+		snapshots[i] = sinfo.snapshot()
 	}
 
-	resp, err := http.Post(reportURL, "application/json", bytes.NewBuffer(reqJSON))
-	if err != nil {
-		logger.With("reporter", reporter.Name, "error", err, "session", session.UUID.String()).Error("Failed to send session report.")
-		return
+	s.reporters.mutex.Lock()
+	defer s.reporters.mutex.Unlock()
+
+	for _, reporter := range s.reporters.reporters {
+		sr, ok := reporter.builtin.(suiteReporter)
+		if !ok {
+			continue
+		}
+
+		s.reports.Add(1)
+		go func() {
+			defer s.reports.Done()
+			if err := sr.reportSuite(suite, snapshots); err != nil {
+				s.logger.With("reporter", reporter.Name, "error", err, "suite", suite.ID.String()).Error("Failed to write suite report.")
+			}
+		}()
 	}
+}
 
-	if resp.StatusCode != http.StatusOK {
-		logger.With("reporter", reporter.Name, "status", resp.Status, "session", session.UUID.String()).Error("Session report failed. Check Reporter log.")
+func (s *Server) endReportBy(reporter *ReporterInfo, session *SessionInfo) {
+	if reporter.builtin != nil {
+		if err := reporter.builtin.reportSession(session); err != nil {
+			s.metrics.reporterFailures.inc(reporter.Name, "error")
+			s.logger.With("reporter", reporter.Name, "error", err, "session", session.UUID.String()).Error("Failed to write session report.")
+		}
+		return
 	}
 
-	resp.Body.Close()
+	s.reporterWorkers.get(reporter.Name).add(reporterWorkerEntry{session: session.UUID.String(), report: session})
 }
 
 type LiveLogMessageData struct {
@@ -121,37 +196,19 @@ type LiveLogMessageData struct {
 	Message SessionLogMessage `json:"message"`
 }
 
-func sendLiveLogMessage(session *SessionInfo, logMessage SessionLogMessage) {
-	reporters.mutex.Lock()
-	defer reporters.mutex.Unlock()
-
-	for _, reporter := range reporters.reporters {
-		if !reporter.LiveReport {
+// sendLiveLogMessage passes the message to the workers of all live reporters.
+// It blocks while the buffer of a worker is full. Only the live lock of the
+// session may be held, so that just the session that logs waits.
+func (s *Server) sendLiveLogMessage(session *SessionInfo, logMessage SessionLogMessage) {
+	for _, reporter := range s.reporters.list() {
+		if !reporter.LiveReport || reporter.builtin != nil || !reporter.Filter.matchesMessage(session, logMessage) {
 			continue
 		}
-
-		reportURL := fmt.Sprintf("%sreporter/%s/live", reporter.Callback, strings.ToLower(reporter.Name))
-		data := LiveLogMessageData{
-			UUID:    session.UUID.String(),
-			Message: logMessage,
-		}
-		reqJSON, err := json.Marshal(data)
-		if err != nil {
-			logger.With("reporter", reporter.Name, "error", err, "session", session.UUID.String()).Error("Failed to marshal live log message.")
-			continue
-		}
-
-		resp, err := http.Post(reportURL, "application/json", bytes.NewBuffer(reqJSON))
-		if err != nil {
-			logger.With("reporter", reporter.Name, "error", err, "session", session.UUID.String()).Error("Failed to send live log message.")
-			continue
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			logger.With("reporter", reporter.Name, "status", resp.Status, "session", session.UUID.String()).Error("Live logging to reporter failed. Check Reporter log.")
-		}
-
-		resp.Body.Close()
+		s.reporterWorkers.get(reporter.Name).add(reporterWorkerEntry{
+			session: session.UUID.String(),
+			message: &logMessage,
+			batch:   reporter.LiveBatch,
+		})
 	}
 }
 
@@ -161,20 +218,53 @@ type reporterRegisterRequest struct {
 	Callback string `json:"callback"`
 	Secret   string `json:"secret"`
 	Live     bool   `json:"live"`
+	Batch    bool   `json:"batch"`
 }
 
-func setupPreconfiguredReporter(name string) {
-	reporters.mutex.Lock()
-	defer reporters.mutex.Unlock()
+// setupBuiltinReporter creates and registers a builtin reporter of the type.
+func (s *Server) setupBuiltinReporter(name, reporterType string) {
+	create, ok := builtinReporterTypes[reporterType]
+	if !ok {
+		s.logger.With("reporter", name, "type", reporterType).Error("Unknown builtin reporter type.")
+		return
+	}
 
-	if !viper.IsSet(fmt.Sprintf("reporter.%s.callback", name)) {
-		logger.With("reporter", name).Error("Preconfigured reporter is missing callback.")
+	builtin, err := create(s, name)
+	if err != nil {
+		s.logger.With("reporter", name, "type", reporterType, "error", err).Error("Invalid builtin reporter configuration.")
+		return
+	}
+
+	filter, err := s.reporterFilterFromConfig(name)
+	if err != nil {
+		s.logger.With("reporter", name, "type", reporterType, "error", err).Error("Invalid builtin reporter configuration.")
+		return
+	}
+
+	s.reporters.AddReporter(ReporterInfo{Name: name, Type: reporterType, Filter: filter, builtin: builtin})
+	s.logger.With("reporter", name, "type", reporterType).Info("Builtin reporter registered.")
+}
+
+func (s *Server) setupPreconfiguredReporter(name string) {
+	if reporterType := s.config.GetString(fmt.Sprintf("reporter.%s.type", name)); reporterType != "" {
+		s.setupBuiltinReporter(name, reporterType)
 		return
 	}
 
-	callback := viper.GetString(fmt.Sprintf("reporter.%s.callback", name))
-	secret := viper.GetString(fmt.Sprintf("reporter.%s.secret", name))
-	if !viper.IsSet(fmt.Sprintf("reporter.%s.secret", name)) {
+	if !s.config.IsSet(fmt.Sprintf("reporter.%s.callback", name)) {
+		s.logger.With("reporter", name).Error("Preconfigured reporter is missing callback.")
+		return
+	}
+
+	filter, err := s.reporterFilterFromConfig(name)
+	if err != nil {
+		s.logger.With("reporter", name, "error", err).Error("Invalid reporter filter.")
+		return
+	}
+
+	callback := s.config.GetString(fmt.Sprintf("reporter.%s.callback", name))
+	secret := s.config.GetString(fmt.Sprintf("reporter.%s.secret", name))
+	if !s.config.IsSet(fmt.Sprintf("reporter.%s.secret", name)) {
 		secret = ""
 	}
 
@@ -184,22 +274,22 @@ func setupPreconfiguredReporter(name string) {
 
 	reporterURL := fmt.Sprintf("%sreporter/%s/serverConnect", callback, name)
 	req := ReporterInfo{
-		Callback: fmt.Sprintf("http://%s:%d/", viper.GetString("hostname"), viper.GetInt("port")),
+		Callback: s.callbackURL(),
 	}
 	reqJSON, err := json.Marshal(req)
 	if err != nil {
-		logger.With("reporter", name, "error", err).Error("Failed to marshal server side registration request.")
+		s.logger.With("reporter", name, "error", err).Error("Failed to marshal server side registration request.")
 		return
 	}
 
 	resp, err := http.Post(reporterURL, "application/json", bytes.NewBuffer(reqJSON))
 	if err != nil {
-		logger.With("reporter", name, "error", err).Error("Failed to attach server to reporter.")
+		s.logger.With("reporter", name, "error", err).Error("Failed to attach server to reporter.")
 		return
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		logger.With("reporter", name, "statusCode", resp.StatusCode).Error("Failed to attach server to reporter. Check reporter logs.")
+		s.logger.With("reporter", name, "statusCode", resp.StatusCode).Error("Failed to attach server to reporter. Check reporter logs.")
 		return
 	}
 
@@ -207,25 +297,29 @@ func setupPreconfiguredReporter(name string) {
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.With("reporter", name, "error", err).Error("Failed reading reporter response on server side registration.")
+		s.logger.With("reporter", name, "error", err).Error("Failed reading reporter response on server side registration.")
 		return
 	}
 
 	var result reporterRegisterRequest
 	if err := json.Unmarshal(body, &result); err != nil {
-		logger.With("reporter", name, "error", err).Error("Failed parsing reporter response on server side registration.")
+		s.logger.With("reporter", name, "error", err).Error("Failed parsing reporter response on server side registration.")
 		return
 	}
 
 	if result.Secret != secret {
-		logger.With("reporter", name).Error("Server side reporter registration aborted. Invalid secret from reporter.")
+		s.logger.With("reporter", name).Error("Server side reporter registration aborted. Invalid secret from reporter.")
 		return
 	}
 
-	reporters.reporters[name] = ReporterInfo{
+	// the register is keyed by the name in the config, like all
+	// preconfigured extensions
+	s.reporters.addReporter(name, ReporterInfo{
 		Name:       result.Name,
 		Callback:   result.Callback,
 		LiveReport: result.Live,
-	}
-	logger.With("reporter", name).Info("Server side reporter registered.")
+		LiveBatch:  result.Batch,
+		Filter:     filter,
+	})
+	s.logger.With("reporter", name).Info("Server side reporter registered.")
 }
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// retryPolicy describes how often and when a failed extension action is
+// repeated. Policies are configured in the retry section per extension type
+// and may be refined per action:
+//
+//	retry:
+//	  drivers:
+//	    selenium:
+//	      maxAttempts: 3
+//	      backoff: 500ms
+//	      retryOn:
+//	        failures: false
+//	        messagePatterns: ["stale element"]
+//	      actions:
+//	        click:
+//	          maxAttempts: 5
+type retryPolicy struct {
+	MaxAttempts           int
+	Backoff               time.Duration
+	BackoffMultiplier     float64
+	MaxBackoff            time.Duration
+	RetryOnTransportError bool
+	RetryOnFailure        bool
+	MessagePatterns       []*regexp.Regexp
+}
+
+// retryPolicyFor returns the effective policy of an action. kind is either
+// "actors" or "drivers".
+func (s *Server) retryPolicyFor(kind, extensionType, action string) retryPolicy {
+	policy := retryPolicy{
+		MaxAttempts:           1,
+		BackoffMultiplier:     1,
+		RetryOnTransportError: true,
+	}
+
+	base := fmt.Sprintf("retry.%s.%s", kind, extensionType)
+	policy.apply(s, base)
+	policy.apply(s, fmt.Sprintf("%s.actions.%s", base, action))
+	return policy
+}
+
+// apply overrides all settings of the policy that are set below the given key
+// in the configuration of the server.
+func (p *retryPolicy) apply(s *Server, key string) {
+	if !s.config.IsSet(key) {
+		return
+	}
+
+	if s.config.IsSet(key + ".maxAttempts") {
+		p.MaxAttempts = s.config.GetInt(key + ".maxAttempts")
+	}
+
+	if s.config.IsSet(key + ".backoff") {
+		p.Backoff = s.config.GetDuration(key + ".backoff")
+	}
+
+	if s.config.IsSet(key + ".backoffMultiplier") {
+		p.BackoffMultiplier = s.config.GetFloat64(key + ".backoffMultiplier")
+	}
+
+	if s.config.IsSet(key + ".maxBackoff") {
+		p.MaxBackoff = s.config.GetDuration(key + ".maxBackoff")
+	}
+
+	if s.config.IsSet(key + ".retryOn.transportErrors") {
+		p.RetryOnTransportError = s.config.GetBool(key + ".retryOn.transportErrors")
+	}
+
+	if s.config.IsSet(key + ".retryOn.failures") {
+		p.RetryOnFailure = s.config.GetBool(key + ".retryOn.failures")
+	}
+
+	if s.config.IsSet(key + ".retryOn.messagePatterns") {
+		p.MessagePatterns = nil
+		for _, pattern := range s.config.GetStringSlice(key + ".retryOn.messagePatterns") {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				s.logger.With("key", key, "pattern", pattern, "error", err).Warn("Ignoring invalid retry message pattern.")
+				continue
+			}
+			p.MessagePatterns = append(p.MessagePatterns, re)
+		}
+	}
+}
+
+// shouldRetry decides whether an attempt with the given outcome is repeated
+// and returns a human readable reason for the retry. Of the errors only
+// transport errors are retried, an invalid response would not get better.
+func (p *retryPolicy) shouldRetry(result *ExecutionResult, err error) (bool, string) {
+	if err != nil {
+		if errorCodeOf(err) != ErrorCodeTransport {
+			return false, ""
+		}
+		return p.RetryOnTransportError, fmt.Sprintf("transport error: %s", err.Error())
+	}
+
+	if result.Success {
+		return false, ""
+	}
+
+	if p.RetryOnFailure {
+		return true, "action reported failure"
+	}
+
+	for _, re := range p.MessagePatterns {
+		if re.MatchString(result.Message) {
+			return true, fmt.Sprintf("message matches '%s'", re.String())
+		}
+	}
+
+	return false, ""
+}
+
+// backoff returns the delay before the next attempt.
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.Backoff)
+	for i := 1; i < attempt; i++ {
+		delay *= p.BackoffMultiplier
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(delay)
+}
+
+// waitBackoff waits for the delay before the next attempt. It returns false
+// if done is closed first and no further attempt should be made.
+func waitBackoff(delay time.Duration, done <-chan struct{}) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyForActionOverride(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("retry.drivers.selenium.maxAttempts", 3)
+	s.config.Set("retry.drivers.selenium.backoff", "100ms")
+	s.config.Set("retry.drivers.selenium.retryOn.failures", true)
+	s.config.Set("retry.drivers.selenium.actions.click.maxAttempts", 5)
+
+	policy := s.retryPolicyFor("drivers", "selenium", "click")
+	if policy.MaxAttempts != 5 {
+		t.Errorf("Expected action override of 5 attempts, got %d", policy.MaxAttempts)
+	}
+	if policy.Backoff != 100*time.Millisecond {
+		t.Errorf("Expected backoff of 100ms, got %s", policy.Backoff)
+	}
+	if !policy.RetryOnFailure || !policy.RetryOnTransportError {
+		t.Errorf("Expected retry on failures and transport errors")
+	}
+
+	policy = s.retryPolicyFor("drivers", "selenium", "type")
+	if policy.MaxAttempts != 3 {
+		t.Errorf("Expected type policy of 3 attempts, got %d", policy.MaxAttempts)
+	}
+
+	policy = s.retryPolicyFor("actors", "selenium", "click")
+	if policy.MaxAttempts != 1 {
+		t.Errorf("Expected no retries for unconfigured actor, got %d attempts", policy.MaxAttempts)
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("retry.actors.shop.retryOn.transportErrors", false)
+	s.config.Set("retry.actors.shop.retryOn.messagePatterns", []string{"^timeout", "("})
+
+	policy := s.retryPolicyFor("actors", "shop", "order")
+	if len(policy.MessagePatterns) != 1 {
+		t.Fatalf("Expected invalid pattern to be ignored, got %d patterns", len(policy.MessagePatterns))
+	}
+
+	if retry, _ := policy.shouldRetry(nil, newCodedExecutionError(http.StatusInternalServerError, ErrorCodeTransport, "connection refused")); retry {
+		t.Errorf("Expected no retry on transport errors")
+	}
+	if retry, _ := policy.shouldRetry(&ExecutionResult{Success: false, Message: "timeout waiting"}, nil); !retry {
+		t.Errorf("Expected retry on matching message")
+	}
+	if retry, _ := policy.shouldRetry(&ExecutionResult{Success: false, Message: "out of stock"}, nil); retry {
+		t.Errorf("Expected no retry on non-matching message")
+	}
+	if retry, _ := policy.shouldRetry(&ExecutionResult{Success: true, Message: "timeout"}, nil); retry {
+		t.Errorf("Expected no retry on success")
+	}
+}
+
+func TestRetryPolicyRetriesOnlyTransportErrors(t *testing.T) {
+	policy := retryPolicy{MaxAttempts: 3, RetryOnTransportError: true}
+
+	if retry, _ := policy.shouldRetry(nil, newCodedExecutionError(http.StatusInternalServerError, ErrorCodeTransport, "connection refused")); !retry {
+		t.Errorf("Expected retry on transport errors")
+	}
+	if retry, _ := policy.shouldRetry(nil, newCodedExecutionError(http.StatusFailedDependency, ErrorCodeInvalidResponse, "invalid character")); retry {
+		t.Errorf("Expected no retry on invalid responses")
+	}
+	if retry, _ := policy.shouldRetry(nil, errors.New("internal")); retry {
+		t.Errorf("Expected no retry on internal errors")
+	}
+}
+
+func TestRetryBackoffEndsOnShutdown(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("retry.drivers.downDriver.maxAttempts", 3)
+	s.config.Set("retry.drivers.downDriver.backoff", "1m")
+
+	newTestDriver(t, s, "downDriver", &testDriver{respond: func(w http.ResponseWriter, req DriverExecutionRequest) {
+		w.WriteHeader(http.StatusBadGateway)
+	}})
+
+	sinfo := newTestSession(s)
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.executeDriverAction(sinfo, DriverExecutionRequest{Session: sinfo.UUID.String(), DriverType: "downDriver", Action: "click"})
+		done <- err
+	}()
+	waitForDelivery(t, func() bool {
+		sinfo.Context.mutex.Lock()
+		defer sinfo.Context.mutex.Unlock()
+		for _, msg := range sinfo.Context.Log {
+			if strings.Contains(msg.Message, "Retrying in") {
+				return true
+			}
+		}
+		return false
+	})
+
+	start := time.Now()
+	s.Shutdown(context.Background())
+	select {
+	case err := <-done:
+		if code := errorCodeOf(err); code != ErrorCodeTransport {
+			t.Errorf("Expected the transport error of the last attempt, got %s (%v)", code, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected shutdown to end the retry backoff")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected shutdown not to wait for the backoff, took %s", elapsed)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{Backoff: 10 * time.Millisecond, BackoffMultiplier: 2}
+	if d := policy.backoff(1); d != 10*time.Millisecond {
+		t.Errorf("Expected first backoff of 10ms, got %s", d)
+	}
+	if d := policy.backoff(3); d != 40*time.Millisecond {
+		t.Errorf("Expected third backoff of 40ms, got %s", d)
+	}
+}
+
+func TestExecuteDriverActionRetries(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("retry.drivers.flakyDriver.maxAttempts", 3)
+	s.config.Set("retry.drivers.flakyDriver.retryOn.failures", true)
+
+	var calls atomic.Int32
+	newTestDriver(t, s, "flakyDriver", &testDriver{respond: func(w http.ResponseWriter, req DriverExecutionRequest) {
+		json.NewEncoder(w).Encode(DriverExecutionResult{Success: calls.Add(1) == 2, Message: "done"})
+	}})
+
+	sinfo := newTestSession(s)
+	result, err := s.executeDriverAction(sinfo, DriverExecutionRequest{Session: sinfo.UUID.String(), DriverType: "flakyDriver", Action: "click"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Success {
+		t.Errorf("Expected second attempt to succeed")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 calls to the driver, got %d", calls.Load())
+	}
+
+	attempts, retries := 0, 0
+	for _, msg := range sinfo.Context.Log {
+		if strings.HasPrefix(msg.Message, "Executing action 'click' (attempt") {
+			attempts++
+		}
+		if strings.Contains(msg.Message, "Retrying in") {
+			retries++
+		}
+	}
+	if attempts != 2 || retries != 1 {
+		t.Errorf("Expected 2 logged attempts and 1 retry, got %d and %d", attempts, retries)
+	}
+}
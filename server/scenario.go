@@ -0,0 +1,524 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	verdictPassed  = "passed"
+	verdictFailed  = "failed"
+	verdictAborted = "aborted"
+)
+
+// sessionVerdict returns the verdict of a session that ran a scenario.
+func sessionVerdict(sinfo *SessionInfo) string {
+	switch sinfo.status() {
+	case sessionStatusFailed:
+		return verdictFailed
+	case sessionStatusAborted:
+		return verdictAborted
+	default:
+		return verdictPassed
+	}
+}
+
+// Scenario is a declarative test that is executed by the server:
+//
+//	name: Create order
+//	tags: [smoke]
+//	vars:
+//	  customer: ACME
+//	steps:
+//	  - id: order
+//	    actor: odoo_user
+//	    action: createOrder
+//	    parameters:
+//	      customer: ${vars.customer}
+//	    expect:
+//	      - path: $.data.id
+//	        op: exists
+//	cleanup:
+//	  - driver: selenium
+//	    action: close
+type Scenario struct {
+	Name              string          `json:"name"`
+	Tags              []string        `json:"tags"`
+	Vars              map[string]any  `json:"vars"`
+	Matrix            *ScenarioMatrix `json:"matrix"`
+	ContinueOnFailure bool            `json:"continueOnFailure"`
+	Steps             []ScenarioStep  `json:"steps"`
+	Cleanup           []ScenarioStep  `json:"cleanup"`
+}
+
+// ScenarioMatrix turns a scenario into a data driven suite. Every combination
+// is run in its own session with its parameters added to the variables:
+//
+//	matrix:
+//	  parameters:
+//	    product: [book, pen]
+//	    locale: [de, en]
+//	  include:
+//	    - {product: bike, locale: fr}
+//	  file: products.csv
+//	  parallelism: 4
+//
+// The parameters are combined into their cartesian product. Included and file
+// combinations (CSV with a header row or a JSON list of objects) are added as
+// they are.
+type ScenarioMatrix struct {
+	Parameters  map[string][]any `json:"parameters"`
+	Include     []map[string]any `json:"include"`
+	File        string           `json:"file"`
+	Parallelism int              `json:"parallelism"`
+}
+
+// ScenarioStep is a single actor or driver action of a scenario.
+type ScenarioStep struct {
+	ID         string         `json:"id"`
+	Actor      string         `json:"actor"`
+	Driver     string         `json:"driver"`
+	Action     string         `json:"action"`
+	Parameters map[string]any `json:"parameters"`
+	Expect     []Expectation  `json:"expect"`
+}
+
+// ScenarioResult is the result of a scenario run. For data driven scenarios it
+// holds the suite and the results of all combinations instead of steps.
+type ScenarioResult struct {
+	Name         string              `json:"name"`
+	Session      string              `json:"session,omitempty"`
+	Suite        string              `json:"suite,omitempty"`
+	Parameters   map[string]any      `json:"parameters,omitempty"`
+	Verdict      string              `json:"verdict"`
+	Steps        []BatchActionResult `json:"steps,omitempty"`
+	Cleanup      []BatchActionResult `json:"cleanup,omitempty"`
+	Combinations []ScenarioResult    `json:"combinations,omitempty"`
+}
+
+func (s ScenarioStep) batchAction() BatchAction {
+	action := BatchAction{
+		ID:         s.ID,
+		Action:     s.Action,
+		Parameters: s.Parameters,
+		Expect:     s.Expect,
+	}
+	if s.Actor != "" {
+		action.Kind = "actor"
+		action.Type = s.Actor
+	} else {
+		action.Kind = "driver"
+		action.Type = s.Driver
+	}
+	return action
+}
+
+func (s ScenarioStep) validate() error {
+	if (s.Actor == "") == (s.Driver == "") {
+		return errors.New("exactly one of 'actor' or 'driver' is required")
+	}
+	if s.Action == "" {
+		return errors.New("missing action")
+	}
+	return validateExpectations(s.Expect)
+}
+
+func (s *Scenario) validate() error {
+	if s.Name == "" {
+		return errors.New("scenario is missing a name")
+	}
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("scenario '%s' has no steps", s.Name)
+	}
+
+	for i, step := range s.Steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d: %s", i+1, err.Error())
+		}
+	}
+	for i, step := range s.Cleanup {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("cleanup step %d: %s", i+1, err.Error())
+		}
+	}
+
+	if s.Matrix != nil {
+		if err := s.Matrix.validate(); err != nil {
+			return fmt.Errorf("matrix: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func (m *ScenarioMatrix) validate() error {
+	if len(m.Parameters) == 0 && len(m.Include) == 0 && m.File == "" {
+		return errors.New("no parameters, include or file given")
+	}
+	for name, values := range m.Parameters {
+		if len(values) == 0 {
+			return fmt.Errorf("parameter '%s' has no values", name)
+		}
+	}
+	if m.Parallelism < 0 {
+		return errors.New("parallelism must not be negative")
+	}
+	return nil
+}
+
+// combinations returns the cartesian product of the parameters followed by the
+// included combinations.
+func (m *ScenarioMatrix) combinations() []map[string]any {
+	var combinations []map[string]any
+	if len(m.Parameters) > 0 {
+		names := make([]string, 0, len(m.Parameters))
+		for name := range m.Parameters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		combinations = []map[string]any{{}}
+		for _, name := range names {
+			var next []map[string]any
+			for _, c := range combinations {
+				for _, value := range m.Parameters[name] {
+					combination := make(map[string]any, len(c)+1)
+					for k, v := range c {
+						combination[k] = v
+					}
+					combination[name] = value
+					next = append(next, combination)
+				}
+			}
+			combinations = next
+		}
+	}
+	return append(combinations, m.Include...)
+}
+
+// loadFile adds the combinations of the matrix file to the included ones. The
+// file name is mapped to a path by resolve.
+func (m *ScenarioMatrix) loadFile(resolve func(string) (string, error)) error {
+	if m.File == "" {
+		return nil
+	}
+
+	path, err := resolve(m.File)
+	if err != nil {
+		return err
+	}
+
+	rows, err := loadMatrixFile(path)
+	if err != nil {
+		return fmt.Errorf("matrix file '%s': %s", m.File, err.Error())
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("matrix file '%s' has no combinations", m.File)
+	}
+
+	m.Include = append(m.Include, rows...)
+	m.File = ""
+	return nil
+}
+
+// loadMatrixFile reads combinations from a CSV file with a header row or from
+// a JSON file holding a list of objects.
+func loadMatrixFile(path string) ([]map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var rows []map[string]any
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, err
+		}
+		return rows, nil
+	case ".csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+
+		rows := make([]map[string]any, 0, len(records)-1)
+		for _, record := range records[1:] {
+			row := make(map[string]any, len(record))
+			for i, value := range record {
+				row[strings.TrimSpace(records[0][i])] = value
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unsupported file type, expected .csv or .json")
+}
+
+// decodeYAML decodes a YAML document into v using the JSON field names of v.
+// Unknown fields are rejected so that typos do not go unnoticed.
+func decodeYAML(data []byte, v any) error {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func parseScenario(data []byte) (*Scenario, error) {
+	var sc Scenario
+	if err := decodeYAML(data, &sc); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %s", err.Error())
+	}
+
+	if err := sc.validate(); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+func loadScenarioFile(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseScenario(data)
+}
+
+// scenarioParallelism is the number of matrix combinations that are run at the
+// same time if the scenario does not define it.
+func (s *Server) scenarioParallelism() int {
+	if s.config.IsSet("scenarios.parallelism") {
+		if n := s.config.GetInt("scenarios.parallelism"); n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+func (s *Server) scenarioDirectory() string {
+	if s.config.IsSet("scenarios.directory") {
+		return s.config.GetString("scenarios.directory")
+	}
+	return "scenarios"
+}
+
+// resolveScenarioPath resolves a file name relative to the scenario directory
+// and rejects paths that point outside of it.
+func (s *Server) resolveScenarioPath(name string) (string, error) {
+	clean := filepath.Clean(name)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("scenario file '%s' is outside of the scenario directory", name)
+	}
+	return filepath.Join(s.scenarioDirectory(), clean), nil
+}
+
+// loadScenarioFromDirectory loads a scenario file relative to the scenario
+// directory. Matrix files are resolved relative to the scenario file.
+func (s *Server) loadScenarioFromDirectory(file string) (*Scenario, error) {
+	path, err := s.resolveScenarioPath(file)
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := loadScenarioFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if sc.Matrix != nil {
+		err = sc.Matrix.loadFile(func(name string) (string, error) {
+			return s.resolveScenarioPath(filepath.Join(filepath.Dir(file), name))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// runScenario executes the scenario in a new session. Cleanup steps are always
+// executed. The session is ended afterwards so that it gets reported. Data
+// driven scenarios are run as a suite.
+func (s *Server) runScenario(sc *Scenario) *ScenarioResult {
+	if sc.Matrix != nil {
+		return s.runScenarioSuite(sc)
+	}
+	return s.executeScenario(sc, s.newSession(sc.Name, sc.Tags), sc.Vars)
+}
+
+// runScenarioSuite runs every combination of the matrix in its own session. At
+// most parallelism combinations are run at the same time.
+func (s *Server) runScenarioSuite(sc *Scenario) *ScenarioResult {
+	combinations := sc.Matrix.combinations()
+	suite := s.newSuite(sc.Name, combinations)
+
+	parallelism := sc.Matrix.Parallelism
+	if parallelism == 0 {
+		parallelism = s.scenarioParallelism()
+	}
+
+	results := make([]ScenarioResult, len(combinations))
+	sessions := make([]*SessionInfo, len(combinations))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, params := range combinations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			vars := make(map[string]any, len(sc.Vars)+len(params))
+			for k, v := range sc.Vars {
+				vars[k] = v
+			}
+			for k, v := range params {
+				vars[k] = v
+			}
+
+			sinfo := s.newSession(fmt.Sprintf("%s [%s]", sc.Name, describeParameters(params)), sc.Tags)
+			sinfo.Suite = suite.ID.String()
+			sinfo.Parameters = params
+			suite.startCombination(i, sinfo.UUID)
+			sessions[i] = sinfo
+
+			result := s.executeScenario(sc, sinfo, vars)
+			result.Suite = suite.ID.String()
+			result.Parameters = params
+			suite.completeCombination(i, result.Verdict)
+			results[i] = *result
+		}()
+	}
+	wg.Wait()
+
+	verdict := suite.finish()
+	s.sendSuiteReport(suite, sessions)
+	s.logger.With("suite", suite.ID.String(), "scenario", sc.Name, "combinations", len(combinations), "verdict", verdict).Info("Suite finished.")
+	return &ScenarioResult{
+		Name:         sc.Name,
+		Suite:        suite.ID.String(),
+		Verdict:      verdict,
+		Combinations: results,
+	}
+}
+
+// describeParameters formats the parameters of a combination sorted by name.
+func describeParameters(params map[string]any) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%s", name, valueString(params[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *Server) executeScenario(sc *Scenario, sinfo *SessionInfo, vars map[string]any) *ScenarioResult {
+	if len(vars) > 0 {
+		sinfo.Context.setVariables(vars)
+	}
+
+	result := &ScenarioResult{
+		Name:    sinfo.Name,
+		Session: sinfo.UUID.String(),
+	}
+
+	sinfo.Context.appendLog("system::scenario", fmt.Sprintf("Running scenario '%s' with %d steps.", sinfo.Name, len(sc.Steps)))
+	result.Steps = s.runScenarioSteps(sinfo, sc.Steps, !sc.ContinueOnFailure)
+
+	if len(sc.Cleanup) > 0 {
+		sinfo.Context.appendLog("system::scenario", fmt.Sprintf("Running %d cleanup steps.", len(sc.Cleanup)))
+		result.Cleanup = s.runScenarioSteps(sinfo, sc.Cleanup, false)
+	}
+
+	result.Verdict = sessionVerdict(sinfo)
+
+	sinfo.Context.appendLog("system::scenario", fmt.Sprintf("Scenario '%s' finished: %s.", sinfo.Name, result.Verdict))
+	s.logger.With("scenario", sinfo.Name, "session", result.Session, "verdict", result.Verdict).Info("Scenario finished.")
+	s.sessions.removeSession(sinfo.UUID)
+	return result
+}
+
+func (s *Server) runScenarioSteps(sinfo *SessionInfo, steps []ScenarioStep, stopOnFailure bool) []BatchActionResult {
+	results := make([]BatchActionResult, 0, len(steps))
+	failed := false
+	for _, step := range steps {
+		action := step.batchAction()
+		if failed && stopOnFailure {
+			results = append(results, skippedBatchAction(action))
+			continue
+		}
+
+		r := s.runBatchAction(sinfo, action)
+		if r.Status != batchStatusSuccess {
+			failed = true
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// handleScenarioRun runs a scenario that is either posted as YAML body or
+// referenced by the file query parameter relative to the scenario directory.
+func (s *Server) handleScenarioRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+	if !s.acceptingSessions(w) {
+		return
+	}
+
+	var sc *Scenario
+	var err error
+	if file := r.URL.Query().Get("file"); file != "" {
+		sc, err = s.loadScenarioFromDirectory(file)
+	} else {
+		var body []byte
+		body, err = io.ReadAll(r.Body)
+		if err == nil {
+			sc, err = parseScenario(body)
+		}
+		if err == nil && sc.Matrix != nil {
+			err = sc.Matrix.loadFile(s.resolveScenarioPath)
+		}
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.logger.With("scenario", sc.Name, "steps", len(sc.Steps)).Info("Scenario run request received.")
+	result := s.runScenario(sc)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testScenario = `
+name: Order flow
+tags: [smoke]
+vars:
+  customer: ACME
+steps:
+  - id: order
+    driver: scenarioDriver
+    action: create
+    parameters:
+      customer: ${vars.customer}
+    expect:
+      - path: $.data.customer
+        value: ACME
+  - driver: scenarioDriver
+    action: fail
+  - driver: scenarioDriver
+    action: open
+cleanup:
+  - driver: scenarioDriver
+    action: close
+`
+
+func TestParseScenarioErrors(t *testing.T) {
+	invalid := map[string]string{
+		"missing name":   "steps:\n  - driver: d\n    action: a\n",
+		"no steps":       "name: x\n",
+		"unknown field":  "name: x\nstep:\n  - driver: d\n    action: a\n",
+		"actor & driver": "name: x\nsteps:\n  - driver: d\n    actor: a\n    action: a\n",
+		"missing action": "name: x\nsteps:\n  - driver: d\n",
+		"bad expect":     "name: x\nsteps:\n  - driver: d\n    action: a\n    expect:\n      - path: $.x\n        op: like\n",
+	}
+
+	for name, data := range invalid {
+		if _, err := parseScenario([]byte(data)); err == nil {
+			t.Errorf("Expected parse error for %s", name)
+		}
+	}
+
+	sc, err := parseScenario([]byte(testScenario))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sc.Name != "Order flow" || len(sc.Steps) != 3 || len(sc.Cleanup) != 1 {
+		t.Errorf("Unexpected scenario %+v", sc)
+	}
+}
+
+func TestRunScenario(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	sc, err := parseScenario([]byte(testScenario))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result := s.runScenario(sc)
+	if result.Verdict != verdictFailed {
+		t.Errorf("Expected failed verdict, got %s", result.Verdict)
+	}
+
+	expected := []string{batchStatusSuccess, batchStatusFailed, batchStatusSkipped}
+	for i, status := range expected {
+		if result.Steps[i].Status != status {
+			t.Errorf("Expected step %d to have status %s, got %s", i, status, result.Steps[i].Status)
+		}
+	}
+	if len(result.Cleanup) != 1 || result.Cleanup[0].Status != batchStatusSuccess {
+		t.Errorf("Expected cleanup step to run, got %+v", result.Cleanup)
+	}
+
+	id := uuid.MustParse(result.Session)
+	if s.sessions.getSession(id) != nil {
+		t.Errorf("Expected scenario session to be ended")
+	}
+	finished := s.sessions.getFinishedSession(id)
+	if finished == nil {
+		t.Fatalf("Expected scenario session to be kept in history")
+	}
+	if finished.Name != "Order flow" || len(finished.Tags) != 1 {
+		t.Errorf("Expected scenario metadata on session, got name=%q tags=%v", finished.Name, finished.Tags)
+	}
+}
+
+func TestHandleScenarioRun(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	body := "name: Simple\nsteps:\n  - driver: scenarioDriver\n    action: open\n"
+	w := httptest.NewRecorder()
+	s.handleScenarioRun(w, httptest.NewRequest(http.MethodPost, "/scenarios/run", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result ScenarioResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if result.Verdict != verdictPassed {
+		t.Errorf("Expected passed verdict, got %s", result.Verdict)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleScenarioRun(w, httptest.NewRequest(http.MethodPost, "/scenarios/run?file=../secret.yaml", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for file outside scenario directory, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleScenarioRunFromDirectory(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "simple.yaml"), []byte("name: From file\nsteps:\n  - driver: scenarioDriver\n    action: open\n"), 0o644)
+
+	s.config.Set("scenarios.directory", dir)
+
+	w := httptest.NewRecorder()
+	s.handleScenarioRun(w, httptest.NewRequest(http.MethodPost, "/scenarios/run?file=simple.yaml", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestScenarioCommand(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(s.handleScenarioRun))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "cli.yaml")
+	os.WriteFile(file, []byte("name: CLI\nsteps:\n  - driver: scenarioDriver\n    action: open\n"), 0o644)
+
+	result, err := postScenario(ts.URL, file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	printScenarioResult(&out, result)
+	if !strings.HasPrefix(out.String(), "PASSED CLI") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	if code := scenarioCommand([]string{"run", "--server", ts.URL, file}); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+	if code := scenarioCommand([]string{"list"}); code != 2 {
+		t.Errorf("Expected usage exit code 2, got %d", code)
+	}
+}
+
+func TestScenarioMatrixCombinations(t *testing.T) {
+	m := &ScenarioMatrix{
+		Parameters: map[string][]any{"product": {"book", "pen"}, "locale": {"de", "en"}},
+		Include:    []map[string]any{{"product": "bike", "locale": "fr"}},
+	}
+
+	combinations := m.combinations()
+	if len(combinations) != 5 {
+		t.Fatalf("Expected 5 combinations, got %d: %v", len(combinations), combinations)
+	}
+	if describeParameters(combinations[1]) != "locale=de, product=pen" {
+		t.Errorf("Unexpected combination order %v", combinations)
+	}
+	if combinations[4]["product"] != "bike" {
+		t.Errorf("Expected included combination last, got %v", combinations[4])
+	}
+
+	invalid := map[string]string{
+		"empty matrix":   "name: x\nmatrix: {}\nsteps:\n  - driver: d\n    action: a\n",
+		"empty values":   "name: x\nmatrix:\n  parameters:\n    a: []\nsteps:\n  - driver: d\n    action: a\n",
+		"bad parallel":   "name: x\nmatrix:\n  include: [{a: 1}]\n  parallelism: -1\nsteps:\n  - driver: d\n    action: a\n",
+		"unknown option": "name: x\nmatrix:\n  values: {a: [1]}\nsteps:\n  - driver: d\n    action: a\n",
+	}
+	for name, data := range invalid {
+		if _, err := parseScenario([]byte(data)); err == nil {
+			t.Errorf("Expected parse error for %s", name)
+		}
+	}
+}
+
+func TestLoadMatrixFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "m.csv"), []byte("product, locale\nbook,de\npen,en\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "m.json"), []byte(`[{"product": "book", "amount": 2}]`), 0o644)
+	os.WriteFile(filepath.Join(dir, "m.txt"), []byte("product\nbook\n"), 0o644)
+
+	rows, err := loadMatrixFile(filepath.Join(dir, "m.csv"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[1]["locale"] != "en" {
+		t.Errorf("Unexpected CSV rows %v", rows)
+	}
+
+	rows, err = loadMatrixFile(filepath.Join(dir, "m.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["amount"] != float64(2) {
+		t.Errorf("Unexpected JSON rows %v", rows)
+	}
+
+	if _, err := loadMatrixFile(filepath.Join(dir, "m.txt")); err == nil {
+		t.Errorf("Expected error for unsupported file type")
+	}
+}
+
+func TestRunScenarioSuite(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	sc, err := parseScenario([]byte(`
+name: Matrix
+vars:
+  customer: ACME
+matrix:
+  parameters:
+    product: [book, pen, fail]
+  parallelism: 2
+steps:
+  - driver: scenarioDriver
+    action: order
+    parameters:
+      customer: ${vars.customer}
+      product: ${vars.product}
+    expect:
+      - path: $.data.product
+        op: notEquals
+        value: fail
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result := s.runScenario(sc)
+	if result.Verdict != verdictFailed || len(result.Combinations) != 3 {
+		t.Fatalf("Unexpected suite result %+v", result)
+	}
+	if result.Combinations[0].Verdict != verdictPassed || result.Combinations[2].Verdict != verdictFailed {
+		t.Errorf("Unexpected combination verdicts %+v", result.Combinations)
+	}
+
+	finished := s.sessions.getFinishedSession(uuid.MustParse(result.Combinations[1].Session))
+	if finished == nil || finished.Suite != result.Suite || finished.Parameters["product"] != "pen" {
+		t.Fatalf("Expected combination session to reference the suite, got %+v", finished)
+	}
+	if finished.Name != "Matrix [product=pen]" {
+		t.Errorf("Unexpected session name %q", finished.Name)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/suites/"+result.Suite, nil)
+	r.SetPathValue("id", result.Suite)
+	w := httptest.NewRecorder()
+	s.handleSuiteDetails(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var suite SuiteInfo
+	if err := json.NewDecoder(w.Body).Decode(&suite); err != nil {
+		t.Fatalf("Failed to decode suite: %v", err)
+	}
+	if suite.Status != verdictFailed || suite.FinishedAt == nil || len(suite.Combinations) != 3 || suite.Combinations[0].Session == "" {
+		t.Errorf("Unexpected suite %+v", &suite)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/suites/"+uuid.NewString(), nil)
+	r.SetPathValue("id", uuid.NewString())
+	w = httptest.NewRecorder()
+	s.handleSuiteDetails(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown suite, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestScenarioCommandInlinesMatrixFile(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "scenarioDriver", nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(s.handleScenarioRun))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "products.csv"), []byte("product\nbook\npen\n"), 0o644)
+	file := filepath.Join(dir, "matrix.yaml")
+	os.WriteFile(file, []byte("name: CLI matrix\nmatrix:\n  file: products.csv\nsteps:\n  - driver: scenarioDriver\n    action: order\n    parameters:\n      product: ${vars.product}\n"), 0o644)
+
+	result, err := postScenario(ts.URL, file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Verdict != verdictPassed || len(result.Combinations) != 2 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	var out bytes.Buffer
+	printScenarioResult(&out, result)
+	if !strings.Contains(out.String(), "\n  PASSED CLI matrix [product=pen]") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
@@ -0,0 +1,416 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	scheduleSourceConfig = "config"
+	scheduleSourceAPI    = "api"
+
+	scheduledRunRunning = "running"
+	scheduledRunSkipped = "skipped"
+	scheduledRunError   = "error"
+
+	upcomingScheduledRuns = 5
+)
+
+// ScheduleDefinition describes a scenario or feature file that is run on a cron
+// schedule:
+//
+//	schedules:
+//	  nightly-smoke:
+//	    cron: "0 2 * * *"
+//	    scenario: smoke.yaml
+//	    timezone: Europe/Berlin
+//
+// Files are resolved relative to the scenario directory. Scenarios with a
+// matrix are run as a suite.
+type ScheduleDefinition struct {
+	Name     string `json:"name"`
+	Cron     string `json:"cron"`
+	Scenario string `json:"scenario,omitempty"`
+	Feature  string `json:"feature,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+}
+
+// ScheduledRun is a single run of a schedule. Runs that would overlap a run
+// that is still in progress are recorded as skipped.
+type ScheduledRun struct {
+	ScheduledAt time.Time  `json:"scheduledAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	Status      string     `json:"status"`
+	Message     string     `json:"message,omitempty"`
+	Sessions    []string   `json:"sessions,omitempty"`
+	Suite       string     `json:"suite,omitempty"`
+}
+
+type ScheduleInfo struct {
+	ScheduleDefinition
+	Source   string          `json:"source"`
+	Running  bool            `json:"running"`
+	Upcoming []time.Time     `json:"upcoming"`
+	History  []*ScheduledRun `json:"history"`
+}
+
+type schedule struct {
+	server     *Server
+	definition ScheduleDefinition
+	source     string
+	cron       *cronSchedule
+	location   *time.Location
+
+	mutex   sync.Mutex
+	running bool
+	history []*ScheduledRun
+	stop    chan struct{}
+}
+
+type scheduleRegister struct {
+	server    *Server
+	mutex     sync.Mutex
+	schedules map[string]*schedule
+}
+
+func (d ScheduleDefinition) enabled() bool {
+	return d.Enabled == nil || *d.Enabled
+}
+
+func (s *Server) newSchedule(def ScheduleDefinition, source string) (*schedule, error) {
+	if def.Name == "" {
+		return nil, errors.New("schedule is missing a name")
+	}
+	if (def.Scenario == "") == (def.Feature == "") {
+		return nil, fmt.Errorf("schedule '%s': exactly one of 'scenario' or 'feature' is required", def.Name)
+	}
+
+	file := def.Scenario + def.Feature
+	if _, err := s.resolveScenarioPath(file); err != nil {
+		return nil, fmt.Errorf("schedule '%s': %s", def.Name, err.Error())
+	}
+
+	cron, err := parseCron(def.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("schedule '%s': %s", def.Name, err.Error())
+	}
+
+	location := time.Local
+	if def.Timezone != "" {
+		if location, err = time.LoadLocation(def.Timezone); err != nil {
+			return nil, fmt.Errorf("schedule '%s': invalid timezone: %s", def.Name, err.Error())
+		}
+	}
+
+	return &schedule{
+		server:     s,
+		definition: def,
+		source:     source,
+		cron:       cron,
+		location:   location,
+		stop:       make(chan struct{}),
+	}, nil
+}
+
+// add registers the schedule and starts it if it is enabled.
+func (r *scheduleRegister) add(sched *schedule) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	name := sched.definition.Name
+	if _, ok := r.schedules[name]; ok {
+		return fmt.Errorf("schedule '%s' already exists", name)
+	}
+	r.schedules[name] = sched
+
+	if sched.definition.enabled() {
+		go sched.loop()
+	}
+	r.server.logger.With("schedule", name, "cron", sched.definition.Cron, "source", sched.source, "enabled", sched.definition.enabled()).Info("Schedule registered.")
+	return nil
+}
+
+// remove stops and removes the schedule. A run in progress is not aborted.
+func (r *scheduleRegister) remove(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	sched, ok := r.schedules[name]
+	if !ok {
+		return false
+	}
+	close(sched.stop)
+	delete(r.schedules, name)
+	r.server.logger.With("schedule", name).Info("Schedule removed.")
+	return true
+}
+
+// stopAll stops all schedules when the server is shut down. Runs in progress
+// are not aborted.
+func (r *scheduleRegister) stopAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for name, sched := range r.schedules {
+		close(sched.stop)
+		delete(r.schedules, name)
+	}
+}
+
+func (r *scheduleRegister) get(name string) *schedule {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.schedules[name]
+}
+
+func (r *scheduleRegister) list() []*schedule {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	list := make([]*schedule, 0, len(r.schedules))
+	for _, sched := range r.schedules {
+		list = append(list, sched)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].definition.Name < list[j].definition.Name })
+	return list
+}
+
+// setupPreconfiguredSchedules registers all schedules of the configuration.
+func (s *Server) setupPreconfiguredSchedules() {
+	for name := range s.config.GetStringMap("schedules") {
+		def := ScheduleDefinition{
+			Name:     name,
+			Cron:     s.config.GetString(fmt.Sprintf("schedules.%s.cron", name)),
+			Scenario: s.config.GetString(fmt.Sprintf("schedules.%s.scenario", name)),
+			Feature:  s.config.GetString(fmt.Sprintf("schedules.%s.feature", name)),
+			Timezone: s.config.GetString(fmt.Sprintf("schedules.%s.timezone", name)),
+		}
+		if key := fmt.Sprintf("schedules.%s.enabled", name); s.config.IsSet(key) {
+			enabled := s.config.GetBool(key)
+			def.Enabled = &enabled
+		}
+
+		sched, err := s.newSchedule(def, scheduleSourceConfig)
+		if err == nil {
+			err = s.schedules.add(sched)
+		}
+		if err != nil {
+			s.logger.With("schedule", name, "error", err).Error("Invalid preconfigured schedule.")
+		}
+	}
+}
+
+func (s *schedule) loop() {
+	for {
+		next := s.cron.next(time.Now().In(s.location))
+		if next.IsZero() {
+			s.server.logger.With("schedule", s.definition.Name).Warn("Schedule has no upcoming runs.")
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			go s.trigger(next)
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// trigger runs the schedule unless the previous run is still in progress.
+func (s *schedule) trigger(scheduledAt time.Time) {
+	run := &ScheduledRun{ScheduledAt: scheduledAt}
+
+	s.mutex.Lock()
+	if s.running {
+		run.Status = scheduledRunSkipped
+		run.Message = "previous run still in progress"
+		s.record(run)
+		s.mutex.Unlock()
+		s.server.logger.With("schedule", s.definition.Name).Warn("Skipped scheduled run. Previous run still in progress.")
+		return
+	}
+
+	s.running = true
+	started := time.Now()
+	run.StartedAt = &started
+	run.Status = scheduledRunRunning
+	s.record(run)
+	s.mutex.Unlock()
+
+	s.server.logger.With("schedule", s.definition.Name).Info("Starting scheduled run.")
+	result := s.execute()
+
+	s.mutex.Lock()
+	finished := time.Now()
+	result.ScheduledAt = run.ScheduledAt
+	result.StartedAt = run.StartedAt
+	result.FinishedAt = &finished
+	*run = result
+	s.running = false
+	s.mutex.Unlock()
+
+	s.server.logger.With("schedule", s.definition.Name, "status", result.Status).Info("Scheduled run finished.")
+}
+
+// record adds the run to the history. The caller must hold the schedule mutex.
+func (s *schedule) record(run *ScheduledRun) {
+	limit := defaultSessionHistorySize
+	if s.server.config.IsSet("scheduler.history") {
+		limit = s.server.config.GetInt("scheduler.history")
+	}
+
+	s.history = append(s.history, run)
+	if len(s.history) > limit {
+		s.history = s.history[len(s.history)-limit:]
+	}
+}
+
+func (s *schedule) execute() ScheduledRun {
+	if s.definition.Feature != "" {
+		f, err := s.server.loadFeatureFromDirectory(s.definition.Feature)
+		if err != nil {
+			return ScheduledRun{Status: scheduledRunError, Message: err.Error()}
+		}
+		bindings, err := s.server.loadStepBindings()
+		if err != nil {
+			return ScheduledRun{Status: scheduledRunError, Message: err.Error()}
+		}
+
+		result := s.server.runFeature(f, bindings)
+		run := ScheduledRun{Status: result.Verdict}
+		for _, sc := range result.Scenarios {
+			run.Sessions = append(run.Sessions, sc.Session)
+		}
+		return run
+	}
+
+	sc, err := s.server.loadScenarioFromDirectory(s.definition.Scenario)
+	if err != nil {
+		return ScheduledRun{Status: scheduledRunError, Message: err.Error()}
+	}
+
+	result := s.server.runScenario(sc)
+	run := ScheduledRun{Status: result.Verdict, Suite: result.Suite}
+	if result.Session != "" {
+		run.Sessions = []string{result.Session}
+	}
+	for _, c := range result.Combinations {
+		run.Sessions = append(run.Sessions, c.Session)
+	}
+	return run
+}
+
+func (s *schedule) info() ScheduleInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	info := ScheduleInfo{
+		ScheduleDefinition: s.definition,
+		Source:             s.source,
+		Running:            s.running,
+		Upcoming:           []time.Time{},
+		History:            make([]*ScheduledRun, len(s.history)),
+	}
+	for i, run := range s.history {
+		r := *run
+		info.History[i] = &r
+	}
+
+	if s.definition.enabled() {
+		t := time.Now().In(s.location)
+		for i := 0; i < upcomingScheduledRuns; i++ {
+			if t = s.cron.next(t); t.IsZero() {
+				break
+			}
+			info.Upcoming = append(info.Upcoming, t)
+		}
+	}
+	return info
+}
+
+func (s *Server) scheduleManagementEnabled(w http.ResponseWriter) bool {
+	if !s.config.GetBool("security.schedules.selfManagement") {
+		http.Error(w, "schedule management disabled", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handleSchedules lists all schedules or creates a new one.
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list := s.schedules.list()
+		infos := make([]ScheduleInfo, len(list))
+		for i, sched := range list {
+			infos[i] = sched.info()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+	case http.MethodPost:
+		if !s.scheduleManagementEnabled(w) {
+			return
+		}
+
+		var def ScheduleDefinition
+		if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sched, err := s.newSchedule(def, scheduleSourceAPI)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.schedules.add(sched); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sched.info())
+	default:
+		http.Error(w, "invalid method", http.StatusBadRequest)
+	}
+}
+
+// handleScheduleDetails returns or removes a single schedule.
+func (s *Server) handleScheduleDetails(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	switch r.Method {
+	case http.MethodGet:
+		sched := s.schedules.get(name)
+		if sched == nil {
+			http.Error(w, "schedule not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sched.info())
+	case http.MethodDelete:
+		if !s.scheduleManagementEnabled(w) {
+			return
+		}
+		if !s.schedules.remove(name) {
+			http.Error(w, "schedule not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "invalid method", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newScheduleTestDirectory creates a scenario directory with a scenario that
+// calls the scenario test driver.
+func newScheduleTestDirectory(t *testing.T, s *Server, action string) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "smoke.yaml"), []byte("name: Smoke\nsteps:\n  - driver: scenarioDriver\n    action: "+action+"\n"), 0o644)
+
+	s.config.Set("scenarios.directory", dir)
+}
+
+func TestNewScheduleErrors(t *testing.T) {
+	s := newTestServer(t)
+	invalid := map[string]ScheduleDefinition{
+		"missing name":     {Cron: "* * * * *", Scenario: "a.yaml"},
+		"missing target":   {Name: "x", Cron: "* * * * *"},
+		"both targets":     {Name: "x", Cron: "* * * * *", Scenario: "a.yaml", Feature: "a.feature"},
+		"invalid cron":     {Name: "x", Cron: "every day", Scenario: "a.yaml"},
+		"invalid timezone": {Name: "x", Cron: "* * * * *", Scenario: "a.yaml", Timezone: "Mars/Olympus"},
+		"outside dir":      {Name: "x", Cron: "* * * * *", Scenario: "../a.yaml"},
+	}
+
+	for name, def := range invalid {
+		if _, err := s.newSchedule(def, scheduleSourceAPI); err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+}
+
+func TestScheduleTrigger(t *testing.T) {
+	s := newTestServer(t)
+	newTestDriver(t, s, "scenarioDriver", nil)
+	newScheduleTestDirectory(t, s, "open")
+
+	sched, err := s.newSchedule(ScheduleDefinition{Name: "smoke", Cron: "@daily", Scenario: "smoke.yaml"}, scheduleSourceAPI)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sched.trigger(time.Now())
+
+	// simulate a run that is still in progress
+	sched.running = true
+	sched.trigger(time.Now())
+	sched.running = false
+
+	info := sched.info()
+	if len(info.History) != 2 {
+		t.Fatalf("Expected 2 runs in history, got %+v", info.History)
+	}
+	if run := info.History[0]; run.Status != verdictPassed || len(run.Sessions) != 1 || run.FinishedAt == nil {
+		t.Errorf("Unexpected first run %+v", run)
+	}
+	if run := info.History[1]; run.Status != scheduledRunSkipped {
+		t.Errorf("Expected overlapping run to be skipped, got %+v", run)
+	}
+	if len(info.Upcoming) != upcomingScheduledRuns || !info.Upcoming[0].Before(info.Upcoming[1]) {
+		t.Errorf("Unexpected upcoming runs %v", info.Upcoming)
+	}
+}
+
+func TestScheduleTriggerError(t *testing.T) {
+	s := newTestServer(t)
+	newScheduleTestDirectory(t, s, "open")
+	s.config.Set("scheduler.history", 1)
+
+	sched, err := s.newSchedule(ScheduleDefinition{Name: "missing", Cron: "@daily", Scenario: "missing.yaml"}, scheduleSourceAPI)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sched.trigger(time.Now())
+	sched.trigger(time.Now())
+
+	info := sched.info()
+	if len(info.History) != 1 || info.History[0].Status != scheduledRunError {
+		t.Errorf("Expected a single error run in history, got %+v", info.History)
+	}
+}
+
+func TestHandleSchedules(t *testing.T) {
+	s := newTestServer(t)
+	newScheduleTestDirectory(t, s, "open")
+
+	body := `{"name": "api-smoke", "cron": "0 2 * * *", "scenario": "smoke.yaml", "enabled": false}`
+	w := httptest.NewRecorder()
+	s.handleSchedules(w, httptest.NewRequest(http.MethodPost, "/schedules", strings.NewReader(body)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without self-management, got %d", http.StatusForbidden, w.Code)
+	}
+
+	s.config.Set("security.schedules.selfManagement", true)
+	w = httptest.NewRecorder()
+	s.handleSchedules(w, httptest.NewRequest(http.MethodPost, "/schedules", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	defer s.schedules.remove("api-smoke")
+
+	w = httptest.NewRecorder()
+	s.handleSchedules(w, httptest.NewRequest(http.MethodPost, "/schedules", strings.NewReader(body)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for duplicate schedule, got %d", http.StatusConflict, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleSchedules(w, httptest.NewRequest(http.MethodGet, "/schedules", nil))
+	var infos []ScheduleInfo
+	if err := json.NewDecoder(w.Body).Decode(&infos); err != nil {
+		t.Fatalf("Failed to decode schedules: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Name != "api-smoke" || infos[0].Source != scheduleSourceAPI || len(infos[0].Upcoming) != 0 {
+		t.Errorf("Unexpected schedules %+v", infos)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/schedules/api-smoke", nil)
+	r.SetPathValue("name", "api-smoke")
+	w = httptest.NewRecorder()
+	s.handleScheduleDetails(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/schedules/api-smoke", nil)
+	r.SetPathValue("name", "api-smoke")
+	w = httptest.NewRecorder()
+	s.handleScheduleDetails(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for removed schedule, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestSetupPreconfiguredSchedules(t *testing.T) {
+	s := newTestServer(t)
+	newScheduleTestDirectory(t, s, "open")
+	s.config.Set("schedules.nightly.cron", "0 2 * * *")
+	s.config.Set("schedules.nightly.scenario", "smoke.yaml")
+	s.config.Set("schedules.nightly.enabled", false)
+	s.config.Set("schedules.broken.cron", "never")
+	s.config.Set("schedules.broken.scenario", "smoke.yaml")
+
+	s.setupPreconfiguredSchedules()
+	defer s.schedules.remove("nightly")
+
+	sched := s.schedules.get("nightly")
+	if sched == nil || sched.source != scheduleSourceConfig || sched.definition.enabled() {
+		t.Fatalf("Expected disabled schedule from config, got %+v", sched)
+	}
+	if s.schedules.get("broken") != nil {
+		t.Errorf("Expected invalid schedule to be ignored")
+	}
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const defaultLogLevel = "debug"
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// Server is a Babylon server. Its sessions, extensions, reporters and
+// schedules belong to the server, so several servers can run in one process,
+// e.g. embedded in a Go test harness:
+//
+//	srv, err := server.New(server.WithSetting("security.actor.selfManagement", "true"))
+//	if err != nil {
+//		return err
+//	}
+//	ts := httptest.NewServer(srv.Handler())
+//	defer ts.Close()
+//
+// Handler only serves requests. Start additionally listens on the configured
+// port, registers the preconfigured extensions and schedules, and runs the
+// background jobs like the session cleanup until Shutdown is called.
+type Server struct {
+	config  *serverConfig
+	options configOptions
+	logger  *zap.SugaredLogger
+	// logLevel is the level of the server logger. It follows the log.level
+	// setting and can be changed while the server is running.
+	logLevel zap.AtomicLevel
+
+	configState       configState
+	configReloadMutex sync.Mutex
+
+	sessions         sessionRegister
+	actors           map[string]ActorInfo
+	actorsMutex      sync.Mutex
+	drivers          DriverRegister
+	reporters        ReporterRegister
+	breakers         circuitBreakerRegister
+	suites           suiteRegister
+	schedules        scheduleRegister
+	deliveries       deliveryRegister
+	deliverySequence atomic.Uint64
+	reporterWorkers  reporterWorkerRegister
+	metrics          serverMetrics
+
+	mux        *http.ServeMux
+	listener   net.Listener
+	httpServer *http.Server
+
+	// stopping is set once Shutdown was called. No new sessions and actions
+	// are accepted from then on.
+	stopping      bool
+	shutdownMutex sync.Mutex
+	// draining is closed once Shutdown was called. Retries of actions end.
+	draining      chan struct{}
+	activeActions sync.WaitGroup
+	// reports are the session and suite reports that are being written.
+	reports sync.WaitGroup
+	// stop is closed by Shutdown and ends all background jobs.
+	stop     chan struct{}
+	stopOnce sync.Once
+	// done is closed once the server stopped serving, serveErr is the
+	// reason.
+	done     chan struct{}
+	serveErr error
+}
+
+// Option configures a server created with New.
+type Option func(*Server)
+
+// WithConfigFile reads the configuration from the file, the files it
+// includes and the selected profile. Without a config file only defaults
+// and settings apply. The file is watched for changes once the server was
+// started.
+func WithConfigFile(file string) Option {
+	return func(s *Server) {
+		s.options.File = file
+	}
+}
+
+// WithProfile applies the profile of the config file.
+func WithProfile(profile string) Option {
+	return func(s *Server) {
+		s.options.Profile = profile
+	}
+}
+
+// WithSetting sets the config key to the value. Settings take precedence
+// over the config file and environment variables and are kept when the
+// config file is reloaded.
+func WithSetting(key, value string) Option {
+	return func(s *Server) {
+		s.options.Settings[key] = value
+	}
+}
+
+// WithEnvironment applies the BABYLON_* environment variables on top of the
+// config file.
+func WithEnvironment() Option {
+	return func(s *Server) {
+		s.options.Env = true
+	}
+}
+
+// WithLogger logs to the logger instead of a development logger on stderr.
+// The log.level setting only applies to the default logger.
+func WithLogger(logger *zap.SugaredLogger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithListener serves on the listener instead of listening on the configured
+// port. Extensions are told the port of the listener, which allows to
+// listen on a random port with ":0".
+func WithListener(l net.Listener) Option {
+	return func(s *Server) {
+		s.listener = l
+	}
+}
+
+// withConfigOptions applies the options parsed from the command line.
+func withConfigOptions(opts configOptions) Option {
+	return func(s *Server) {
+		s.options.File, s.options.Profile, s.options.Env = opts.File, opts.Profile, opts.Env
+		for key, value := range opts.Overrides {
+			s.options.Overrides[key] = value
+		}
+	}
+}
+
+// New creates a server and loads its configuration. An invalid
+// configuration is returned as error.
+func New(opts ...Option) (*Server, error) {
+	s := &Server{
+		config:   newServerConfig(),
+		options:  configOptions{Overrides: map[string]string{}, Settings: map[string]string{}},
+		logLevel: zap.NewAtomicLevelAt(zap.DebugLevel),
+		actors:   make(map[string]ActorInfo),
+		metrics:  newServerMetrics(),
+		mux:      http.NewServeMux(),
+		draining: make(chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	s.configState.overrides = map[string]string{}
+	s.sessions = sessionRegister{server: s, activeSessions: make(map[uuid.UUID]*SessionInfo)}
+	s.drivers = DriverRegister{server: s, drivers: make(map[string]Driver)}
+	s.reporters = ReporterRegister{server: s, reporters: make(map[string]ReporterInfo)}
+	s.breakers = circuitBreakerRegister{server: s, breakers: make(map[string]*circuitBreaker)}
+	s.suites = suiteRegister{server: s, suites: make(map[uuid.UUID]*SuiteInfo)}
+	s.schedules = scheduleRegister{server: s, schedules: make(map[string]*schedule)}
+	s.deliveries = deliveryRegister{server: s, queues: make(map[string]*reporterQueue)}
+	s.reporterWorkers = reporterWorkerRegister{server: s, workers: make(map[string]*reporterWorker)}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.logger == nil {
+		zapConfig := zap.NewDevelopmentConfig()
+		zapConfig.Level = s.logLevel
+		l, err := zapConfig.Build()
+		if err != nil {
+			return nil, err
+		}
+		s.logger = l.Sugar()
+	}
+
+	if err := s.loadConfig(s.options); err != nil {
+		s.logger.With("file", s.options.File).Error("Invalid configuration. Refusing to start.")
+		return nil, err
+	}
+
+	s.registerHandlers()
+	return s, nil
+}
+
+func (s *Server) registerHandlers() {
+	// Actor functions
+	s.mux.HandleFunc("/actor/execute", s.runActor)
+	s.mux.HandleFunc("/actor/", s.requireSelfManagement("actor", s.registerActor))
+
+	// driver functions
+	s.mux.HandleFunc("/driver/execute", s.executeDriver)
+	s.mux.HandleFunc("/driver/", s.requireSelfManagement("driver", s.registerDriver))
+
+	// reporter functions
+	s.mux.HandleFunc("/reporter/", s.requireSelfManagement("reporter", s.registerReporter))
+	s.mux.HandleFunc("/reporter/{name}/deadletters", s.handleReporterDeadLetters)
+	s.mux.HandleFunc("/reporter/{name}/deadletters/redeliver", s.handleReporterRedeliver)
+	s.mux.HandleFunc("/reporter/{name}/deadletters/{id}/redeliver", s.handleReporterRedeliver)
+
+	// scenario execution
+	s.mux.HandleFunc("/scenarios/run", s.handleScenarioRun)
+	s.mux.HandleFunc("/features/run", s.handleFeatureRun)
+	s.mux.HandleFunc("/suites/{id}", s.handleSuiteDetails)
+
+	// scheduled execution
+	s.mux.HandleFunc("/schedules", s.handleSchedules)
+	s.mux.HandleFunc("/schedules/{name}", s.handleScheduleDetails)
+
+	// registry of all known extensions
+	s.mux.HandleFunc("/registry", s.handleRegistry)
+
+	// monitoring
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.Handle("/ui/", dashboardHandler())
+
+	// session management
+	s.mux.HandleFunc("/session", s.handleSession)
+	s.mux.HandleFunc("/sessions", s.handleSessions)
+	s.mux.HandleFunc("/session/{id}", s.handleSessionDetails)
+	s.mux.HandleFunc("/session/{id}/batch", s.handleSessionBatch)
+	s.mux.HandleFunc("/session/{id}/log", s.handleSessionLog)
+	s.mux.HandleFunc("/session/{id}/report.html", s.handleSessionReportHTML)
+}
+
+// Handler returns the HTTP handler of all endpoints of the server.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start listens on the configured port and serves requests in the
+// background. The preconfigured extensions, reporters and schedules are
+// set up and the config file is watched for changes.
+func (s *Server) Start() error {
+	if s.listener == nil {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.GetInt("port")))
+		if err != nil {
+			return err
+		}
+		s.listener = l
+	}
+
+	s.watchConfig()
+	go s.sessions.sessionCleanup()
+
+	if !s.config.GetBool("security.actor.selfManagement") {
+		s.logger.Info("Actor self-management disabled.")
+	}
+	if !s.config.GetBool("security.driver.selfManagement") {
+		s.logger.Info("Driver self-management disabled.")
+	}
+
+	for actor := range s.config.GetStringMap("actors") {
+		go s.setupPreconfiguredActor(actor)
+	}
+	for driver := range s.config.GetStringMap("drivers") {
+		go s.setupPreconfiguredDriver(driver)
+	}
+
+	s.resumeDeliveries()
+
+	for reporter := range s.config.GetStringMap("reporter") {
+		go s.setupPreconfiguredReporter(reporter)
+	}
+
+	if s.config.IsSet("schedules") {
+		s.setupPreconfiguredSchedules()
+	}
+
+	s.httpServer = &http.Server{Handler: s.mux}
+	s.logger.With("address", s.listener.Addr().String()).Info("Server listening")
+	go func() {
+		err := s.httpServer.Serve(s.listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.serveErr = err
+		}
+		close(s.done)
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on, nil before it was
+// started.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Wait blocks until the started server stopped serving. It returns nil
+// after Shutdown.
+func (s *Server) Wait() error {
+	<-s.done
+	return s.serveErr
+}
+
+// Shutdown stops the server gracefully. New sessions and actions are
+// rejected and the actions in progress are completed. Then all active
+// sessions are ended with the aborted status, their reports are delivered and
+// the server stops serving. The shutdown.timeout setting limits how long
+// Shutdown waits, the context may shorten it.
+func (s *Server) Shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.shutdownTimeout())
+	defer cancel()
+
+	var err error
+	s.stopOnce.Do(func() {
+		err = s.drain(ctx)
+		close(s.stop)
+		if s.httpServer != nil {
+			if shutdownErr := s.httpServer.Shutdown(ctx); err == nil {
+				err = shutdownErr
+			}
+		}
+		s.logger.Info("Server stopped.")
+	})
+	return err
+}
+
+// callbackURL is the URL extensions reach the server at.
+func (s *Server) callbackURL() string {
+	port := s.config.GetInt("port")
+	if addr, ok := s.Addr().(*net.TCPAddr); ok {
+		port = addr.Port
+	}
+	return fmt.Sprintf("http://%s:%d/", s.config.GetString("hostname"), port)
+}
+
+// applyLogLevel sets the level of the server logger to the log.level setting.
+func (s *Server) applyLogLevel() {
+	level, err := zap.ParseAtomicLevel(s.config.GetString("log.level"))
+	if err != nil {
+		s.logger.With("level", s.config.GetString("log.level"), "error", err).Warn("Invalid log level. Keeping the current level.")
+		return
+	}
+	s.logLevel.SetLevel(level.Level())
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// newTestServer creates a server without a config file that logs nowhere.
+func newTestServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	s, err := New(append([]Option{WithLogger(zap.NewNop().Sugar())}, opts...)...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return s
+}
+
+// testDriver is a stub driver extension. Unless respond is set it succeeds
+// every action except "fail" and answers with the action as message and the
+// parameters as data. With hold set, all requests wait until it is closed.
+type testDriver struct {
+	respond func(w http.ResponseWriter, req DriverExecutionRequest)
+	hold    chan struct{}
+	// started receives the actions that reached the driver.
+	started chan DriverExecutionRequest
+	// calls counts the actions, ended the sessions the driver was told to end.
+	calls atomic.Int32
+	ended atomic.Int32
+}
+
+// newTestDriver registers the stub driver under the name. d may be nil for
+// the default behaviour.
+func newTestDriver(t *testing.T, s *Server, name string, d *testDriver) *testDriver {
+	t.Helper()
+	if d == nil {
+		d = &testDriver{}
+	}
+	d.started = make(chan DriverExecutionRequest, 16)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req DriverExecutionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.Method != http.MethodDelete {
+			d.calls.Add(1)
+			select {
+			case d.started <- req:
+			default:
+			}
+		}
+		if d.hold != nil {
+			<-d.hold
+		}
+
+		switch {
+		case r.Method == http.MethodDelete:
+			d.ended.Add(1)
+		case d.respond != nil:
+			d.respond(w, req)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ExecutionResult{Success: req.Action != "fail", Message: req.Action, Data: req.Parameters})
+		}
+	}))
+	t.Cleanup(ts.Close)
+	s.drivers.AddDriver(Driver{Name: name, Type: name, Callback: ts.URL + "/"})
+	return d
+}
+
+// newTestSession registers a running session without informing extensions
+// or reporters.
+func newTestSession(s *Server) *SessionInfo {
+	sinfo := &SessionInfo{UUID: uuid.New(), Status: sessionStatusRunning, lastKeepalive: time.Now(), createdAt: time.Now(), server: s}
+	sinfo.Context = SessionContext{sessionInfo: sinfo, Log: []SessionLogMessage{}}
+	s.sessions.addSession(sinfo)
+	return sinfo
+}
+
+func TestWithSetting(t *testing.T) {
+	s := newTestServer(t, WithSetting("Session.Timeout", "1m"))
+
+	if got := s.sessionTimeout(); got != time.Minute {
+		t.Errorf("Expected session timeout of 1m, got %s", got)
+	}
+	if got := s.configSource("session.timeout"); got != settingSource {
+		t.Errorf("Expected source %s, got %s", settingSource, got)
+	}
+}
+
+func TestNewInvalidSetting(t *testing.T) {
+	if _, err := New(WithLogger(zap.NewNop().Sugar()), WithSetting("port", "abc")); err == nil {
+		t.Errorf("Expected an invalid setting to be rejected")
+	}
+}
+
+func TestServersAreIndependent(t *testing.T) {
+	start := func(selfManagement string) *Server {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		s := newTestServer(t, WithListener(l), WithSetting("security.actor.selfManagement", selfManagement))
+		if err := s.Start(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return s
+	}
+	first, second := start("true"), start("false")
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/session", first.Addr()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var sinfo SessionInfo
+	json.NewDecoder(resp.Body).Decode(&sinfo)
+	resp.Body.Close()
+
+	if first.sessions.getSession(sinfo.UUID) == nil {
+		t.Errorf("Expected the session to be registered at the first server")
+	}
+	if second.sessions.getSession(sinfo.UUID) != nil {
+		t.Errorf("Expected the session not to be known to the second server")
+	}
+	if !first.config.GetBool("security.actor.selfManagement") || second.config.GetBool("security.actor.selfManagement") {
+		t.Errorf("Expected each server to keep its own settings")
+	}
+	if want := fmt.Sprintf("http://%s:%d/", first.config.GetString("hostname"), first.Addr().(*net.TCPAddr).Port); first.callbackURL() != want {
+		t.Errorf("Expected callback URL %s, got %s", want, first.callbackURL())
+	}
+
+	if err := first.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := first.Wait(); err != nil {
+		t.Errorf("Expected Wait to return nil after Shutdown, got %v", err)
+	}
+	if resp, err := http.Get(fmt.Sprintf("http://%s/sessions", second.Addr())); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the second server to keep serving, got %v", err)
+	} else {
+		resp.Body.Close()
+	}
+}
@@ -1,6 +1,7 @@
-package main
+package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,9 +11,16 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	defaultSessionHistorySize = 100
+	defaultSessionTimeout     = 5 * time.Minute
+)
+
 type sessionRegister struct {
-	sessionMutex   sync.Mutex
-	activeSessions map[uuid.UUID]*SessionInfo
+	server           *Server
+	sessionMutex     sync.Mutex
+	activeSessions   map[uuid.UUID]*SessionInfo
+	finishedSessions []*SessionInfo
 }
 
 func (r *sessionRegister) addSession(sinfo *SessionInfo) {
@@ -22,20 +30,52 @@ func (r *sessionRegister) addSession(sinfo *SessionInfo) {
 	r.activeSessions[sinfo.UUID] = sinfo
 }
 
+// sessionCleanup removes inactive sessions until the server is shut down.
 func (r *sessionRegister) sessionCleanup() {
-	ticker := time.Tick(5 * time.Second)
-	for now := range ticker {
-		logger.Debug("Running session cleanup")
-		r.sessionMutex.Lock()
-		for _, sinfo := range r.activeSessions {
-			if sinfo.lastKeepalive.Before(now.Add(-5 * time.Minute)) {
-				logger.With("uuid", sinfo.UUID.String()).Info("Cleaned inactive session.")
-				sinfo.Context.appendLog("system::warning", "Session timed out. Missing closing of session or session got stuck?")
-				delete(r.activeSessions, sinfo.UUID)
-			}
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-r.server.stop:
+			return
+		case now = <-ticker.C:
 		}
-		r.sessionMutex.Unlock()
+
+		r.cleanupSessions(now)
+	}
+}
+
+// cleanupSessions aborts the sessions that were inactive for longer than the
+// session timeout. They are reported and archived like closed sessions.
+func (r *sessionRegister) cleanupSessions(now time.Time) {
+	r.server.logger.Debug("Running session cleanup")
+	deadline := now.Add(-r.server.sessionTimeout())
+	var expired []*SessionInfo
+	r.sessionMutex.Lock()
+	for _, sinfo := range r.activeSessions {
+		if sinfo.inactiveSince(deadline) {
+			expired = append(expired, sinfo)
+		}
+	}
+	r.sessionMutex.Unlock()
+
+	for _, sinfo := range expired {
+		sinfo.Context.appendLog("system::warning", "Session timed out. Missing closing of session or session got stuck?")
+		if r.abortSession(context.Background(), sinfo, "session timed out") {
+			r.server.logger.With("uuid", sinfo.UUID.String()).Info("Cleaned inactive session.")
+			r.server.metrics.sessionsTimedOut.inc()
+		}
+	}
+}
+
+// sessionTimeout returns how long a session may be inactive before it is
+// cleaned up.
+func (s *Server) sessionTimeout() time.Duration {
+	if s.config.IsSet("session.timeout") {
+		return s.config.GetDuration("session.timeout")
 	}
+	return defaultSessionTimeout
 }
 
 func (r *sessionRegister) getSession(id uuid.UUID) *SessionInfo {
@@ -45,92 +85,380 @@ func (r *sessionRegister) getSession(id uuid.UUID) *SessionInfo {
 }
 
 func (r *sessionRegister) removeSession(id uuid.UUID) {
+	r.endSession(context.Background(), id)
+}
+
+// endSession finishes, archives and reports the session and informs all
+// extensions that it ended. The extensions are informed without holding the
+// session mutex and only until the context expires.
+func (r *sessionRegister) endSession(ctx context.Context, id uuid.UUID) {
+	r.sessionMutex.Lock()
+	sinfo := r.activeSessions[id]
+	if sinfo != nil {
+		sinfo.finish()
+		r.archiveSession(sinfo)
+		delete(r.activeSessions, id)
+	}
+	r.sessionMutex.Unlock()
+
+	r.server.sendSessionReport(sinfo)
+	r.server.drivers.informEndOfSessioNnid(ctx, id)
+	r.server.informActorsEndOfSession(ctx, id)
+}
+
+// abortSessions ends all active sessions with the aborted status. They are
+// reported like sessions that were closed by their client. The extensions
+// are only informed until the context expires, the sessions are aborted
+// nonetheless.
+func (r *sessionRegister) abortSessions(ctx context.Context, reason string) int {
+	r.sessionMutex.Lock()
+	active := make([]*SessionInfo, 0, len(r.activeSessions))
+	for _, sinfo := range r.activeSessions {
+		active = append(active, sinfo)
+	}
+	r.sessionMutex.Unlock()
+
+	if ctx.Err() != nil && len(active) > 0 {
+		r.server.logger.With("sessions", len(active)).Warn("Not informing extensions of aborted sessions. Shutdown timeout exceeded.")
+	}
+	for _, sinfo := range active {
+		if r.abortSession(ctx, sinfo, reason) {
+			r.server.logger.With("uuid", sinfo.UUID.String()).Info("Session aborted.")
+		}
+	}
+	return len(active)
+}
+
+// abortSession ends the session with the aborted status like a session that
+// was closed by its client. It returns false if the session was closed in
+// the meantime.
+func (r *sessionRegister) abortSession(ctx context.Context, sinfo *SessionInfo, reason string) bool {
+	if r.getSession(sinfo.UUID) == nil {
+		return false
+	}
+	sinfo.abort()
+	sinfo.Context.appendLog("system::warning", fmt.Sprintf("Session aborted: %s.", reason))
+	r.endSession(ctx, sinfo.UUID)
+	return true
+}
+
+// archiveSession keeps a finished session so that it can still be inspected.
+// Only the most recent sessions are kept. The caller must hold the session mutex.
+func (r *sessionRegister) archiveSession(sinfo *SessionInfo) {
+	limit := defaultSessionHistorySize
+	if r.server.config.IsSet("session.history") {
+		limit = r.server.config.GetInt("session.history")
+	}
+
+	r.finishedSessions = append(r.finishedSessions, sinfo)
+	if len(r.finishedSessions) > limit {
+		r.finishedSessions = r.finishedSessions[len(r.finishedSessions)-limit:]
+	}
+}
+
+func (r *sessionRegister) getFinishedSession(id uuid.UUID) *SessionInfo {
 	r.sessionMutex.Lock()
 	defer r.sessionMutex.Unlock()
-	sendSessionReport(r.activeSessions[id])
-	drivers.informEndOfSessioNnid(id)
-	informActorsEndOfSession(id)
-	delete(r.activeSessions, id)
+	for i := len(r.finishedSessions) - 1; i >= 0; i-- {
+		if r.finishedSessions[i].UUID == id {
+			return r.finishedSessions[i]
+		}
+	}
+	return nil
 }
 
-var session_register sessionRegister
+const (
+	sessionStatusRunning = "running"
+	sessionStatusPassed  = "passed"
+	sessionStatusFailed  = "failed"
+	sessionStatusAborted = "aborted"
+)
 
 type SessionInfo struct {
 	UUID          uuid.UUID      `json:"uuid"`
+	Name          string         `json:"name,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Suite         string         `json:"suite,omitempty"`
+	Parameters    map[string]any `json:"parameters,omitempty"`
+	Status        string         `json:"status"`
+	statusMutex   sync.Mutex     `json:"-"`
 	lastKeepalive time.Time      `json:"-"`
-	Context       SessionContext `json:"context"`
+	// runningActions counts the actions in progress. Sessions with running
+	// actions do not time out.
+	runningActions int            `json:"-"`
+	createdAt      time.Time      `json:"-"`
+	server         *Server        `json:"-"`
+	Context        SessionContext `json:"context"`
+}
+
+// markFailed sets the session status to failed. A failed session stays failed,
+// an aborted one stays aborted.
+func (s *SessionInfo) markFailed() {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	if s.Status != sessionStatusAborted {
+		s.Status = sessionStatusFailed
+	}
+}
+
+// abort sets the status of a session that could not finish.
+func (s *SessionInfo) abort() {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	s.Status = sessionStatusAborted
+}
+
+// finish sets the final status of a session that did not fail.
+func (s *SessionInfo) finish() {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	if s.Status == sessionStatusRunning || s.Status == "" {
+		s.Status = sessionStatusPassed
+	}
+}
+
+// beginActivity marks an action of the session as running. Every action keeps
+// the session alive.
+func (s *SessionInfo) beginActivity() {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	s.runningActions++
+	s.lastKeepalive = time.Now()
+}
+
+func (s *SessionInfo) endActivity() {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	s.runningActions--
+	s.lastKeepalive = time.Now()
+}
+
+// inactiveSince reports whether the session had no activity since the
+// deadline and no action is running.
+func (s *SessionInfo) inactiveSince(deadline time.Time) bool {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	return s.runningActions == 0 && s.lastKeepalive.Before(deadline)
+}
+
+func (s *SessionInfo) status() string {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	return s.Status
+}
+
+// snapshot returns a copy of the session that can be encoded or rendered
+// while actions are still writing to its context.
+func (s *SessionInfo) snapshot() *SessionInfo {
+	snap := &SessionInfo{
+		UUID:       s.UUID,
+		Name:       s.Name,
+		Tags:       s.Tags,
+		Suite:      s.Suite,
+		Parameters: s.Parameters,
+		Status:     s.status(),
+		createdAt:  s.createdAt,
+		server:     s.server,
+	}
+
+	s.Context.mutex.Lock()
+	defer s.Context.mutex.Unlock()
+	snap.Context = SessionContext{
+		sessionInfo: snap,
+		Log:         append([]SessionLogMessage{}, s.Context.Log...),
+	}
+	if s.Context.Steps != nil {
+		snap.Context.Steps = make(map[string]*ExecutionResult, len(s.Context.Steps))
+		for k, v := range s.Context.Steps {
+			snap.Context.Steps[k] = v
+		}
+	}
+	return snap
 }
 
 type SessionContext struct {
-	sessionInfo *SessionInfo        `json:"-"`
-	mutex       sync.Mutex          `json:"-"`
-	Log         []SessionLogMessage `json:"log"`
+	sessionInfo *SessionInfo                `json:"-"`
+	mutex       sync.Mutex                  `json:"-"`
+	liveMutex   sync.Mutex                  `json:"-"`
+	Log         []SessionLogMessage         `json:"log"`
+	Steps       map[string]*ExecutionResult `json:"steps,omitempty"`
+	variables   map[string]any              `json:"-"`
+	executions  int                         `json:"-"`
+	// gherkinStep is the line of the Gherkin step that is running and
+	// executionSteps the line of the step each execution belongs to.
+	gherkinStep    int         `json:"-"`
+	executionSteps map[int]int `json:"-"`
 }
 
-func (c *SessionContext) appendLog(msgtype string, msg string) {
+// nextExecution numbers the next action that is executed for the session.
+func (c *SessionContext) nextExecution() int {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.executions++
+	if c.gherkinStep != 0 {
+		if c.executionSteps == nil {
+			c.executionSteps = make(map[int]int)
+		}
+		c.executionSteps[c.executions] = c.gherkinStep
+	}
+	return c.executions
+}
+
+// setGherkinStep links the following log messages and executions to the
+// Gherkin step in the line. Line 0 ends the step.
+func (c *SessionContext) setGherkinStep(line int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.gherkinStep = line
+}
+
+// setStepResult stores the result of an action that was executed with a step
+// id so that later actions can reference it.
+func (c *SessionContext) setStepResult(id string, result *ExecutionResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.Steps == nil {
+		c.Steps = make(map[string]*ExecutionResult)
+	}
+	c.Steps[id] = result
+}
+
+func (c *SessionContext) setVariables(vars map[string]any) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.variables == nil {
+		c.variables = make(map[string]any)
+	}
+	for k, v := range vars {
+		c.variables[k] = v
+	}
+}
+
+// snapshotReferences returns copies of the step results and variables.
+func (c *SessionContext) snapshotReferences() (map[string]*ExecutionResult, map[string]any) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	steps := make(map[string]*ExecutionResult, len(c.Steps))
+	for k, v := range c.Steps {
+		steps[k] = v
+	}
+	vars := make(map[string]any, len(c.variables))
+	for k, v := range c.variables {
+		vars[k] = v
+	}
+	return steps, vars
+}
+
+func (c *SessionContext) appendLog(msgtype string, msg string) {
+	c.appendLogData(msgtype, msg, nil)
+}
+
+// appendLogData adds a log message that carries structured data in addition
+// to the message text.
+func (c *SessionContext) appendLogData(msgtype string, msg string, data any) {
+	c.appendExecutionLog(0, msgtype, msg, data)
+}
+
+// appendExecutionLog adds a log message that belongs to the numbered action
+// execution.
+func (c *SessionContext) appendExecutionLog(execution int, msgtype string, msg string, data any) {
 	msgObj := SessionLogMessage{
 		TimeStamp:   time.Now(),
 		MessageType: msgtype,
 		Message:     msg,
+		Data:        data,
+		Execution:   execution,
+	}
+
+	c.mutex.Lock()
+	if execution == 0 {
+		msgObj.Step = c.gherkinStep
+	} else {
+		msgObj.Step = c.executionSteps[execution]
 	}
 	c.Log = append(c.Log, msgObj)
-	go sendLiveLogMessage(c.sessionInfo, msgObj)
+	// The live mutex is taken before the context is unlocked so that the live
+	// reporters receive the messages in log order without holding up readers
+	// of the context.
+	c.liveMutex.Lock()
+	c.mutex.Unlock()
+	defer c.liveMutex.Unlock()
+
+	c.sessionInfo.server.sendLiveLogMessage(c.sessionInfo, msgObj)
 }
 
+// SessionLogMessage is an entry of the session log. Execution numbers the
+// action the message belongs to, it is 0 for messages outside of actions.
+// Step is the line of the Gherkin step the message belongs to in feature
+// sessions.
 type SessionLogMessage struct {
 	TimeStamp   time.Time `json:"timestamp"`
 	MessageType string    `json:"type"`
 	Message     string    `json:"message"`
+	Data        any       `json:"data,omitempty"`
+	Execution   int       `json:"execution,omitempty"`
+	Step        int       `json:"step,omitempty"`
 }
 
-func init() {
-	session_register.activeSessions = make(map[uuid.UUID]*SessionInfo)
-	go session_register.sessionCleanup()
-}
-
-func handleSession(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if !s.acceptingSessions(w) {
+		return
+	}
 	if r.Method == http.MethodGet {
-		createSession(w, r)
+		s.createSession(w, r)
 	} else {
 		http.Error(w, "invalid method", http.StatusBadRequest)
 		return
 	}
 }
 
-func createSession(w http.ResponseWriter, r *http.Request) {
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "invalid method", http.StatusBadRequest)
 		return
 	}
 
-	id := uuid.New()
-	sinfo := SessionInfo{
-		UUID:          id,
+	query := r.URL.Query()
+	sinfo := s.newSession(query.Get("name"), query["tag"])
+
+	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sinfo.snapshot())
+}
+
+// newSession creates and registers a new session.
+func (s *Server) newSession(name string, tags []string) *SessionInfo {
+	sinfo := &SessionInfo{
+		UUID:          uuid.New(),
+		Name:          name,
+		Tags:          tags,
+		Status:        sessionStatusRunning,
 		lastKeepalive: time.Now(),
+		createdAt:     time.Now(),
+		server:        s,
 	}
 
 	sinfo.Context = SessionContext{
-		sessionInfo: &sinfo,
+		sessionInfo: sinfo,
 		Log:         make([]SessionLogMessage, 0),
 	}
 
-	session_register.addSession(&sinfo)
-
-	w.WriteHeader(http.StatusCreated)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(&sinfo)
+	s.sessions.addSession(sinfo)
+	s.metrics.sessionsCreated.inc()
 
-	logger.With("uuid", sinfo.UUID.String()).Info("New session created.")
+	s.logger.With("uuid", sinfo.UUID.String(), "name", name).Info("New session created.")
+	return sinfo
 }
 
-func handleSessionDetails(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleSessionDetails(w http.ResponseWriter, r *http.Request) {
 
 	sid := r.PathValue("id")
 	if len(sid) == 0 {
 		if r.Method == http.MethodGet {
-			createSession(w, r)
+			if s.acceptingSessions(w) {
+				s.createSession(w, r)
+			}
 			return
 		}
 		http.Error(w, "missing session id", http.StatusBadRequest)
@@ -143,43 +471,53 @@ func handleSessionDetails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sinfo := session_register.getSession(uuid)
+	sinfo := s.sessions.getSession(uuid)
 	if sinfo == nil {
+		if finished := s.sessions.getFinishedSession(uuid); finished != nil && r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(finished.snapshot())
+			return
+		}
 		http.Error(w, "invalid session", http.StatusNotFound)
 		return
 	}
 
 	switch r.Method {
 	case http.MethodDelete:
-		session_register.removeSession(sinfo.UUID)
-		logger.With("uuid", sinfo.UUID.String()).Info("Session deleted.")
+		s.sessions.removeSession(sinfo.UUID)
+		s.logger.With("uuid", sinfo.UUID.String()).Info("Session deleted.")
 	case http.MethodPost:
-		appendToSession(w, r, sinfo)
+		s.appendToSession(w, r, sinfo)
 	case http.MethodGet:
 		w.WriteHeader(http.StatusCreated)
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(sinfo)
+		json.NewEncoder(w).Encode(sinfo.snapshot())
 	default:
 		http.Error(w, "invalid method", http.StatusBadRequest)
 	}
 }
 
 type sessionContextRequest struct {
-	Type       string `json:"type"`
-	LogMessage string `json:"logMessage"`
+	Type       string         `json:"type"`
+	LogMessage string         `json:"logMessage"`
+	Variables  map[string]any `json:"variables"`
 }
 
-func appendToSession(w http.ResponseWriter, r *http.Request, sinfo *SessionInfo) {
+func (s *Server) appendToSession(w http.ResponseWriter, r *http.Request, sinfo *SessionInfo) {
 	var req sessionContextRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	logger.With("type", req.Type, "session", sinfo.UUID).Info("Received session context.")
+	s.logger.With("type", req.Type, "session", sinfo.UUID).Info("Received session context.")
 	switch req.Type {
 	case "logMessage":
 		sinfo.Context.appendLog("message", req.LogMessage)
+	case "variables":
+		sinfo.Context.setVariables(req.Variables)
+		_, vars := sinfo.Context.snapshotReferences()
+		sinfo.Context.appendLogData("system::variables", fmt.Sprintf("%d session variables set.", len(req.Variables)), s.redactParameters(req.Variables, s.secretValues(vars)))
 	default:
 		http.Error(w, "invalid context type", http.StatusBadRequest)
 	}
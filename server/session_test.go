@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"bytes"
@@ -12,14 +12,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"go.uber.org/zap"
 )
 
-// Initialize a no-op logger to avoid nil pointer panics.
-func init() {
-	logger = zap.NewNop().Sugar()
-}
-
 // Define a context key type.
 type ctxKey string
 
@@ -51,9 +45,10 @@ func getSessionIDFromRequest(r *http.Request) string {
 // --- Tests for session functions ---
 
 func TestCreateSession(t *testing.T) {
+	s := newTestServer(t)
 	req := httptest.NewRequest(http.MethodGet, "/session", nil)
 	w := httptest.NewRecorder()
-	createSession(w, req)
+	s.createSession(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusCreated {
 		t.Fatalf("Expected status 201 Created, got %d", resp.StatusCode)
@@ -66,17 +61,18 @@ func TestCreateSession(t *testing.T) {
 		t.Errorf("Expected non-nil UUID")
 	}
 	// Check that the session is stored.
-	stored := session_register.getSession(sinfo.UUID)
+	stored := s.sessions.getSession(sinfo.UUID)
 	if stored == nil {
 		t.Errorf("Session not stored in session_register")
 	}
 }
 
 func TestHandleSession_WithoutID(t *testing.T) {
+	s := newTestServer(t)
 	// Calling handleSession with GET should create a session.
 	req := httptest.NewRequest(http.MethodGet, "/session", nil)
 	w := httptest.NewRecorder()
-	handleSession(w, req)
+	s.handleSession(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusCreated {
 		t.Fatalf("Expected status 201 Created, got %d", resp.StatusCode)
@@ -84,10 +80,11 @@ func TestHandleSession_WithoutID(t *testing.T) {
 }
 
 func TestHandleSessionDetails_WithEmptyID(t *testing.T) {
+	s := newTestServer(t)
 	// When no session id is provided, GET should call createSession.
 	req := httptest.NewRequest(http.MethodGet, "/session", nil)
 	w := httptest.NewRecorder()
-	handleSessionDetails(w, req)
+	s.handleSessionDetails(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusCreated {
 		t.Fatalf("Expected status 201 Created when no session id provided, got %d", resp.StatusCode)
@@ -95,20 +92,22 @@ func TestHandleSessionDetails_WithEmptyID(t *testing.T) {
 }
 
 func TestHandleSessionDetails_GetExisting(t *testing.T) {
+	s := newTestServer(t)
 	// Create a session manually.
 	id := uuid.New()
 	sinfo := &SessionInfo{
 		UUID:          id,
 		lastKeepalive: time.Now(),
-		Context:       SessionContext{Log: []SessionLogMessage{}},
+		server:        s,
 	}
-	session_register.addSession(sinfo)
+	sinfo.Context = SessionContext{sessionInfo: sinfo, Log: []SessionLogMessage{}}
+	s.sessions.addSession(sinfo)
 	// Simulate a GET request for this session.
 	url := fmt.Sprintf("/session/%s", id.String())
 	req := newRequestWithSessionID(http.MethodGet, url, id.String(), nil)
 	w := httptest.NewRecorder()
 	req.SetPathValue("id", id.String())
-	handleSessionDetails(w, req)
+	s.handleSessionDetails(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusCreated {
 		t.Fatalf("Expected status 201 Created for GET session details, got %d", resp.StatusCode)
@@ -122,35 +121,63 @@ func TestHandleSessionDetails_GetExisting(t *testing.T) {
 	}
 }
 
+func TestHandleSessionDetails_GetWhileActionsRun(t *testing.T) {
+	s := newTestServer(t)
+	sinfo := s.newSession("Busy", nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			sinfo.Context.setStepResult(fmt.Sprintf("step%d", i), &ExecutionResult{Success: true})
+			sinfo.Context.appendLog("message", "running")
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/session/"+sinfo.UUID.String(), nil)
+		req.SetPathValue("id", sinfo.UUID.String())
+		w := httptest.NewRecorder()
+		s.handleSessionDetails(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201 Created, got %d", w.Code)
+		}
+	}
+	<-done
+}
+
 func TestHandleSessionDetails_Delete(t *testing.T) {
+	s := newTestServer(t)
 	id := uuid.New()
 	sinfo := &SessionInfo{
 		UUID:          id,
 		lastKeepalive: time.Now(),
-		Context:       SessionContext{Log: []SessionLogMessage{}},
+		server:        s,
 	}
-	session_register.addSession(sinfo)
+	sinfo.Context = SessionContext{sessionInfo: sinfo, Log: []SessionLogMessage{}}
+	s.sessions.addSession(sinfo)
 	url := fmt.Sprintf("/session/%s", id.String())
 	req := newRequestWithSessionID(http.MethodDelete, url, id.String(), nil)
 	w := httptest.NewRecorder()
 	req.SetPathValue("id", id.String())
-	handleSessionDetails(w, req)
+	s.handleSessionDetails(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("Expected status 200 OK for DELETE, got %d", resp.StatusCode)
 	}
-	if session_register.getSession(id) != nil {
+	if s.sessions.getSession(id) != nil {
 		t.Errorf("Session was not removed")
 	}
 }
 
 func TestHandleSessionDetails_MalformedID(t *testing.T) {
+	s := newTestServer(t)
 	badID := "bad-id"
 	url := fmt.Sprintf("/session/%s", badID)
 	req := newRequestWithSessionID(http.MethodGet, url, badID, nil)
 	w := httptest.NewRecorder()
 	req.SetPathValue("id", badID)
-	handleSessionDetails(w, req)
+	s.handleSessionDetails(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadRequest {
 		t.Fatalf("Expected status 400 for malformed session id, got %d", resp.StatusCode)
@@ -158,12 +185,13 @@ func TestHandleSessionDetails_MalformedID(t *testing.T) {
 }
 
 func TestHandleSessionDetails_UnknownID(t *testing.T) {
+	s := newTestServer(t)
 	unknownID := uuid.New().String()
 	url := fmt.Sprintf("/session/%s", unknownID)
 	req := newRequestWithSessionID(http.MethodGet, url, unknownID, nil)
 	w := httptest.NewRecorder()
 	req.SetPathValue("id", unknownID)
-	handleSessionDetails(w, req)
+	s.handleSessionDetails(w, req)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusNotFound {
 		t.Fatalf("Expected status 404 for unknown session id, got %d", resp.StatusCode)
@@ -171,14 +199,16 @@ func TestHandleSessionDetails_UnknownID(t *testing.T) {
 }
 
 func TestAppendToSession(t *testing.T) {
+	s := newTestServer(t)
 	// Create a session.
 	id := uuid.New()
 	sinfo := &SessionInfo{
 		UUID:          id,
 		lastKeepalive: time.Now(),
-		Context:       SessionContext{Log: []SessionLogMessage{}},
+		server:        s,
 	}
-	session_register.addSession(sinfo)
+	sinfo.Context = SessionContext{sessionInfo: sinfo, Log: []SessionLogMessage{}}
+	s.sessions.addSession(sinfo)
 	// Create request body for appending a log message.
 	reqBody := sessionContextRequest{
 		Type:       "logMessage",
@@ -188,7 +218,7 @@ func TestAppendToSession(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/session", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
-	appendToSession(w, req, sinfo)
+	s.appendToSession(w, req, sinfo)
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("Expected status 200 for appendToSession, got %d", resp.StatusCode)
@@ -199,3 +229,30 @@ func TestAppendToSession(t *testing.T) {
 		t.Errorf("Expected log message to contain 'Test log entry', got %s", sinfo.Context.Log[0].Message)
 	}
 }
+
+func TestSessionCleanup(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Set("session.timeout", "1m")
+	idle := s.newSession("Idle", nil)
+	busy := s.newSession("Busy", nil)
+	busy.beginActivity()
+
+	s.sessions.cleanupSessions(time.Now().Add(2 * time.Minute))
+
+	if s.sessions.getSession(busy.UUID) == nil {
+		t.Errorf("Expected session with running action to be kept")
+	}
+	if s.sessions.getSession(idle.UUID) != nil {
+		t.Fatalf("Expected inactive session to be removed")
+	}
+	finished := s.sessions.getFinishedSession(idle.UUID)
+	if finished == nil || finished.status() != sessionStatusAborted {
+		t.Errorf("Expected inactive session to be archived as aborted, got %v", finished)
+	}
+
+	busy.endActivity()
+	s.sessions.cleanupSessions(time.Now().Add(2 * time.Minute))
+	if s.sessions.getSession(busy.UUID) != nil {
+		t.Errorf("Expected session to time out after its action ended")
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+var errShuttingDown = newCodedExecutionError(http.StatusServiceUnavailable, ErrorCodeShuttingDown, "server is shutting down")
+
+// shutdownTimeout returns how long a graceful shutdown may take before the
+// remaining actions and deliveries are given up:
+//
+//	shutdown:
+//	  timeout: 30s
+func (s *Server) shutdownTimeout() time.Duration {
+	if s.config.IsSet("shutdown.timeout") {
+		return s.config.GetDuration("shutdown.timeout")
+	}
+	return defaultShutdownTimeout
+}
+
+// beginAction registers an action that is executed for a session. It returns
+// false once the server is shutting down and no more actions are accepted.
+func (s *Server) beginAction() bool {
+	s.shutdownMutex.Lock()
+	defer s.shutdownMutex.Unlock()
+
+	if s.stopping {
+		return false
+	}
+	s.activeActions.Add(1)
+	return true
+}
+
+func (s *Server) endAction() {
+	s.activeActions.Done()
+}
+
+// acceptingSessions reports whether new sessions may be created and rejects
+// the request if the server is shutting down.
+func (s *Server) acceptingSessions(w http.ResponseWriter) bool {
+	s.shutdownMutex.Lock()
+	defer s.shutdownMutex.Unlock()
+
+	if s.stopping {
+		w.Header().Set("X-Babylon-Error-Code", string(ErrorCodeShuttingDown))
+		http.Error(w, errShuttingDown.Message, http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// drain stops accepting new sessions and actions, waits for the actions in
+// progress and ends all active sessions with the aborted status. Their
+// reports are handed to the reporters before it returns. Actions and
+// deliveries that did not finish before the context expired are given up.
+func (s *Server) drain(ctx context.Context) error {
+	s.shutdownMutex.Lock()
+	s.stopping = true
+	close(s.draining)
+	s.shutdownMutex.Unlock()
+	s.schedules.stopAll()
+
+	s.logger.Info("Shutting down. Waiting for actions in progress.")
+	err := waitContext(ctx, &s.activeActions)
+	if err != nil {
+		s.logger.Warn("Shutdown timeout exceeded. Aborting sessions with actions in progress.")
+	}
+
+	if aborted := s.sessions.abortSessions(ctx, "server is shutting down"); aborted > 0 {
+		s.logger.With("sessions", aborted).Info("Aborted active sessions.")
+	}
+
+	if flushErr := s.flushReports(ctx); flushErr != nil {
+		s.logger.With("pending", s.deliveries.pending()).Warn("Shutdown timeout exceeded. Reporter messages were not delivered.")
+		if err == nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// flushReports waits until the session and suite reports were written and
+// the messages of all reporters were delivered.
+func (s *Server) flushReports(ctx context.Context) error {
+	if err := waitContext(ctx, &s.reports); err != nil {
+		return err
+	}
+	if err := s.reporterWorkers.flush(ctx); err != nil {
+		return err
+	}
+	return s.deliveries.flush(ctx)
+}
+
+// waitContext waits for the wait group unless the context expires first.
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
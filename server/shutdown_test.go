@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShutdownAbortsSessions(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	close(release)
+	driver := newTestDriver(t, s, "shutdownDriver", &testDriver{hold: release})
+	reporter := &recordingReporter{}
+	s.reporters.AddReporter(ReporterInfo{Name: "recording", builtin: reporter})
+
+	sinfo := s.newSession("Open", nil)
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if sinfo.status() != sessionStatusAborted || s.sessions.getSession(sinfo.UUID) != nil {
+		t.Errorf("Expected session to be ended as aborted, got %s", sinfo.status())
+	}
+	if s.sessions.getFinishedSession(sinfo.UUID) == nil {
+		t.Errorf("Expected aborted session to be kept in the history")
+	}
+	if got := reporter.reported(); len(got) != 1 || got[0] != sinfo.UUID {
+		t.Errorf("Expected aborted session to be reported, got %v", got)
+	}
+	if driver.ended.Load() != 1 {
+		t.Errorf("Expected driver to be informed of the session end, got %d", driver.ended.Load())
+	}
+	if report := newSessionReport(sinfo); !report.Failed() || !report.Broken() {
+		t.Errorf("Expected aborted session to be reported as broken")
+	}
+
+	w := httptest.NewRecorder()
+	s.handleSession(w, httptest.NewRequest(http.MethodGet, "/session", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected new sessions to be rejected, got %d", w.Code)
+	}
+	if _, err := s.executeDriverAction(s.newSession("Late", nil), DriverExecutionRequest{DriverType: "shutdownDriver", Action: "open"}); errorCodeOf(err) != ErrorCodeShuttingDown {
+		t.Errorf("Expected new actions to be rejected, got %v", err)
+	}
+}
+
+func TestShutdownDrainsActions(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	driver := newTestDriver(t, s, "shutdownDriver", &testDriver{hold: release})
+
+	sinfo := s.newSession("Busy", nil)
+	results := make(chan *ExecutionResult, 1)
+	go func() {
+		result, _ := s.executeDriverAction(sinfo, DriverExecutionRequest{DriverType: "shutdownDriver", Action: "open"})
+		results <- result
+	}()
+	<-driver.started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-shutdown:
+		t.Fatalf("Expected shutdown to wait for the action in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if sinfo.status() != sessionStatusRunning {
+		t.Errorf("Expected session to stay open while its action runs, got %s", sinfo.status())
+	}
+
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result := <-results; result == nil || !result.Success {
+		t.Errorf("Expected action in progress to complete, got %+v", result)
+	}
+	if sinfo.status() != sessionStatusAborted {
+		t.Errorf("Expected session to be aborted after the action, got %s", sinfo.status())
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s := newTestServer(t, WithSetting("shutdown.timeout", "50ms"))
+	release := make(chan struct{})
+	driver := newTestDriver(t, s, "shutdownDriver", &testDriver{hold: release})
+	t.Cleanup(func() { close(release) })
+
+	sinfo := s.newSession("Stuck", nil)
+	go s.executeDriverAction(sinfo, DriverExecutionRequest{DriverType: "shutdownDriver", Action: "open"})
+	<-driver.started
+
+	if err := s.Shutdown(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected shutdown timeout, got %v", err)
+	}
+	if sinfo.status() != sessionStatusAborted {
+		t.Errorf("Expected stuck session to be aborted, got %s", sinfo.status())
+	}
+}
+
+func TestShutdownFlushesLiveBatches(t *testing.T) {
+	s := newTestServer(t, WithSetting("live.batchWindow", "1h"))
+	fake := newLiveTestReporter(t, s, "flushed", true)
+
+	sinfo := s.newSession("Live", nil)
+	sinfo.Context.appendLog("message", "pending in batch")
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var messages []string
+	for _, req := range fake.received() {
+		messages = append(messages, req.messages...)
+	}
+	if len(messages) < 2 || messages[0] != "pending in batch" {
+		t.Errorf("Expected batched messages to be delivered before shutdown, got %v", messages)
+	}
+	if requests := fake.received(); requests[len(requests)-1].path != deliveryKindReport {
+		t.Errorf("Expected the report of the aborted session last, got %+v", requests)
+	}
+}
+
+func TestShutdownTimeoutWithHungExtension(t *testing.T) {
+	s := newTestServer(t, WithSetting("shutdown.timeout", "100ms"))
+	release := make(chan struct{})
+	newTestDriver(t, s, "hungDriver", &testDriver{hold: release})
+	t.Cleanup(func() { close(release) })
+
+	first := s.newSession("First", nil)
+	second := s.newSession("Second", nil)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	// the session mutex is not held while extensions are informed
+	time.Sleep(20 * time.Millisecond)
+	lookup := make(chan struct{})
+	go func() {
+		s.sessions.getSession(first.UUID)
+		close(lookup)
+	}()
+	select {
+	case <-lookup:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected sessions to be accessible while extensions are informed")
+	}
+
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected shutdown to end after its timeout despite the hung driver")
+	}
+	for _, sinfo := range []*SessionInfo{first, second} {
+		if sinfo.status() != sessionStatusAborted {
+			t.Errorf("Expected session to be aborted, got %s", sinfo.status())
+		}
+	}
+}
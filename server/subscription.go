@@ -0,0 +1,159 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ReporterFilter restricts the sessions and live log messages a reporter
+// receives. Every list that is set must match, an empty list matches
+// everything:
+//
+//	reporter:
+//	  SlackNotifier:
+//	    callback: http://localhost:9096
+//	    filter:
+//	      tags: [smoke]
+//	      statuses: [failed]
+//
+// Message types are globs like "system::driver::*" and only apply to live log
+// messages, statuses only apply to session reports. Sessions match the tags if
+// they have at least one of them. Extension types match live messages of
+// actors and drivers of that type and sessions that used one of them.
+type ReporterFilter struct {
+	MessageTypes   []string `json:"messageTypes,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Statuses       []string `json:"statuses,omitempty"`
+	ExtensionTypes []string `json:"extensionTypes,omitempty"`
+}
+
+// reporterFilterFromConfig reads the filter of a preconfigured reporter.
+func (s *Server) reporterFilterFromConfig(name string) (*ReporterFilter, error) {
+	key := fmt.Sprintf("reporter.%s.filter", name)
+	if !s.config.IsSet(key) {
+		return nil, nil
+	}
+
+	filter := &ReporterFilter{
+		MessageTypes:   s.config.GetStringSlice(key + ".messageTypes"),
+		Tags:           s.config.GetStringSlice(key + ".tags"),
+		Statuses:       s.config.GetStringSlice(key + ".statuses"),
+		ExtensionTypes: s.config.GetStringSlice(key + ".extensionTypes"),
+	}
+	return filter, filter.validate()
+}
+
+func (f *ReporterFilter) validate() error {
+	if f == nil {
+		return nil
+	}
+	for _, pattern := range f.MessageTypes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid message type pattern '%s'", pattern)
+		}
+	}
+	return nil
+}
+
+// matchesSession reports whether the finished session is sent to the reporter.
+func (f *ReporterFilter) matchesSession(session *SessionInfo) bool {
+	if f == nil {
+		return true
+	}
+	if !f.matchesTags(session.Tags) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !containsFold(f.Statuses, session.status()) {
+		return false
+	}
+	if len(f.ExtensionTypes) == 0 {
+		return true
+	}
+
+	session.Context.mutex.Lock()
+	log := append([]SessionLogMessage{}, session.Context.Log...)
+	session.Context.mutex.Unlock()
+
+	for _, msg := range log {
+		if _, ok := msg.Data.(*ActionRequestData); ok && f.matchesExtensionType(session.server, msg.MessageType) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMessage reports whether the live log message is sent to the reporter.
+func (f *ReporterFilter) matchesMessage(session *SessionInfo, msg SessionLogMessage) bool {
+	if f == nil {
+		return true
+	}
+	if !f.matchesTags(session.Tags) {
+		return false
+	}
+	if len(f.MessageTypes) > 0 && !f.matchesMessageType(msg.MessageType) {
+		return false
+	}
+	return len(f.ExtensionTypes) == 0 || f.matchesExtensionType(session.server, msg.MessageType)
+}
+
+func (f *ReporterFilter) matchesTags(tags []string) bool {
+	if len(f.Tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, wanted := range f.Tags {
+			if strings.EqualFold(strings.TrimPrefix(tag, "@"), strings.TrimPrefix(wanted, "@")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *ReporterFilter) matchesMessageType(msgType string) bool {
+	for _, pattern := range f.MessageTypes {
+		if ok, _ := path.Match(pattern, msgType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesExtensionType reports whether the message was logged for an actor or
+// driver of one of the extension types known to the server.
+func (f *ReporterFilter) matchesExtensionType(s *Server, msgType string) bool {
+	_, kind, name := splitLogType(msgType)
+	if name == "" {
+		return false
+	}
+
+	var extensionType string
+	switch kind {
+	case "actor":
+		s.actorsMutex.Lock()
+		extensionType = s.actors[name].Type
+		s.actorsMutex.Unlock()
+	case "driver":
+		s.drivers.mutex.Lock()
+		extensionType = s.drivers.drivers[name].Type
+		s.drivers.mutex.Unlock()
+	default:
+		return false
+	}
+
+	// Actions of unknown extensions are logged with the requested type.
+	if extensionType == "" {
+		extensionType = name
+	}
+	return containsFold(f.ExtensionTypes, extensionType)
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// recordingReporter is a builtin reporter that remembers the reported sessions.
+type recordingReporter struct {
+	mutex    sync.Mutex
+	sessions []uuid.UUID
+}
+
+func (r *recordingReporter) reportSession(session *SessionInfo) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sessions = append(r.sessions, session.UUID)
+	return nil
+}
+
+func (r *recordingReporter) reported() []uuid.UUID {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]uuid.UUID{}, r.sessions...)
+}
+
+func newFilterTestSession(s *Server, status string, tags ...string) *SessionInfo {
+	sinfo := newTestSession(s)
+	sinfo.Status = status
+	sinfo.Tags = tags
+	return sinfo
+}
+
+func TestReporterFilterMatchesSession(t *testing.T) {
+	s := newTestServer(t)
+	s.drivers.AddDriver(Driver{Name: "filterSelenium", Type: "selenium"})
+	defer func() {
+		s.drivers.mutex.Lock()
+		delete(s.drivers.drivers, "filterSelenium")
+		s.drivers.mutex.Unlock()
+	}()
+
+	filter := &ReporterFilter{Tags: []string{"smoke"}, Statuses: []string{"failed"}}
+	cases := []struct {
+		session  *SessionInfo
+		expected bool
+	}{
+		{newFilterTestSession(s, sessionStatusFailed, "@smoke"), true},
+		{newFilterTestSession(s, sessionStatusFailed, "Smoke", "nightly"), true},
+		{newFilterTestSession(s, sessionStatusPassed, "smoke"), false},
+		{newFilterTestSession(s, sessionStatusFailed, "nightly"), false},
+		{newFilterTestSession(s, sessionStatusFailed), false},
+	}
+	for i, c := range cases {
+		if got := filter.matchesSession(c.session); got != c.expected {
+			t.Errorf("Case %d: expected %v, got %v", i, c.expected, got)
+		}
+	}
+
+	var none *ReporterFilter
+	if !none.matchesSession(newFilterTestSession(s, sessionStatusPassed)) {
+		t.Errorf("Expected missing filter to match everything")
+	}
+
+	byType := &ReporterFilter{ExtensionTypes: []string{"selenium"}}
+	used := newFilterTestSession(s, sessionStatusPassed)
+	used.Context.appendLogData("system::driver::filterSelenium", "Executing action", &ActionRequestData{Action: "open", Attempt: 1})
+	if !byType.matchesSession(used) {
+		t.Errorf("Expected session that used a selenium driver to match")
+	}
+	unused := newFilterTestSession(s, sessionStatusPassed)
+	unused.Context.appendLogData("system::driver::other", "Executing action", &ActionRequestData{Action: "open", Attempt: 1})
+	if byType.matchesSession(unused) {
+		t.Errorf("Expected session without selenium driver not to match")
+	}
+}
+
+func TestReporterFilterMatchesMessage(t *testing.T) {
+	s := newTestServer(t)
+	s.drivers.AddDriver(Driver{Name: "filterSelenium", Type: "selenium"})
+	defer func() {
+		s.drivers.mutex.Lock()
+		delete(s.drivers.drivers, "filterSelenium")
+		s.drivers.mutex.Unlock()
+	}()
+
+	session := newFilterTestSession(s, sessionStatusRunning, "smoke")
+	filter := &ReporterFilter{MessageTypes: []string{"system::driver::*", "message::*::*"}}
+	cases := map[string]bool{
+		"system::driver::filterSelenium":  true,
+		"message::actor::user":            true,
+		"system::actor::user":             false,
+		"system::scenario":                false,
+		"system::assertion::filterDriver": false,
+	}
+	for msgType, expected := range cases {
+		if got := filter.matchesMessage(session, SessionLogMessage{MessageType: msgType}); got != expected {
+			t.Errorf("Expected %s to match %v, got %v", msgType, expected, got)
+		}
+	}
+
+	byType := &ReporterFilter{ExtensionTypes: []string{"selenium"}, Tags: []string{"smoke"}}
+	if !byType.matchesMessage(session, SessionLogMessage{MessageType: "message::driver::filterSelenium"}) {
+		t.Errorf("Expected message of selenium driver to match")
+	}
+	if byType.matchesMessage(session, SessionLogMessage{MessageType: "system::scenario"}) {
+		t.Errorf("Expected message without extension not to match")
+	}
+	if byType.matchesMessage(newFilterTestSession(s, sessionStatusRunning), SessionLogMessage{MessageType: "message::driver::filterSelenium"}) {
+		t.Errorf("Expected message of untagged session not to match")
+	}
+}
+
+func TestReporterFilterFromConfig(t *testing.T) {
+	s := newTestServer(t)
+
+	if filter, err := s.reporterFilterFromConfig("plain"); filter != nil || err != nil {
+		t.Errorf("Expected no filter, got %+v %v", filter, err)
+	}
+
+	s.config.Set("reporter.slack.filter.tags", []string{"smoke"})
+	s.config.Set("reporter.slack.filter.statuses", []string{"failed"})
+	filter, err := s.reporterFilterFromConfig("slack")
+	if err != nil || len(filter.Tags) != 1 || filter.Statuses[0] != "failed" {
+		t.Errorf("Unexpected filter %+v %v", filter, err)
+	}
+
+	s.config.Set("reporter.broken.filter.messageTypes", []string{"system::["})
+	if _, err := s.reporterFilterFromConfig("broken"); err == nil {
+		t.Errorf("Expected error for invalid pattern")
+	}
+}
+
+func TestRegisterReporterWithFilter(t *testing.T) {
+	s := newTestServer(t)
+	defer s.reporters.RemoveReporter("filtered")
+
+	body := `{"name": "filtered", "callback": "http://localhost:1/", "filter": {"tags": ["smoke"], "statuses": ["failed"]}}`
+	rec := httptest.NewRecorder()
+	s.registerReporter(rec, httptest.NewRequest(http.MethodPost, "/reporter/", bytes.NewBufferString(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d", rec.Code)
+	}
+
+	reporter, ok := s.reporters.getReporter("filtered")
+	if !ok || reporter.Filter == nil || reporter.Filter.Tags[0] != "smoke" {
+		t.Errorf("Expected reporter with filter, got %+v", reporter)
+	}
+
+	rec = httptest.NewRecorder()
+	s.registerReporter(rec, httptest.NewRequest(http.MethodPost, "/reporter/", bytes.NewBufferString(`{"name": "invalid", "filter": {"messageTypes": ["["]}}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid filter to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestSendSessionReportFiltered(t *testing.T) {
+	s := newTestServer(t)
+	smoke := &recordingReporter{}
+	all := &recordingReporter{}
+	s.reporters.AddReporter(ReporterInfo{Name: "smokeOnly", Filter: &ReporterFilter{Tags: []string{"smoke"}, Statuses: []string{"failed"}}, builtin: smoke})
+	s.reporters.AddReporter(ReporterInfo{Name: "everything", builtin: all})
+	defer s.reporters.RemoveReporter("smokeOnly")
+	defer s.reporters.RemoveReporter("everything")
+
+	failedSmoke := newFilterTestSession(s, sessionStatusFailed, "smoke")
+	passedSmoke := newFilterTestSession(s, sessionStatusPassed, "smoke")
+	s.sendSessionReport(failedSmoke)
+	s.sendSessionReport(passedSmoke)
+
+	waitForDelivery(t, func() bool { return len(all.reported()) == 2 })
+	if got := smoke.reported(); len(got) != 1 || got[0] != failedSmoke.UUID {
+		t.Errorf("Expected only the failed smoke session, got %v", got)
+	}
+}
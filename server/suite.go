@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	suiteStatusPending = "pending"
+	suiteStatusRunning = "running"
+)
+
+// SuiteInfo groups the sessions of a data driven scenario run. Every
+// combination of the matrix is executed in its own session.
+type SuiteInfo struct {
+	ID           uuid.UUID          `json:"id"`
+	Name         string             `json:"name"`
+	Status       string             `json:"status"`
+	StartedAt    time.Time          `json:"startedAt"`
+	FinishedAt   *time.Time         `json:"finishedAt,omitempty"`
+	Combinations []SuiteCombination `json:"combinations"`
+	mutex        sync.Mutex         `json:"-"`
+}
+
+type SuiteCombination struct {
+	Parameters map[string]any `json:"parameters"`
+	Status     string         `json:"status"`
+	Session    string         `json:"session,omitempty"`
+}
+
+type suiteRegister struct {
+	server *Server
+	mutex  sync.Mutex
+	suites map[uuid.UUID]*SuiteInfo
+	order  []uuid.UUID
+}
+
+// newSuite creates and registers a suite with all combinations pending.
+func (s *Server) newSuite(name string, combinations []map[string]any) *SuiteInfo {
+	suite := &SuiteInfo{
+		ID:           uuid.New(),
+		Name:         name,
+		Status:       suiteStatusRunning,
+		StartedAt:    time.Now(),
+		Combinations: make([]SuiteCombination, len(combinations)),
+	}
+	for i, params := range combinations {
+		suite.Combinations[i] = SuiteCombination{Parameters: params, Status: suiteStatusPending}
+	}
+
+	s.suites.add(suite)
+	s.logger.With("suite", suite.ID.String(), "name", name, "combinations", len(combinations)).Info("New suite created.")
+	return suite
+}
+
+// add registers the suite. Only the most recent suites are kept.
+func (r *suiteRegister) add(suite *SuiteInfo) {
+	limit := defaultSessionHistorySize
+	if r.server.config.IsSet("suites.history") {
+		limit = r.server.config.GetInt("suites.history")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.suites[suite.ID] = suite
+	r.order = append(r.order, suite.ID)
+	for len(r.order) > limit {
+		delete(r.suites, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *suiteRegister) get(id uuid.UUID) *SuiteInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.suites[id]
+}
+
+// sessionSuite returns the suite the session ran in or nil if it did not run
+// in a suite.
+func sessionSuite(session *SessionInfo) *SuiteInfo {
+	if session.Suite == "" {
+		return nil
+	}
+	id, err := uuid.Parse(session.Suite)
+	if err != nil {
+		return nil
+	}
+	return session.server.suites.get(id)
+}
+
+func (s *SuiteInfo) startCombination(i int, session uuid.UUID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Combinations[i].Status = suiteStatusRunning
+	s.Combinations[i].Session = session.String()
+}
+
+func (s *SuiteInfo) completeCombination(i int, verdict string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Combinations[i].Status = verdict
+}
+
+// finish sets the final status of the suite. A suite passes if all of its
+// combinations passed.
+func (s *SuiteInfo) finish() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.FinishedAt = &now
+	s.Status = verdictPassed
+	for _, c := range s.Combinations {
+		if c.Status != verdictPassed {
+			s.Status = verdictFailed
+		}
+	}
+	return s.Status
+}
+
+func (s *SuiteInfo) MarshalJSON() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	type suiteJSON SuiteInfo
+	return json.Marshal((*suiteJSON)(s))
+}
+
+func (s *Server) handleSuiteDetails(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("malformed suite id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	suite := s.suites.get(id)
+	if suite == nil {
+		http.Error(w, "suite not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suite)
+}
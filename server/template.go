@@ -0,0 +1,259 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const redactedValue = "***"
+
+// referencePattern matches references like ${steps.createOrder.data.id} or
+// ${vars.customer} in action parameters. "$${" escapes a literal "${".
+var referencePattern = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+var defaultSensitiveKeys = []string{"password", "secret", "token", "apikey", "authorization", "credential"}
+
+// unresolvedReferenceError is returned when a reference can not be resolved.
+type unresolvedReferenceError struct {
+	Reference string
+	Reason    string
+}
+
+func (e *unresolvedReferenceError) Error() string {
+	return fmt.Sprintf("cannot resolve '${%s}': %s", e.Reference, e.Reason)
+}
+
+// errKeepReference is returned by a partial scope for references into a
+// namespace it does not know.
+var errKeepReference = errors.New("reference is kept")
+
+// referenceScope holds the values references are resolved against.
+type referenceScope struct {
+	doc map[string]any
+	// partial leaves references into unknown namespaces untouched so that they
+	// can be resolved later against the session.
+	partial bool
+}
+
+// newReferenceScope creates a scope from the results of previous steps and the
+// variables of the session.
+func newReferenceScope(steps map[string]*ExecutionResult, vars map[string]any) *referenceScope {
+	return &referenceScope{
+		doc: map[string]any{
+			"steps": normalizeJSON(steps),
+			"vars":  normalizeJSON(vars),
+		},
+	}
+}
+
+// newPartialScope creates a scope that only resolves the given namespaces.
+func newPartialScope(namespaces map[string]any) *referenceScope {
+	doc := make(map[string]any, len(namespaces))
+	for k, v := range namespaces {
+		doc[k] = normalizeJSON(v)
+	}
+	return &referenceScope{doc: doc, partial: true}
+}
+
+func (s *referenceScope) lookup(reference string) (any, error) {
+	ref := strings.TrimSpace(reference)
+	root := ref
+	if end := strings.IndexAny(ref, ".["); end >= 0 {
+		root = ref[:end]
+	}
+
+	ns, ok := s.doc[root]
+	if !ok && s.partial {
+		return nil, errKeepReference
+	}
+	if !ok {
+		return nil, &unresolvedReferenceError{Reference: reference, Reason: fmt.Sprintf("unknown namespace '%s'", root)}
+	}
+
+	value, found, err := lookupPath(map[string]any{root: ns}, ref)
+	if err != nil {
+		return nil, &unresolvedReferenceError{Reference: reference, Reason: err.Error()}
+	}
+	if !found {
+		return nil, &unresolvedReferenceError{Reference: reference, Reason: "no such value"}
+	}
+	return value, nil
+}
+
+// resolve replaces all references in the value. Maps and lists are resolved
+// recursively. A string that consists of a single reference is replaced by the
+// referenced value keeping its type, otherwise the references are interpolated.
+func (s *referenceScope) resolve(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return s.resolveString(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			resolved, err := s.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			resolved, err := s.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	}
+	return value, nil
+}
+
+func (s *referenceScope) resolveString(v string) (any, error) {
+	matches := referencePattern.FindAllStringSubmatchIndex(v, -1)
+	if len(matches) == 0 {
+		return v, nil
+	}
+
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(v) && !strings.HasPrefix(v, "$$") {
+		value, err := s.lookup(v[matches[0][2]:matches[0][3]])
+		if err == errKeepReference {
+			return v, nil
+		}
+		return value, err
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(v[last:m[0]])
+		last = m[1]
+
+		if strings.HasPrefix(v[m[0]:], "$$") {
+			if s.partial {
+				sb.WriteString(v[m[0]:m[1]])
+			} else {
+				sb.WriteString(v[m[0]+1 : m[1]])
+			}
+			continue
+		}
+
+		value, err := s.lookup(v[m[2]:m[3]])
+		if err == errKeepReference {
+			sb.WriteString(v[m[0]:m[1]])
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(valueString(value))
+	}
+	sb.WriteString(v[last:])
+	return sb.String(), nil
+}
+
+// containsReferences reports whether any string in the value holds a reference.
+func containsReferences(value any) bool {
+	switch v := value.(type) {
+	case string:
+		return referencePattern.MatchString(v)
+	case map[string]any:
+		for _, item := range v {
+			if containsReferences(item) {
+				return true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if containsReferences(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveParameters resolves all references in the parameters of an action
+// against the session. The resolved values are logged with secrets redacted.
+func (s *Server) resolveParameters(sinfo *SessionInfo, action string, params map[string]any) (map[string]any, error) {
+	if !containsReferences(params) {
+		return params, nil
+	}
+
+	steps, vars := sinfo.Context.snapshotReferences()
+	resolved, err := newReferenceScope(steps, vars).resolve(normalizeJSON(params))
+	if err != nil {
+		sinfo.Context.appendLog("system::reference", fmt.Sprintf("Resolving parameters of action '%s' failed: %s", action, err.Error()))
+		return nil, newCodedExecutionError(http.StatusBadRequest, ErrorCodeUnresolvedReference, err.Error())
+	}
+
+	resolvedParams, _ := resolved.(map[string]any)
+	sinfo.Context.appendLogData("system::reference", fmt.Sprintf("Resolved parameters of action '%s'.", action), s.redactParameters(resolvedParams, s.secretValues(vars)))
+	return resolvedParams, nil
+}
+
+// isSensitiveKey reports whether values stored under the key must not be logged.
+func (s *Server) isSensitiveKey(key string) bool {
+	keys := defaultSensitiveKeys
+	if s.config.IsSet("redact.keys") {
+		keys = s.config.GetStringSlice("redact.keys")
+	}
+
+	k := strings.ToLower(key)
+	for _, s := range keys {
+		if strings.Contains(k, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretValues returns the string values of all sensitive variables.
+func (s *Server) secretValues(vars map[string]any) []string {
+	var secrets []string
+	for k, v := range vars {
+		if secret, ok := v.(string); ok && secret != "" && s.isSensitiveKey(k) {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// redactParameters returns a copy of the parameters in which values of
+// sensitive keys and occurrences of secret values are replaced.
+func (s *Server) redactParameters(params map[string]any, secrets []string) map[string]any {
+	out, _ := s.redactValue(params, secrets).(map[string]any)
+	return out
+}
+
+func (s *Server) redactValue(value any, secrets []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			if s.isSensitiveKey(k) {
+				out[k] = redactedValue
+				continue
+			}
+			out[k] = s.redactValue(item, secrets)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = s.redactValue(item, secrets)
+		}
+		return out
+	case string:
+		for _, secret := range secrets {
+			v = strings.ReplaceAll(v, secret, redactedValue)
+		}
+		return v
+	}
+	return value
+}
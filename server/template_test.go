@@ -0,0 +1,161 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestReferenceScopeResolve(t *testing.T) {
+	steps := map[string]*ExecutionResult{
+		"createOrder": {Success: true, Data: map[string]any{"id": 42, "lines": []any{"a", "b"}}},
+	}
+	vars := map[string]any{"customer": "ACME"}
+	scope := newReferenceScope(steps, vars)
+
+	resolved, err := scope.resolve(normalizeJSON(map[string]any{
+		"orderId":  "${steps.createOrder.data.id}",
+		"text":     "Order ${steps.createOrder.data.id} for ${vars.customer}",
+		"nested":   []any{map[string]any{"line": "${steps.createOrder.data.lines[1]}"}},
+		"escaped":  "$${vars.customer}",
+		"constant": 7,
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	params := resolved.(map[string]any)
+	if params["orderId"] != float64(42) {
+		t.Errorf("Expected orderId to keep numeric type, got %#v", params["orderId"])
+	}
+	if params["text"] != "Order 42 for ACME" {
+		t.Errorf("Unexpected interpolation result %q", params["text"])
+	}
+	if line := params["nested"].([]any)[0].(map[string]any)["line"]; line != "b" {
+		t.Errorf("Expected nested reference to be resolved, got %v", line)
+	}
+	if params["escaped"] != "${vars.customer}" {
+		t.Errorf("Expected escaped reference to stay literal, got %v", params["escaped"])
+	}
+
+	_, err = scope.resolve("${steps.unknown.data.id}")
+	var refErr *unresolvedReferenceError
+	if !errors.As(err, &refErr) {
+		t.Fatalf("Expected unresolved reference error, got %v", err)
+	}
+
+	if _, err := scope.resolve("${env.HOME}"); err == nil {
+		t.Errorf("Expected error for unknown namespace")
+	}
+}
+
+func TestPartialScopeKeepsUnknownReferences(t *testing.T) {
+	scope := newPartialScope(map[string]any{"args": map[string]any{"1": "pen"}})
+
+	resolved, err := scope.resolve(map[string]any{
+		"product": "${args.1}",
+		"text":    "${args.1} for ${vars.customer}",
+		"order":   "${steps.order.data.id}",
+		"escaped": "$${args.1}",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	params := resolved.(map[string]any)
+	expected := map[string]any{
+		"product": "pen",
+		"text":    "pen for ${vars.customer}",
+		"order":   "${steps.order.data.id}",
+		"escaped": "$${args.1}",
+	}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("Expected %s to be %q, got %q", k, v, params[k])
+		}
+	}
+
+	if _, err := scope.resolve("${args.2}"); err == nil {
+		t.Errorf("Expected error for missing argument")
+	}
+}
+
+func TestRedactParameters(t *testing.T) {
+	s := newTestServer(t)
+	params := map[string]any{
+		"user":     "alice",
+		"password": "hunter2",
+		"header":   "Bearer abc123",
+		"nested":   map[string]any{"apiToken": "t"},
+	}
+
+	redacted := s.redactParameters(params, []string{"abc123"})
+	if redacted["user"] != "alice" {
+		t.Errorf("Expected non sensitive value to be kept")
+	}
+	if redacted["password"] != redactedValue {
+		t.Errorf("Expected password to be redacted, got %v", redacted["password"])
+	}
+	if redacted["header"] != "Bearer "+redactedValue {
+		t.Errorf("Expected secret value to be redacted, got %v", redacted["header"])
+	}
+	if redacted["nested"].(map[string]any)["apiToken"] != redactedValue {
+		t.Errorf("Expected nested token to be redacted")
+	}
+	if params["password"] != "hunter2" {
+		t.Errorf("Expected original parameters to be unchanged")
+	}
+}
+
+func TestExecuteDriverActionResolvesReferences(t *testing.T) {
+	s := newTestServer(t)
+	var received DriverExecutionRequest
+	newTestDriver(t, s, "chainDriver", &testDriver{respond: func(w http.ResponseWriter, req DriverExecutionRequest) {
+		if req.Action == "open" {
+			received = req
+		}
+		w.Write([]byte(`{"success": true, "message": "ok", "data": {"id": "A-42"}}`))
+	}})
+
+	sinfo := newTestSession(s)
+	sinfo.Context.setVariables(map[string]any{"password": "s3cr3t"})
+
+	_, err := s.executeDriverAction(sinfo, DriverExecutionRequest{Session: sinfo.UUID.String(), ID: "create", DriverType: "chainDriver", Action: "create"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = s.executeDriverAction(sinfo, DriverExecutionRequest{
+		Session:    sinfo.UUID.String(),
+		DriverType: "chainDriver",
+		Action:     "open",
+		Parameters: map[string]any{"order": "${steps.create.data.id}", "login": "admin:${vars.password}"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received.Parameters["order"] != "A-42" || received.Parameters["login"] != "admin:s3cr3t" {
+		t.Errorf("Expected resolved parameters to be forwarded, got %v", received.Parameters)
+	}
+
+	for _, msg := range sinfo.Context.Log {
+		if msg.MessageType != "system::reference" {
+			continue
+		}
+		logged := msg.Data.(map[string]any)
+		if logged["login"] != "admin:"+redactedValue {
+			t.Errorf("Expected secret to be redacted in session log, got %v", logged["login"])
+		}
+	}
+
+	_, err = s.executeDriverAction(sinfo, DriverExecutionRequest{
+		Session:    sinfo.UUID.String(),
+		DriverType: "chainDriver",
+		Action:     "open",
+		Parameters: map[string]any{"order": "${steps.missing.data.id}"},
+	})
+	var execErr *executionError
+	if !errors.As(err, &execErr) || execErr.Code != ErrorCodeUnresolvedReference {
+		t.Errorf("Expected unresolved reference error, got %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Babylon dashboard. Polls the server API and renders the sessions, the live
+// log of the selected session and the registry of extensions.
+(function () {
+  "use strict";
+
+  var SESSION_INTERVAL = 2000;
+  var LOG_INTERVAL = 1000;
+  var REGISTRY_INTERVAL = 5000;
+
+  var state = {
+    sessions: [],
+    selected: null,
+    logOffset: 0,
+    logTimer: null,
+    detail: null
+  };
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function el(tag, className, text) {
+    var node = document.createElement(tag);
+    if (className) {
+      node.className = className;
+    }
+    if (text !== undefined && text !== null) {
+      node.textContent = text;
+    }
+    return node;
+  }
+
+  function getJSON(url) {
+    return fetch(url, { cache: "no-store" }).then(function (resp) {
+      if (!resp.ok) {
+        throw new Error(resp.status + " " + resp.statusText);
+      }
+      return resp.json();
+    });
+  }
+
+  function setConnection(ok, error) {
+    var node = $("connection");
+    node.textContent = ok ? "live" : "offline: " + error.message;
+    node.classList.toggle("offline", !ok);
+  }
+
+  function formatTime(value) {
+    if (!value) {
+      return "";
+    }
+    var date = new Date(value);
+    return date.toLocaleTimeString() + "." + String(date.getMilliseconds()).padStart(3, "0");
+  }
+
+  // --- navigation ---
+
+  function showView(name) {
+    ["sessions", "registry"].forEach(function (view) {
+      $(view + "-view").hidden = view !== name;
+    });
+    document.querySelectorAll("header nav a").forEach(function (link) {
+      link.classList.toggle("active", link.dataset.view === name);
+    });
+  }
+
+  function route() {
+    var hash = location.hash.replace(/^#/, "");
+    if (hash === "registry") {
+      showView("registry");
+      return;
+    }
+    showView("sessions");
+    var match = hash.match(/^session\/(.+)$/);
+    if (match && match[1] !== state.selected) {
+      selectSession(match[1]);
+    }
+  }
+
+  // --- sessions ---
+
+  function matchesFilter(session, filter) {
+    if (!filter) {
+      return true;
+    }
+    var text = [session.name, session.uuid, session.status].concat(session.tags || []).join(" ").toLowerCase();
+    return text.indexOf(filter.toLowerCase()) >= 0;
+  }
+
+  function renderSessions() {
+    var list = $("session-list");
+    var filter = $("session-filter").value.trim();
+    list.textContent = "";
+
+    state.sessions.filter(function (s) { return matchesFilter(s, filter); }).forEach(function (session) {
+      var item = el("li", session.status);
+      if (session.uuid === state.selected) {
+        item.classList.add("selected");
+      }
+      item.appendChild(el("div", "title", session.name || session.uuid));
+
+      var info = [session.active ? "active" : session.status, session.messages + " messages"];
+      if (session.createdAt) {
+        info.push(formatTime(session.createdAt));
+      }
+      if (session.tags && session.tags.length) {
+        info.push(session.tags.join(", "));
+      }
+      item.appendChild(el("div", "info", info.join(" · ")));
+
+      item.addEventListener("click", function () {
+        location.hash = "session/" + session.uuid;
+      });
+      list.appendChild(item);
+    });
+  }
+
+  function refreshSessions() {
+    return getJSON("/sessions").then(function (sessions) {
+      state.sessions = sessions;
+      setConnection(true);
+      renderSessions();
+    }).catch(function (err) {
+      setConnection(false, err);
+    });
+  }
+
+  // --- session detail ---
+
+  function selectSession(id) {
+    if (state.logTimer) {
+      clearTimeout(state.logTimer);
+    }
+    state.selected = id;
+    state.logOffset = 0;
+
+    var detail = $("session-detail");
+    detail.textContent = "";
+    detail.appendChild($("session-detail-template").content.cloneNode(true));
+    state.detail = detail;
+
+    detail.querySelector(".uuid").textContent = id;
+    detail.querySelectorAll(".tabs button").forEach(function (button) {
+      button.addEventListener("click", function () {
+        showTab(button.dataset.tab);
+      });
+    });
+
+    renderSessions();
+    pollLog(id);
+  }
+
+  function showTab(tab) {
+    var detail = state.detail;
+    detail.querySelectorAll(".tabs button").forEach(function (button) {
+      button.classList.toggle("active", button.dataset.tab === tab);
+    });
+    detail.querySelector(".log-tab").hidden = tab !== "log";
+    detail.querySelector(".report-tab").hidden = tab !== "report";
+    if (tab === "report") {
+      loadReport();
+    }
+  }
+
+  function loadReport() {
+    var frame = state.detail.querySelector(".report-tab iframe");
+    frame.src = "/session/" + encodeURIComponent(state.selected) + "/report.html?t=" + Date.now();
+  }
+
+  function renderHeader(page) {
+    var detail = state.detail;
+    var session = state.sessions.find(function (s) { return s.uuid === page.session; }) || {};
+    detail.querySelector(".name").textContent = session.name || page.session;
+
+    var status = detail.querySelector(".status");
+    status.textContent = page.active ? "running" : page.status;
+    status.className = "status " + (page.active ? "running" : page.status);
+
+    detail.querySelector(".tags").textContent = (session.tags || []).join(", ");
+    detail.querySelector(".suite").textContent = session.suite || "";
+  }
+
+  function appendLog(messages) {
+    var body = state.detail.querySelector(".log tbody");
+    messages.forEach(function (msg) {
+      var parts = (msg.type || "").split("::");
+      var row = el("tr", parts.map(function (p) { return "log-" + p.replace(/[^a-zA-Z0-9_-]/g, ""); }).join(" "));
+      row.appendChild(el("td", null, formatTime(msg.timestamp)));
+      row.appendChild(el("td", null, msg.type));
+
+      var cell = el("td");
+      cell.appendChild(el("div", null, msg.message));
+      if (msg.data !== undefined && msg.data !== null) {
+        var data = msg.data;
+        if (data && data.content && data.contentType) {
+          data = Object.assign({}, data, { content: "(" + data.content.length + " base64 characters)" });
+        }
+        cell.appendChild(el("pre", null, JSON.stringify(data, null, 2)));
+      }
+      row.appendChild(cell);
+      body.appendChild(row);
+    });
+
+    if (messages.length && state.detail.querySelector(".follow input").checked) {
+      body.lastChild.scrollIntoView({ block: "nearest" });
+    }
+  }
+
+  function pollLog(id) {
+    getJSON("/session/" + encodeURIComponent(id) + "/log?since=" + state.logOffset).then(function (page) {
+      if (state.selected !== id) {
+        return;
+      }
+      renderHeader(page);
+      appendLog(page.messages);
+      state.logOffset = page.next;
+
+      if (page.active) {
+        state.logTimer = setTimeout(function () { pollLog(id); }, LOG_INTERVAL);
+      } else if (!state.detail.querySelector(".report-tab").hidden) {
+        loadReport();
+      }
+    }).catch(function (err) {
+      if (state.selected !== id) {
+        return;
+      }
+      setConnection(false, err);
+      state.logTimer = setTimeout(function () { pollLog(id); }, LOG_INTERVAL * 3);
+    });
+  }
+
+  // --- registry ---
+
+  function renderRegistry(table, entries, reporters) {
+    table.textContent = "";
+    var head = el("tr");
+    ["Name", "Type", "Callback", "Health", "Failures"].concat(reporters ? ["Live"] : []).forEach(function (title) {
+      head.appendChild(el("th", null, title));
+    });
+    table.appendChild(head);
+
+    if (!entries.length) {
+      var empty = el("tr");
+      var cell = el("td", "empty", "None registered.");
+      cell.colSpan = head.children.length;
+      empty.appendChild(cell);
+      table.appendChild(empty);
+      return;
+    }
+
+    entries.forEach(function (entry) {
+      var row = el("tr");
+      row.appendChild(el("td", null, entry.name));
+      row.appendChild(el("td", null, entry.type || ""));
+      row.appendChild(el("td", "callback", entry.callback || "builtin"));
+
+      var health = el("td");
+      health.appendChild(el("span", "status " + entry.circuit.state, entry.circuit.state));
+      row.appendChild(health);
+      row.appendChild(el("td", null, String(entry.circuit.failures)));
+      if (reporters) {
+        row.appendChild(el("td", null, entry.live ? (entry.batch ? "batched" : "yes") : "no"));
+      }
+      table.appendChild(row);
+    });
+  }
+
+  function refreshRegistry() {
+    return getJSON("/registry").then(function (registry) {
+      renderRegistry($("registry-actors"), registry.actors, false);
+      renderRegistry($("registry-drivers"), registry.drivers, false);
+      renderRegistry($("registry-reporters"), registry.reporters, true);
+    }).catch(function (err) {
+      setConnection(false, err);
+    });
+  }
+
+  // --- startup ---
+
+  $("session-filter").addEventListener("input", renderSessions);
+  window.addEventListener("hashchange", route);
+
+  refreshSessions().then(route);
+  refreshRegistry();
+  setInterval(refreshSessions, SESSION_INTERVAL);
+  setInterval(refreshRegistry, REGISTRY_INTERVAL);
+})();
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	deliveryKindWebhook = "webhook"
+
+	defaultWebhookTimeout = 30 * time.Second
+
+	webhookTriggerCompletion        = "completion"
+	webhookTriggerFailure           = "failure"
+	webhookTriggerSuiteFirstFailure = "suiteFirstFailure"
+)
+
+// defaultWebhookBody is sent if no body template is configured.
+const defaultWebhookBody = `{"session": {{json .Session.UUID}}, "name": {{json .Report.Name}}, "status": {{json .Status}}, "trigger": {{json .Trigger}}, "suite": {{json .Session.Suite}}, "tags": {{json .Session.Tags}}, "duration": {{json (seconds .Report.Duration)}}, "failures": {{json .Report.Failures}}}`
+
+// webhookReporter sends finished sessions to arbitrary HTTP endpoints like
+// chat tools or ticket systems. The URL, the headers and the body are Go
+// templates that are rendered with the session:
+//
+//	reporter:
+//	  chat:
+//	    type: webhook
+//	    url: https://chat.example.com/hooks/babylon
+//	    method: POST
+//	    headers:
+//	      Authorization: Bearer secretToken
+//	    body: |
+//	      {"text": {{json (printf "%s %s" .Report.Name .Status)}}}
+//	    triggers: [failure]
+//	    timeout: 30s
+//
+// Triggers are "completion" (default) for every finished session, "failure"
+// for failed sessions and "suiteFirstFailure" for the first failed session of
+// every suite. Requests are delivered through the queue of the reporter and
+// retried according to retry.reporters.<name>. The rendered headers are not
+// shown when dead letters are listed.
+type webhookReporter struct {
+	server   *Server
+	name     string
+	method   string
+	url      *template.Template
+	headers  map[string]*template.Template
+	body     *template.Template
+	triggers []string
+	client   *http.Client
+
+	mutex        sync.Mutex
+	failedSuites map[string]bool
+}
+
+// webhookData is the data the templates of a webhook are rendered with.
+type webhookData struct {
+	Reporter string
+	Trigger  string
+	Status   string
+	Session  *SessionInfo
+	Report   *sessionReport
+	Suite    *SuiteInfo
+}
+
+// webhookRequest is a rendered webhook request waiting for delivery.
+type webhookRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":    strings.Join,
+	"seconds": func(d time.Duration) float64 { return d.Seconds() },
+}
+
+func newWebhookReporter(s *Server, name string) (builtinReporter, error) {
+	key := fmt.Sprintf("reporter.%s.", name)
+
+	url := s.config.GetString(key + "url")
+	if url == "" {
+		return nil, errors.New("missing url")
+	}
+
+	r := &webhookReporter{
+		server:       s,
+		name:         name,
+		method:       http.MethodPost,
+		headers:      make(map[string]*template.Template),
+		triggers:     []string{webhookTriggerCompletion},
+		client:       &http.Client{Timeout: defaultWebhookTimeout},
+		failedSuites: make(map[string]bool),
+	}
+
+	if s.config.IsSet(key + "timeout") {
+		r.client.Timeout = s.config.GetDuration(key + "timeout")
+	}
+
+	if s.config.IsSet(key + "method") {
+		r.method = strings.ToUpper(s.config.GetString(key + "method"))
+	}
+
+	var err error
+	if r.url, err = parseWebhookTemplate("url", url); err != nil {
+		return nil, err
+	}
+
+	body := defaultWebhookBody
+	if s.config.IsSet(key + "body") {
+		body = s.config.GetString(key + "body")
+	}
+	if r.body, err = parseWebhookTemplate("body", body); err != nil {
+		return nil, err
+	}
+
+	for header, value := range s.config.GetStringMapString(key + "headers") {
+		if r.headers[header], err = parseWebhookTemplate("header "+header, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.config.IsSet(key + "triggers") {
+		r.triggers = s.config.GetStringSlice(key + "triggers")
+	}
+	for _, trigger := range r.triggers {
+		switch trigger {
+		case webhookTriggerCompletion, webhookTriggerFailure, webhookTriggerSuiteFirstFailure:
+		default:
+			return nil, fmt.Errorf("unknown trigger '%s'", trigger)
+		}
+	}
+
+	return r, nil
+}
+
+func parseWebhookTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(webhookFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+func (r *webhookReporter) reportSession(session *SessionInfo) error {
+	report := newSessionReport(session)
+	trigger := r.trigger(report)
+	if trigger == "" {
+		return nil
+	}
+
+	data := webhookData{
+		Reporter: r.name,
+		Trigger:  trigger,
+		Status:   session.status(),
+		Session:  session,
+		Report:   report,
+		Suite:    sessionSuite(session),
+	}
+
+	req := webhookRequest{Method: r.method, Headers: make(map[string]string)}
+	var err error
+	if req.URL, err = renderWebhookTemplate(r.url, data); err != nil {
+		return err
+	}
+	if req.Body, err = renderWebhookTemplate(r.body, data); err != nil {
+		return err
+	}
+	for header, tmpl := range r.headers {
+		if req.Headers[header], err = renderWebhookTemplate(tmpl, data); err != nil {
+			return err
+		}
+	}
+
+	r.server.enqueueDelivery(r.name, deliveryKindWebhook, session.UUID.String(), req)
+	return nil
+}
+
+// trigger returns the first configured trigger that applies to the session or
+// an empty string if the webhook is not sent.
+func (r *webhookReporter) trigger(report *sessionReport) string {
+	for _, trigger := range r.triggers {
+		switch trigger {
+		case webhookTriggerCompletion:
+			return trigger
+		case webhookTriggerFailure:
+			if report.Failed() {
+				return trigger
+			}
+		case webhookTriggerSuiteFirstFailure:
+			if report.Failed() && report.Session.Suite != "" && r.firstSuiteFailure(report.Session.Suite) {
+				return trigger
+			}
+		}
+	}
+	return ""
+}
+
+func (r *webhookReporter) firstSuiteFailure(suite string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.failedSuites[suite] {
+		return false
+	}
+
+	// Suites that dropped out of the suite history will not fail again.
+	for id := range r.failedSuites {
+		if uid, err := uuid.Parse(id); err != nil || r.server.suites.get(uid) == nil {
+			delete(r.failedSuites, id)
+		}
+	}
+	r.failedSuites[suite] = true
+	return true
+}
+
+func renderWebhookTemplate(tmpl *template.Template, data webhookData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// send performs the rendered request of a queued webhook message. A payload
+// that cannot be turned into a request is not retried.
+func (r *webhookReporter) send(msg *deliveryMessage) (*http.Response, error) {
+	var data webhookRequest
+	if err := json.Unmarshal(msg.Payload, &data); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidDeliveryPayload, err)
+	}
+
+	req, err := http.NewRequest(data.Method, data.URL, strings.NewReader(data.Body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidDeliveryPayload, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for header, value := range data.Headers {
+		req.Header.Set(header, value)
+	}
+	return r.client.Do(req)
+}
+
+// redactWebhookRequest returns a copy of a queued webhook message in which
+// the credentials of the endpoint are replaced. These are usually the values
+// of the headers or, for incoming webhooks of chat tools, the path and query
+// of the URL.
+func redactWebhookRequest(msg deliveryMessage) deliveryMessage {
+	var data webhookRequest
+	if err := json.Unmarshal(msg.Payload, &data); err != nil {
+		return msg
+	}
+	for header := range data.Headers {
+		data.Headers[header] = redactedValue
+	}
+	data.URL = redactURL(data.URL)
+	if payload, err := json.Marshal(data); err == nil {
+		msg.Payload = payload
+	}
+	return msg
+}
+
+// redactURL keeps only the scheme and the host of the URL.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redactedValue
+	}
+	redacted := url.URL{Scheme: u.Scheme, Host: u.Host}
+	if u.Path != "" && u.Path != "/" {
+		redacted.Path = "/" + redactedValue
+	}
+	if u.RawQuery != "" {
+		redacted.RawQuery = redactedValue
+	}
+	return redacted.String()
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type webhookTestRequest struct {
+	method        string
+	path          string
+	authorization string
+	body          string
+}
+
+// webhookTestEndpoint is a fake webhook endpoint that answers with the status
+// returned by respond and records all requests.
+type webhookTestEndpoint struct {
+	mutex    sync.Mutex
+	respond  func(attempt int) int
+	requests []webhookTestRequest
+}
+
+func newWebhookTestEndpoint(t *testing.T, respond func(attempt int) int) (*webhookTestEndpoint, string) {
+	fake := &webhookTestEndpoint{respond: respond}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+		fake.requests = append(fake.requests, webhookTestRequest{
+			method:        r.Method,
+			path:          r.URL.Path,
+			authorization: r.Header.Get("Authorization"),
+			body:          string(body),
+		})
+		w.WriteHeader(fake.respond(len(fake.requests)))
+	}))
+	t.Cleanup(ts.Close)
+	return fake, ts.URL
+}
+
+func (f *webhookTestEndpoint) received() []webhookTestRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]webhookTestRequest{}, f.requests...)
+}
+
+// newWebhookTestReporter creates and registers the webhook reporter configured
+// in reporter.<name>.
+func newWebhookTestReporter(t *testing.T, s *Server, name string) *webhookReporter {
+	builtin, err := newWebhookReporter(s, name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	s.reporters.AddReporter(ReporterInfo{Name: name, Type: "webhook", builtin: builtin})
+	t.Cleanup(func() {
+		s.reporters.RemoveReporter(name)
+		if q := s.deliveries.get(name); q != nil {
+			waitForDelivery(t, func() bool { return q.pending() == 0 })
+		}
+		s.deliveries.mutex.Lock()
+		delete(s.deliveries.queues, name)
+		s.deliveries.mutex.Unlock()
+	})
+	return builtin.(*webhookReporter)
+}
+
+func TestWebhookReporter(t *testing.T) {
+	s := newTestServer(t)
+	sinfo := runReportTestScenario(t, s, reportTestScenario)
+
+	fake, url := newWebhookTestEndpoint(t, func(int) int { return http.StatusOK })
+	s.config.Set("reporter.chat.url", url+"/hooks/{{.Report.Name}}")
+	s.config.Set("reporter.chat.method", "put")
+	s.config.Set("reporter.chat.headers", map[string]any{"Authorization": "Bearer {{.Reporter}}"})
+	s.config.Set("reporter.chat.body", `{"text": {{json (printf "%s %s" .Report.Name .Status)}}, "trigger": {{json .Trigger}}}`)
+	s.config.Set("reporter.chat.triggers", []string{"failure"})
+	webhook := newWebhookTestReporter(t, s, "chat")
+
+	if err := webhook.reportSession(newFilterTestSession(s, sessionStatusPassed)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := webhook.reportSession(sinfo); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	waitForDelivery(t, func() bool { return len(fake.received()) == 1 })
+	req := fake.received()[0]
+	if req.method != http.MethodPut || req.path != "/hooks/Report" || req.authorization != "Bearer chat" {
+		t.Errorf("Unexpected request %+v", req)
+	}
+	if req.body != `{"text": "Report failed", "trigger": "failure"}` {
+		t.Errorf("Unexpected body %s", req.body)
+	}
+}
+
+func TestWebhookDefaultBodyAndRetries(t *testing.T) {
+	s := newTestServer(t)
+
+	fake, url := newWebhookTestEndpoint(t, func(attempt int) int {
+		if attempt == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	s.config.Set("reporter.retried.url", url)
+	s.config.Set("retry.reporters.retried.backoff", "1ms")
+	webhook := newWebhookTestReporter(t, s, "retried")
+
+	sinfo := newFilterTestSession(s, sessionStatusPassed, "smoke")
+	if err := webhook.reportSession(sinfo); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	waitForDelivery(t, func() bool { return len(fake.received()) == 2 })
+	body := fake.received()[1].body
+	for _, expected := range []string{`"session": "` + sinfo.UUID.String(), `"status": "passed"`, `"trigger": "completion"`, `"tags": ["smoke"]`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected body to contain %s, got %s", expected, body)
+		}
+	}
+}
+
+func TestWebhookSuiteFirstFailure(t *testing.T) {
+	s := newTestServer(t)
+
+	s.config.Set("reporter.suite.url", "http://localhost/")
+	s.config.Set("reporter.suite.triggers", []string{"suiteFirstFailure"})
+	builtin, err := newWebhookReporter(s, "suite")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	webhook := builtin.(*webhookReporter)
+
+	suite := s.newSuite("Webhook", []map[string]any{{}, {}, {}})
+	triggered := 0
+	for _, status := range []string{sessionStatusPassed, sessionStatusFailed, sessionStatusFailed} {
+		sinfo := newFilterTestSession(s, status)
+		sinfo.Suite = suite.ID.String()
+		if webhook.trigger(newSessionReport(sinfo)) != "" {
+			triggered++
+		}
+	}
+	if triggered != 1 {
+		t.Errorf("Expected exactly one trigger, got %d", triggered)
+	}
+
+	if webhook.trigger(newSessionReport(newFilterTestSession(s, sessionStatusFailed))) != "" {
+		t.Errorf("Expected session without suite not to trigger")
+	}
+}
+
+func TestWebhookDeadLettersRedacted(t *testing.T) {
+	s := newTestServer(t)
+	dir := t.TempDir()
+	s.config.Set("delivery.directory", dir)
+
+	_, url := newWebhookTestEndpoint(t, func(int) int { return http.StatusBadRequest })
+	s.config.Set("reporter.secured.url", url+"/hooks/secretPath?token=secretQuery")
+	s.config.Set("reporter.secured.headers", map[string]any{"Authorization": "Bearer secretToken"})
+	webhook := newWebhookTestReporter(t, s, "secured")
+
+	if err := webhook.reportSession(newFilterTestSession(s, sessionStatusPassed)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	q := s.deliveries.get("secured")
+	waitForDelivery(t, func() bool { return len(q.listDeadLetters()) == 1 })
+
+	req := httptest.NewRequest(http.MethodGet, "/reporter/secured/deadletters", nil)
+	req.SetPathValue("name", "secured")
+	rec := httptest.NewRecorder()
+	s.handleReporterDeadLetters(rec, req)
+	for _, secret := range []string{"secretToken", "secretPath", "secretQuery"} {
+		if strings.Contains(rec.Body.String(), secret) {
+			t.Errorf("Expected %s to be redacted, got %s", secret, rec.Body.String())
+		}
+	}
+	if !strings.Contains(rec.Body.String(), strings.TrimPrefix(url, "http://")) {
+		t.Errorf("Expected host of the webhook to be listed, got %s", rec.Body.String())
+	}
+
+	info, err := os.Stat(filepath.Join(dir, deliveryDeadLetterDirectory, q.listDeadLetters()[0].ID.String()+".json"))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected dead letter to be readable by the owner only, got %v %v", info, err)
+	}
+}
+
+func TestWebhookInvalidPayloadNotRetried(t *testing.T) {
+	s := newTestServer(t)
+	fake, url := newWebhookTestEndpoint(t, func(int) int { return http.StatusOK })
+	s.config.Set("reporter.corrupt.url", url)
+	s.config.Set("retry.reporters.corrupt.maxAttempts", 5)
+	newWebhookTestReporter(t, s, "corrupt")
+
+	q := s.deliveries.queue("corrupt")
+	q.push(&deliveryMessage{ID: uuid.New(), Reporter: "corrupt", Kind: deliveryKindWebhook, Session: "corrupt", Payload: []byte(`"not a request"`)})
+	waitForDelivery(t, func() bool { return len(q.listDeadLetters()) == 1 })
+
+	if letter := q.listDeadLetters()[0]; letter.Attempts != 1 {
+		t.Errorf("Expected invalid payload not to be retried, got %d attempts", letter.Attempts)
+	}
+	if len(fake.received()) != 0 {
+		t.Errorf("Expected nothing to be sent")
+	}
+	if state := s.breakers.info("reporter", "corrupt").State; state != circuitClosed {
+		t.Errorf("Expected invalid payload not to affect the circuit, got %s", state)
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { close(release) })
+
+	s.config.Set("reporter.hanging.url", ts.URL)
+	s.config.Set("reporter.hanging.timeout", "50ms")
+	s.config.Set("retry.reporters.hanging.maxAttempts", 1)
+	webhook := newWebhookTestReporter(t, s, "hanging")
+
+	if err := webhook.reportSession(newFilterTestSession(s, sessionStatusPassed)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	q := s.deliveries.get("hanging")
+	waitForDelivery(t, func() bool { return len(q.listDeadLetters()) == 1 })
+	if letter := q.listDeadLetters()[0]; !strings.Contains(letter.LastError, "Timeout") {
+		t.Errorf("Expected delivery to time out, got %q", letter.LastError)
+	}
+}
+
+func TestNewWebhookReporterInvalid(t *testing.T) {
+	s := newTestServer(t)
+
+	s.config.Set("reporter.unknownTrigger.url", "http://localhost/")
+	s.config.Set("reporter.unknownTrigger.triggers", []string{"always"})
+	s.config.Set("reporter.brokenBody.url", "http://localhost/")
+	s.config.Set("reporter.brokenBody.body", "{{.Session")
+
+	for _, name := range []string{"missingURL", "unknownTrigger", "brokenBody"} {
+		if _, err := newWebhookReporter(s, name); err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+}